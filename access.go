@@ -0,0 +1,132 @@
+package main
+
+import (
+  "fmt"
+  "net"
+  "regexp"
+  "strings"
+)
+
+// regexpList is a repeatable flag of regular expressions.
+type regexpList []*regexp.Regexp
+
+var allowPatterns, denyPatterns regexpList
+
+func (l *regexpList) String() string {
+  patterns := make([]string, len(*l))
+  for i, re := range *l {
+    patterns[i] = re.String()
+  }
+  return strings.Join(patterns, " ")
+}
+
+func (l *regexpList) Set(value string) error {
+  re, err := regexp.Compile(value)
+  if err != nil {
+    return fmt.Errorf("invalid pattern %q: %v", value, err)
+  }
+  *l = append(*l, re)
+  return nil
+}
+
+func (l regexpList) matches(s string) bool {
+  for _, re := range l {
+    if re.MatchString(s) {
+      return true
+    }
+  }
+  return false
+}
+
+// pathPermitted reports whether the rules let urlPath be served: it must match no -deny pattern
+// and, when -allow patterns are given, at least one of them.
+func pathPermitted(urlPath string) bool {
+  if denyPatterns.matches(urlPath) {
+    return false
+  }
+  return len(allowPatterns) == 0 || allowPatterns.matches(urlPath)
+}
+
+// servedPathAllowed repeats the access and auth checks for urlPath when a fallback serves it in
+// place of the path requested, which is all the checks in handleRequest saw. It answers the
+// request and returns false when urlPath may not be served.
+func servedPathAllowed(conn net.Conn, req *request, urlPath string) bool {
+  if !pathPermitted(urlPath) {
+    sendError(conn, 403, "Forbidden")
+    return false
+  }
+  if !authorized(req, urlPath) {
+    sendUnauthorized(conn)
+    return false
+  }
+  return true
+}
+
+// userAgentRule blocks or reroutes requests whose User-Agent matches pattern: blocked requests are
+// refused, others are served from under route.
+type userAgentRule struct {
+  pattern *regexp.Regexp
+  block   bool
+  route   string
+}
+
+// userAgentRules is the repeatable -user-agent-rule flag, checked in order; the first match applies.
+type userAgentRules []userAgentRule
+
+var agentRules userAgentRules
+
+func (l *userAgentRules) String() string {
+  rules := make([]string, len(*l))
+  for i, rule := range *l {
+    action := rule.route + "/"
+    if rule.block {
+      action = "block"
+    }
+    rules[i] = rule.pattern.String() + "=" + action
+  }
+  return strings.Join(rules, " ")
+}
+
+// Set adds a "pattern=block" or "pattern=/prefix" rule. The action follows the last "=", so
+// patterns may contain one.
+func (l *userAgentRules) Set(value string) error {
+  i := strings.LastIndex(value, "=")
+  if i < 0 {
+    return fmt.Errorf("invalid user agent rule %q: expected pattern=block or pattern=/prefix", value)
+  }
+  pattern, action := value[:i], strings.TrimSpace(value[i+1:])
+
+  re, err := regexp.Compile(pattern)
+  if err != nil {
+    return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+  }
+
+  rule := userAgentRule{pattern: re}
+  switch {
+  case action == "block":
+    rule.block = true
+  case strings.HasPrefix(action, "/"):
+    rule.route = strings.TrimSuffix(cleanURLPath(action), "/")
+  default:
+    return fmt.Errorf("invalid user agent rule %q: action must be block or a path", value)
+  }
+  *l = append(*l, rule)
+  return nil
+}
+
+// applyUserAgentRules applies the first rule matching the request's User-Agent. It reports false
+// when the request is blocked; a routing rule moves req.path under the rule's prefix.
+func applyUserAgentRules(req *request) bool {
+  agent := req.header("User-Agent")
+  for _, rule := range agentRules {
+    if !rule.pattern.MatchString(agent) {
+      continue
+    }
+    if rule.block {
+      return false
+    }
+    req.path = rule.route + req.path
+    return true
+  }
+  return true
+}
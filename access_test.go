@@ -0,0 +1,125 @@
+package main
+
+import (
+  "strings"
+  "testing"
+)
+
+// useAccessRules sets the -allow and -deny patterns for the duration of the test.
+func useAccessRules(t *testing.T, allow, deny []string) {
+  t.Helper()
+  originalAllow, originalDeny := allowPatterns, denyPatterns
+  allowPatterns, denyPatterns = nil, nil
+  for _, pattern := range allow {
+    if err := allowPatterns.Set(pattern); err != nil {
+      t.Fatalf("Unexpected error: %v", err)
+    }
+  }
+  for _, pattern := range deny {
+    if err := denyPatterns.Set(pattern); err != nil {
+      t.Fatalf("Unexpected error: %v", err)
+    }
+  }
+  t.Cleanup(func() { allowPatterns, denyPatterns = originalAllow, originalDeny })
+}
+
+func TestAccessRules(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "index.html":         "home",
+    "style.css":          "css",
+    "notes.txt":          "notes",
+    "private/index.html": "secret",
+  })
+  useRoots(t, tempDir)
+
+  testCases := []struct {
+    name         string
+    allow        []string
+    deny         []string
+    path         string
+    expectedCode string
+  }{
+    {name: "No rules", path: "/notes.txt", expectedCode: "HTTP/1.1 200 OK"},
+    {name: "Denied prefix", deny: []string{`^/private/`}, path: "/private/index.html", expectedCode: "HTTP/1.1 403 Forbidden"},
+    {name: "Not denied", deny: []string{`^/private/`}, path: "/index.html", expectedCode: "HTTP/1.1 200 OK"},
+    {name: "Allowed extension", allow: []string{`\.(html|css|js)$`}, path: "/style.css", expectedCode: "HTTP/1.1 200 OK"},
+    {name: "Not allowed", allow: []string{`\.(html|css|js)$`}, path: "/notes.txt", expectedCode: "HTTP/1.1 403 Forbidden"},
+    {name: "Deny wins over allow", allow: []string{`\.html$`}, deny: []string{`^/private/`}, path: "/private/index.html", expectedCode: "HTTP/1.1 403 Forbidden"},
+    {name: "Missing allowed file", allow: []string{`\.html$`}, path: "/missing.html", expectedCode: "HTTP/1.1 404 Not Found"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      useAccessRules(t, tc.allow, tc.deny)
+
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+
+      if response := conn.GetWrittenData(); !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+    })
+  }
+
+  var patterns regexpList
+  if err := patterns.Set("("); err == nil {
+    t.Errorf("Expected error for an invalid regular expression")
+  }
+}
+
+func TestUserAgentRules(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "index.html":             "browser page",
+    "prerendered/index.html": "bot page",
+  })
+  useRoots(t, tempDir)
+
+  originalRules := agentRules
+  agentRules = nil
+  defer func() { agentRules = originalRules }()
+  for _, rule := range []string{`(?i)badbot=block`, `(?i)googlebot=/prerendered`} {
+    if err := agentRules.Set(rule); err != nil {
+      t.Fatalf("Unexpected error: %v", err)
+    }
+  }
+
+  testCases := []struct {
+    name         string
+    agent        string
+    expectedCode string
+    expectedBody string
+  }{
+    {"Browser", "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0", "HTTP/1.1 200 OK", "browser page"},
+    {"No User-Agent", "", "HTTP/1.1 200 OK", "browser page"},
+    {"Blocked bot", "BadBot/2.1", "HTTP/1.1 403 Forbidden", ""},
+    {"Routed bot", "Mozilla/5.0 (compatible; Googlebot/2.1)", "HTTP/1.1 200 OK", "bot page"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      request := "GET /index.html HTTP/1.1\r\n"
+      if tc.agent != "" {
+        request += "User-Agent: " + tc.agent + "\r\n"
+      }
+      conn := newMockConn(request + "\r\n")
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+      if tc.expectedBody != "" && !strings.HasSuffix(response, tc.expectedBody) {
+        t.Errorf("Expected body %q, got: %s", tc.expectedBody, response)
+      }
+    })
+  }
+
+  var rules userAgentRules
+  for _, invalid := range []string{"badbot", "(=block", "badbot=allow"} {
+    if err := rules.Set(invalid); err == nil {
+      t.Errorf("Expected error for rule %q", invalid)
+    }
+  }
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "log"
+  "net"
+  "os"
+  "strings"
+  "sync"
+  "time"
+)
+
+var accessLogPath string
+
+// logErrorsOnly leaves successful and redirected (2xx and 3xx) requests out of the access log.
+var logErrorsOnly bool
+
+// accessLog receives access log entries. It is the standard logger unless -access-log names a file,
+// in which case diagnostics keep going to stderr and accessLogFile backs this logger.
+var (
+  accessLog     = log.Default()
+  accessLogFile *logFile
+)
+
+// logFile is an append-only log file that can be reopened after it was rotated away.
+type logFile struct {
+  mu   sync.Mutex
+  path string
+  file *os.File
+}
+
+func openLogFile(path string) (*logFile, error) {
+  l := &logFile{path: path}
+  if err := l.reopen(); err != nil {
+    return nil, err
+  }
+  return l, nil
+}
+
+// reopen opens the path again and swaps the new file in, so entries follow a renamed log to its
+// replacement. On failure the previous file stays in use.
+func (l *logFile) reopen() error {
+  file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+  if err != nil {
+    return fmt.Errorf("opening access log: %v", err)
+  }
+
+  l.mu.Lock()
+  previous := l.file
+  l.file = file
+  l.mu.Unlock()
+
+  if previous != nil {
+    previous.Close()
+  }
+  return nil
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+  l.mu.Lock()
+  defer l.mu.Unlock()
+  return l.file.Write(p)
+}
+
+// accessEntry is a single access log record. Optional fields are omitted from JSON output when empty.
+type accessEntry struct {
+  Time       string  `json:"time"`
+  Method     string  `json:"method"`
+  Path       string  `json:"path"`
+  Version    string  `json:"version"`
+  Client     string  `json:"client,omitempty"`
+  Status     int     `json:"status,omitempty"`
+  Bytes      int64   `json:"bytes,omitempty"`
+  DurationMS float64 `json:"duration_ms,omitempty"`
+  TLSVersion string  `json:"tls_version,omitempty"`
+  TLSCipher  string  `json:"tls_cipher,omitempty"`
+}
+
+func validateLogFormat(format string) error {
+  if format != "text" && format != "json" {
+    return fmt.Errorf("unknown log format %q (expected text or json)", format)
+  }
+  return nil
+}
+
+func logRequest(conn net.Conn, req *request) {
+  if currentLogLevel < levelInfo {
+    return
+  }
+
+  entry := accessEntry{
+    Time:    time.Now().Format(time.RFC3339),
+    Method:  req.method,
+    Path:    req.path,
+    Version: strings.TrimSpace(req.version),
+  }
+
+  if client := clientIP(conn, req); client.IsValid() {
+    entry.Client = client.String()
+  }
+
+  if rc, ok := conn.(*responseConn); ok {
+    if logErrorsOnly && rc.status < 400 {
+      return
+    }
+    entry.Status, entry.Bytes = rc.status, rc.written
+    entry.DurationMS = float64(time.Since(rc.start).Microseconds()) / 1000
+  }
+
+  if logTLS {
+    if tlsVersion, cipher, ok := tlsParams(conn); ok {
+      entry.TLSVersion, entry.TLSCipher = tlsVersion, cipher
+    }
+  }
+
+  if logFormat == "json" {
+    line, err := json.Marshal(entry)
+    if err != nil {
+      log.Printf("Error encoding access log entry: %v", err)
+      return
+    }
+    accessLog.Writer().Write(append(line, '\n'))
+    return
+  }
+
+  var builder strings.Builder
+  fmt.Fprintf(&builder, "New Request [Method: %s, Path: %s, Version: %s", entry.Method, entry.Path, entry.Version)
+  if entry.Client != "" {
+    fmt.Fprintf(&builder, ", Client: %s", entry.Client)
+  }
+  if entry.Status != 0 {
+    fmt.Fprintf(&builder, ", Status: %d, Bytes: %d, Duration: %.3fms", entry.Status, entry.Bytes, entry.DurationMS)
+  }
+  if entry.TLSVersion != "" {
+    fmt.Fprintf(&builder, ", TLS: %s, Cipher: %s", entry.TLSVersion, entry.TLSCipher)
+  }
+  builder.WriteString("]")
+  accessLog.Print(builder.String())
+}
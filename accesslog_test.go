@@ -0,0 +1,174 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "log"
+  "net"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+// captureLog redirects the standard logger into a buffer for the duration of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+  t.Helper()
+
+  var buf bytes.Buffer
+  originalOutput, originalFlags := log.Writer(), log.Flags()
+  log.SetOutput(&buf)
+  t.Cleanup(func() {
+    log.SetOutput(originalOutput)
+    log.SetFlags(originalFlags)
+  })
+  return &buf
+}
+
+func TestLogRequest(t *testing.T) {
+  tlsConn, _ := newTLSPair(t)
+
+  testCases := []struct {
+    name      string
+    format    string
+    conn      net.Conn
+    expectTLS bool
+  }{
+    {name: "Text plaintext", format: "text", conn: newMockConn(""), expectTLS: false},
+    {name: "Text TLS", format: "text", conn: tlsConn, expectTLS: true},
+    {name: "JSON plaintext", format: "json", conn: newMockConn(""), expectTLS: false},
+    {name: "JSON TLS", format: "json", conn: tlsConn, expectTLS: true},
+  }
+
+  originalFormat, originalLogTLS := logFormat, logTLS
+  defer func() { logFormat, logTLS = originalFormat, originalLogTLS }()
+  logTLS = true
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      buf := captureLog(t)
+      logFormat = tc.format
+
+      logRequest(tc.conn, &request{method: "GET", path: "/index.html", version: "HTTP/1.1\r\n"})
+      output := buf.String()
+
+      if tc.format == "json" {
+        var entry map[string]string
+        if err := json.Unmarshal([]byte(output), &entry); err != nil {
+          t.Fatalf("Expected a JSON log line, got %q: %v", output, err)
+        }
+        if entry["path"] != "/index.html" || entry["version"] != "HTTP/1.1" {
+          t.Errorf("Unexpected JSON entry: %v", entry)
+        }
+        _, hasVersion := entry["tls_version"]
+        _, hasCipher := entry["tls_cipher"]
+        if hasVersion != tc.expectTLS || hasCipher != tc.expectTLS {
+          t.Errorf("Expected TLS fields present=%v, got %v", tc.expectTLS, entry)
+        }
+        return
+      }
+
+      if !strings.Contains(output, "Path: /index.html") {
+        t.Errorf("Expected path in log line, got %q", output)
+      }
+      if strings.Contains(output, "TLS: TLS 1.3") != tc.expectTLS {
+        t.Errorf("Expected TLS fields present=%v, got %q", tc.expectTLS, output)
+      }
+    })
+  }
+}
+
+func TestLogRequestTLSDisabled(t *testing.T) {
+  tlsConn, _ := newTLSPair(t)
+
+  originalFormat, originalLogTLS := logFormat, logTLS
+  defer func() { logFormat, logTLS = originalFormat, originalLogTLS }()
+  logFormat, logTLS = "text", false
+
+  buf := captureLog(t)
+  logRequest(tlsConn, &request{method: "GET", path: "/", version: "HTTP/1.1\r\n"})
+
+  if strings.Contains(buf.String(), "TLS:") {
+    t.Errorf("Expected TLS fields to be omitted when -log-tls is off, got %q", buf.String())
+  }
+}
+
+// useAccessLogFile sends access logs to a fresh file in a temp dir for the duration of the test.
+func useAccessLogFile(t *testing.T) (*logFile, string) {
+  t.Helper()
+
+  path := filepath.Join(t.TempDir(), "access.log")
+  file, err := openLogFile(path)
+  if err != nil {
+    t.Fatalf("Failed to open access log: %v", err)
+  }
+
+  originalLog, originalFile := accessLog, accessLogFile
+  accessLog, accessLogFile = log.New(file, "", 0), file
+  t.Cleanup(func() {
+    accessLog, accessLogFile = originalLog, originalFile
+    file.file.Close()
+  })
+  return file, path
+}
+
+func TestAccessLogFile(t *testing.T) {
+  diagnostics := captureLog(t)
+  file, path := useAccessLogFile(t)
+
+  conn := newMockConn("GET /missing HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+
+  written, err := os.ReadFile(path)
+  if err != nil {
+    t.Fatalf("Failed to read access log: %v", err)
+  }
+  if !strings.Contains(string(written), "Path: /missing") {
+    t.Errorf("Expected the request in the access log file, got: %s", written)
+  }
+  if strings.Contains(diagnostics.String(), "New Request") {
+    t.Errorf("Expected no access entries on the diagnostic logger, got: %s", diagnostics)
+  }
+
+  // After a rotation the reopened file receives new entries.
+  rotated := path + ".1"
+  if err := os.Rename(path, rotated); err != nil {
+    t.Fatalf("Failed to rotate access log: %v", err)
+  }
+  if err := file.reopen(); err != nil {
+    t.Fatalf("Failed to reopen access log: %v", err)
+  }
+  handleConnection(newMockConn("GET /after HTTP/1.1\r\n\r\n"))
+
+  written, _ = os.ReadFile(path)
+  old, _ := os.ReadFile(rotated)
+  if !strings.Contains(string(written), "Path: /after") || strings.Contains(string(old), "Path: /after") {
+    t.Errorf("Expected new entries in the reopened file, got %q and rotated %q", written, old)
+  }
+}
+
+func TestLogRequestsOnlyErrors(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"index.html": "hello"})
+  useRoots(t, tempDir)
+  _, path := useAccessLogFile(t)
+
+  original := logErrorsOnly
+  logErrorsOnly = true
+  defer func() { logErrorsOnly = original }()
+
+  for _, target := range []string{"/index.html", "/missing"} {
+    handleConnection(newMockConn("GET " + target + " HTTP/1.1\r\n\r\n"))
+  }
+
+  written, err := os.ReadFile(path)
+  if err != nil {
+    t.Fatalf("Failed to read access log: %v", err)
+  }
+  if strings.Contains(string(written), "Path: /index.html") {
+    t.Errorf("Expected no entry for the 200 response, got: %s", written)
+  }
+  if !strings.Contains(string(written), "Path: /missing, Version: HTTP/1.1, Status: 404") {
+    t.Errorf("Expected an entry for the 404 response, got: %s", written)
+  }
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+  "archive/tar"
+  "archive/zip"
+  "bytes"
+  "compress/gzip"
+  "errors"
+  "fmt"
+  "io"
+  "io/fs"
+  "net"
+  "os"
+  "strings"
+  "time"
+)
+
+var archivePath string
+
+// activeArchive is served instead of the document roots when -archive is set.
+var activeArchive *archive
+
+// archive serves the files of a zip archive. Tar archives are repacked into an uncompressed zip
+// in memory when opened, so both share the same lookup and listing code.
+type archive struct {
+  reader *zip.Reader
+  files  map[string]*zip.File
+}
+
+func newZipArchive(reader *zip.Reader) *archive {
+  a := &archive{reader: reader, files: make(map[string]*zip.File)}
+  for _, f := range reader.File {
+    a.files[strings.TrimPrefix(cleanURLPath(f.Name), "/")] = f
+  }
+  return a
+}
+
+// openArchive opens a .zip, .tar, .tar.gz or .tgz file for serving.
+func openArchive(name string) (*archive, error) {
+  lower := strings.ToLower(name)
+
+  if strings.HasSuffix(lower, ".zip") {
+    reader, err := zip.OpenReader(name)
+    if err != nil {
+      return nil, fmt.Errorf("opening archive: %v", err)
+    }
+    // The archive stays open for the lifetime of the process.
+    return newZipArchive(&reader.Reader), nil
+  }
+
+  file, err := os.Open(name)
+  if err != nil {
+    return nil, fmt.Errorf("opening archive: %v", err)
+  }
+  defer file.Close()
+
+  var r io.Reader = file
+  switch {
+  case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+    gz, err := gzip.NewReader(file)
+    if err != nil {
+      return nil, fmt.Errorf("opening archive: %v", err)
+    }
+    defer gz.Close()
+    r = gz
+  case strings.HasSuffix(lower, ".tar"):
+  default:
+    return nil, fmt.Errorf("unsupported archive %s (expected .zip, .tar, .tar.gz or .tgz)", name)
+  }
+
+  reader, err := repackTar(r)
+  if err != nil {
+    return nil, fmt.Errorf("reading %s: %v", name, err)
+  }
+  return newZipArchive(reader), nil
+}
+
+// repackTar copies the regular files and directories of a tar stream into an uncompressed zip.
+func repackTar(r io.Reader) (*zip.Reader, error) {
+  var buf bytes.Buffer
+  tr := tar.NewReader(r)
+  zw := zip.NewWriter(&buf)
+
+  for {
+    hdr, err := tr.Next()
+    if err == io.EOF {
+      break
+    }
+    if err != nil {
+      return nil, err
+    }
+
+    name := strings.TrimPrefix(cleanURLPath(hdr.Name), "/")
+    if name == "" {
+      continue
+    }
+
+    switch hdr.Typeflag {
+    case tar.TypeDir:
+      if _, err := zw.CreateHeader(&zip.FileHeader{Name: name + "/", Modified: hdr.ModTime}); err != nil {
+        return nil, err
+      }
+    case tar.TypeReg:
+      w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: hdr.ModTime})
+      if err != nil {
+        return nil, err
+      }
+      if _, err := io.Copy(w, tr); err != nil {
+        return nil, err
+      }
+    }
+  }
+
+  if err := zw.Close(); err != nil {
+    return nil, err
+  }
+  return zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+}
+
+// open returns the content of the named file. Uncompressed entries can seek, so ranges work
+// for them; compressed entries are decompressed as they are read and always sent whole.
+func (a *archive) open(name string) (io.Reader, error) {
+  f, ok := a.files[name]
+  if !ok {
+    return nil, fs.ErrNotExist
+  }
+
+  if f.Method == zip.Store {
+    if raw, err := f.OpenRaw(); err == nil {
+      if seeker, ok := raw.(io.ReadSeeker); ok {
+        return seeker, nil
+      }
+    }
+  }
+  return f.Open()
+}
+
+// serve answers req from the archive: files are sent and directories listed like on disk.
+func (a *archive) serve(conn net.Conn, req *request) {
+
+  name := strings.TrimPrefix(cleanURLPath(req.path), "/")
+  if name == "" {
+    name = "."
+  }
+
+  statStart := time.Now()
+  info, err := fs.Stat(a.reader, name)
+  recordTiming(conn, "stat", statStart)
+
+  if err != nil {
+    sendFSError(conn, err)
+    return
+  }
+
+  if info.IsDir() {
+    entries, err := fs.ReadDir(a.reader, name)
+    if err != nil {
+      sendFSError(conn, err)
+      return
+    }
+    sortEntries(entries, listingSort)
+    writeListing(conn, req, entries)
+    return
+  }
+
+  if !extensionAllowed(name) {
+    sendError(conn, 403, "Forbidden")
+    return
+  }
+
+  readStart := time.Now()
+  content, err := a.open(name)
+  if errors.Is(err, fs.ErrNotExist) {
+    sendFSError(conn, err)
+    return
+  } else if err != nil {
+    sendError(conn, 500, "Internal Server Error")
+    return
+  }
+  if closer, ok := content.(io.Closer); ok {
+    defer closer.Close()
+  }
+
+  sendContent(conn, req, name, info, content, readStart, variant{})
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+  "archive/tar"
+  "archive/zip"
+  "bytes"
+  "io"
+  "strings"
+  "testing"
+  "time"
+)
+
+// useArchive serves the given files, stored with the given zip methods, from an in-memory zip
+// for the duration of the test.
+func useArchive(t *testing.T, files map[string]string, methods map[string]uint16) {
+  t.Helper()
+
+  var buf bytes.Buffer
+  zw := zip.NewWriter(&buf)
+  for name, content := range files {
+    w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: methods[name], Modified: time.Now()})
+    if err != nil {
+      t.Fatalf("Failed to add %s: %v", name, err)
+    }
+    w.Write([]byte(content))
+  }
+  if err := zw.Close(); err != nil {
+    t.Fatalf("Failed to write zip: %v", err)
+  }
+
+  reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+  if err != nil {
+    t.Fatalf("Failed to read zip: %v", err)
+  }
+
+  original := activeArchive
+  activeArchive = newZipArchive(reader)
+  t.Cleanup(func() { activeArchive = original })
+}
+
+func TestServeArchive(t *testing.T) {
+  useArchive(t, map[string]string{
+    "index.html":      "<h1>archived</h1>",
+    "docs/manual.txt": "0123456789",
+    "docs/stored.txt": "0123456789",
+  }, map[string]uint16{"index.html": zip.Deflate, "docs/manual.txt": zip.Deflate, "docs/stored.txt": zip.Store})
+
+  testCases := []struct {
+    name             string
+    request          string
+    expectedCode     string
+    expectedContents []string
+  }{
+    {
+      name:             "Compressed file",
+      request:          "GET /index.html HTTP/1.1\r\n\r\n",
+      expectedCode:     "HTTP/1.1 200 OK",
+      expectedContents: []string{"Content-Type: text/html; charset=utf-8\r\n", "Accept-Ranges: none\r\n", "\r\n\r\n<h1>archived</h1>"},
+    },
+    {
+      name:             "Range on a compressed entry is ignored",
+      request:          "GET /docs/manual.txt HTTP/1.1\r\nRange: bytes=2-4\r\n\r\n",
+      expectedCode:     "HTTP/1.1 200 OK",
+      expectedContents: []string{"Content-Length: 10\r\n", "\r\n\r\n0123456789"},
+    },
+    {
+      name:             "Range on a stored entry",
+      request:          "GET /docs/stored.txt HTTP/1.1\r\nRange: bytes=2-4\r\n\r\n",
+      expectedCode:     "HTTP/1.1 206 Partial Content",
+      expectedContents: []string{"Accept-Ranges: bytes\r\n", "Content-Range: bytes 2-4/10\r\n", "\r\n\r\n234"},
+    },
+    {
+      name:             "Listing",
+      request:          "GET /docs/ HTTP/1.1\r\n\r\n",
+      expectedCode:     "HTTP/1.1 200 OK",
+      expectedContents: []string{`href="/docs/manual.txt"`, `href="/docs/stored.txt"`},
+    },
+    {
+      name:             "Root listing",
+      request:          "GET / HTTP/1.1\r\nAccept: application/json\r\n\r\n",
+      expectedCode:     "HTTP/1.1 200 OK",
+      expectedContents: []string{`"name":"docs","path":"/docs","is_dir":true`, `"name":"index.html"`},
+    },
+    {
+      name:         "Missing entry",
+      request:      "GET /missing.txt HTTP/1.1\r\n\r\n",
+      expectedCode: "HTTP/1.1 404 Not Found",
+    },
+    {
+      name:         "Path traversal",
+      request:      "GET /../../etc/passwd HTTP/1.1\r\n\r\n",
+      expectedCode: "HTTP/1.1 404 Not Found",
+    },
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn(tc.request)
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.HasPrefix(response, tc.expectedCode) {
+        t.Fatalf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+      for _, expected := range tc.expectedContents {
+        if !strings.Contains(response, expected) {
+          t.Errorf("Expected response to contain %q, got: %s", expected, response)
+        }
+      }
+    })
+  }
+}
+
+func TestRepackTar(t *testing.T) {
+  var buf bytes.Buffer
+  tw := tar.NewWriter(&buf)
+  tw.WriteHeader(&tar.Header{Name: "site/", Typeflag: tar.TypeDir, Mode: 0755})
+  tw.WriteHeader(&tar.Header{Name: "site/page.html", Typeflag: tar.TypeReg, Mode: 0644, Size: 5})
+  tw.Write([]byte("hello"))
+  tw.WriteHeader(&tar.Header{Name: "site/link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"})
+  if err := tw.Close(); err != nil {
+    t.Fatalf("Failed to write tar: %v", err)
+  }
+
+  reader, err := repackTar(&buf)
+  if err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  a := newZipArchive(reader)
+
+  if _, ok := a.files["site/link"]; ok {
+    t.Errorf("Expected symlinks to be skipped")
+  }
+  content, err := a.open("site/page.html")
+  if err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  if _, ok := content.(io.Seeker); !ok {
+    t.Errorf("Expected repacked entries to support seeking")
+  }
+}
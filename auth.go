@@ -0,0 +1,181 @@
+package main
+
+import (
+  "bufio"
+  "crypto/md5"
+  "crypto/sha1"
+  "crypto/subtle"
+  "encoding/base64"
+  "fmt"
+  "log"
+  "net"
+  "os"
+  "path"
+  "path/filepath"
+  "strings"
+)
+
+// authFileName names the per-directory file of "user:hash" lines protecting the directory's subtree.
+const authFileName = ".htpasswd"
+
+// authFileFor returns the auth file nearest to urlPath: the one in the deepest directory on the
+// way up to the roots, or to the mount directory under a -mount, the first root winning within a
+// directory. It returns "" for open paths.
+func authFileFor(urlPath string) string {
+  dirs, urlPath := rootsFor(urlPath)
+  for dir := cleanURLPath(urlPath); ; dir = path.Dir(dir) {
+    for _, root := range dirs {
+      name := filepath.Join(resolvePath(root, dir), authFileName)
+      if info, err := os.Stat(name); err == nil && info.Mode().IsRegular() {
+        return name
+      }
+    }
+    if dir == "/" {
+      return ""
+    }
+  }
+}
+
+// authorized reports whether req may access urlPath. Paths under an auth file need Basic
+// credentials matching one of its entries; an unreadable auth file admits nobody.
+func authorized(req *request, urlPath string) bool {
+  name := authFileFor(urlPath)
+  if name == "" {
+    return true
+  }
+  return credentialsMatch(req, name)
+}
+
+// credentialsMatch reports whether the Basic credentials of req match an entry of the htpasswd
+// file name.
+func credentialsMatch(req *request, name string) bool {
+  scheme, encoded, _ := strings.Cut(req.header("Authorization"), " ")
+  if !strings.EqualFold(scheme, "Basic") {
+    return false
+  }
+  decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+  if err != nil {
+    return false
+  }
+  user, password, ok := strings.Cut(string(decoded), ":")
+  if !ok {
+    return false
+  }
+
+  entries, err := readAuthFile(name)
+  if err != nil {
+    log.Printf("Error: %v", err)
+    return false
+  }
+  hash, ok := entries[user]
+  return ok && checkPassword(hash, password)
+}
+
+// readAuthFile returns the hashes of the htpasswd file name by user, the first entry of a user
+// winning. A file holding a hash checkPassword cannot verify, such as a bcrypt one, is refused as
+// a whole, so a misconfigured user is reported instead of silently locked out.
+func readAuthFile(name string) (map[string]string, error) {
+  file, err := os.Open(name)
+  if err != nil {
+    return nil, err
+  }
+  defer file.Close()
+
+  entries := make(map[string]string)
+  scanner := bufio.NewScanner(file)
+  for line := 1; scanner.Scan(); line++ {
+    user, hash, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+    if !ok {
+      continue
+    }
+    if !strings.HasPrefix(hash, "$apr1$") && !strings.HasPrefix(hash, "{SHA}") {
+      return nil, fmt.Errorf("%s line %d: unsupported hash for user %q (expected $apr1$ or {SHA}, as written by htpasswd -m or -s)", name, line, user)
+    }
+    if _, seen := entries[user]; !seen {
+      entries[user] = hash
+    }
+  }
+  return entries, scanner.Err()
+}
+
+// checkPassword verifies password against an htpasswd hash. Apache MD5 ($apr1$) and SHA-1
+// ({SHA}) hashes are supported; other formats never match.
+func checkPassword(hash, password string) bool {
+  var computed string
+  switch {
+  case strings.HasPrefix(hash, "$apr1$"):
+    salt, _, _ := strings.Cut(strings.TrimPrefix(hash, "$apr1$"), "$")
+    computed = apr1(password, salt)
+  case strings.HasPrefix(hash, "{SHA}"):
+    sum := sha1.Sum([]byte(password))
+    computed = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+  default:
+    return false
+  }
+  return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1
+}
+
+// apr1 computes the Apache variant of the MD5-based crypt(3) hash.
+func apr1(password, salt string) string {
+  const magic = "$apr1$"
+  if len(salt) > 8 {
+    salt = salt[:8]
+  }
+  pw := []byte(password)
+
+  alternate := md5.Sum([]byte(password + salt + password))
+  ctx := md5.New()
+  ctx.Write([]byte(password + magic + salt))
+  for i := len(pw); i > 0; i -= 16 {
+    ctx.Write(alternate[:min(i, 16)])
+  }
+  for i := len(pw); i > 0; i >>= 1 {
+    if i&1 != 0 {
+      ctx.Write([]byte{0})
+    } else {
+      ctx.Write(pw[:1])
+    }
+  }
+  final := ctx.Sum(nil)
+
+  for i := 0; i < 1000; i++ {
+    round := md5.New()
+    if i&1 != 0 {
+      round.Write(pw)
+    } else {
+      round.Write(final)
+    }
+    if i%3 != 0 {
+      round.Write([]byte(salt))
+    }
+    if i%7 != 0 {
+      round.Write(pw)
+    }
+    if i&1 != 0 {
+      round.Write(final)
+    } else {
+      round.Write(pw)
+    }
+    final = round.Sum(nil)
+  }
+
+  const alphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+  var builder strings.Builder
+  builder.WriteString(magic + salt + "$")
+  encode := func(value uint, chars int) {
+    for ; chars > 0; chars-- {
+      builder.WriteByte(alphabet[value&0x3f])
+      value >>= 6
+    }
+  }
+  for _, group := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+    encode(uint(final[group[0]])<<16|uint(final[group[1]])<<8|uint(final[group[2]]), 4)
+  }
+  encode(uint(final[11]), 2)
+  return builder.String()
+}
+
+// sendUnauthorized asks the client for credentials.
+func sendUnauthorized(conn net.Conn) {
+  sendErrorWithHeader(conn, 401, "Unauthorized", responseHeader{{name: "WWW-Authenticate", value: `Basic realm="ghttpd", charset="UTF-8"`}})
+}
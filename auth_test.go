@@ -0,0 +1,107 @@
+package main
+
+import (
+  "encoding/base64"
+  "strings"
+  "testing"
+)
+
+func TestApr1(t *testing.T) {
+  // Generated with: openssl passwd -apr1 -salt saltsalt secret
+  expected := "$apr1$saltsalt$LrttParrLPdxvgutaSXWJ0"
+  if hash := apr1("secret", "saltsalt"); hash != expected {
+    t.Errorf("Expected %s, got %s", expected, hash)
+  }
+}
+
+func TestDirectoryAuth(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "private/.htpasswd":     "alice:$apr1$saltsalt$LrttParrLPdxvgutaSXWJ0\nbob:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n",
+    "private/secret.txt":    "secret",
+    "private/deep/more.txt": "more",
+    "public/open.txt":       "open",
+  })
+  useRoots(t, tempDir)
+
+  basic := func(credentials string) string {
+    return "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(credentials)) + "\r\n"
+  }
+
+  testCases := []struct {
+    name         string
+    path         string
+    header       string
+    expectedCode string
+  }{
+    {"Unprotected sibling", "/public/open.txt", "", "HTTP/1.1 200 OK"},
+    {"Root listing", "/", "", "HTTP/1.1 200 OK"},
+    {"No credentials", "/private/secret.txt", "", "HTTP/1.1 401 Unauthorized"},
+    {"Protected listing", "/private/", "", "HTTP/1.1 401 Unauthorized"},
+    {"Nested directory", "/private/deep/more.txt", "", "HTTP/1.1 401 Unauthorized"},
+    {"Wrong password", "/private/secret.txt", basic("alice:wrong"), "HTTP/1.1 401 Unauthorized"},
+    {"Unknown user", "/private/secret.txt", basic("carol:secret"), "HTTP/1.1 401 Unauthorized"},
+    {"Apache MD5 entry", "/private/secret.txt", basic("alice:secret"), "HTTP/1.1 200 OK"},
+    {"SHA-1 entry", "/private/deep/more.txt", basic("bob:secret"), "HTTP/1.1 200 OK"},
+    {"Auth file is hidden", "/private/.htpasswd", basic("alice:secret"), "HTTP/1.1 404 Not Found"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n" + tc.header + "\r\n")
+      handleConnection(conn)
+      response := conn.GetWrittenData()
+
+      if !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+      if strings.HasPrefix(tc.expectedCode, "HTTP/1.1 401") && !strings.Contains(response, "WWW-Authenticate: Basic") {
+        t.Errorf("Expected a Basic challenge, got: %s", response)
+      }
+    })
+  }
+
+  conn := newMockConn("GET /private/ HTTP/1.1\r\n" + basic("alice:secret") + "\r\n")
+  handleConnection(conn)
+  if response := conn.GetWrittenData(); strings.Contains(response, authFileName) {
+    t.Errorf("Expected the listing to hide %s, got: %s", authFileName, response)
+  }
+
+  useSitemap(t)
+  conn = newMockConn("GET /sitemap.xml HTTP/1.1\r\nHost: x\r\n\r\n")
+  handleConnection(conn)
+  response := conn.GetWrittenData()
+  if !strings.Contains(response, "http://x/public/open.txt") {
+    t.Errorf("Expected the sitemap to list open files, got: %s", response)
+  }
+  if strings.Contains(response, "/private/") {
+    t.Errorf("Expected the sitemap to leave out protected files, got: %s", response)
+  }
+}
+
+func TestUnsupportedAuthHash(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "team/.htpasswd": "alice:$apr1$saltsalt$LrttParrLPdxvgutaSXWJ0\ncarol:$2y$05$c2FsdHNhbHRzYWx0c2FsdOd0bYlx1bnCXYq0E5OmPG5ZRp7wFmsqi\n",
+    "team/plan.txt":  "plan",
+  })
+  useRoots(t, tempDir)
+  logs := captureLog(t)
+
+  auth := "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte("alice:secret")) + "\r\n"
+  conn := newMockConn("GET /team/plan.txt HTTP/1.1\r\n" + auth + "\r\n")
+  handleConnection(conn)
+
+  if response := conn.GetWrittenData(); !strings.HasPrefix(response, "HTTP/1.1 401 Unauthorized") {
+    t.Errorf("Expected 401 for a file with an unsupported hash, got: %s", response)
+  }
+  if !strings.Contains(logs.String(), `line 2: unsupported hash for user "carol"`) {
+    t.Errorf("Expected an error naming the unsupported entry, got: %s", logs)
+  }
+
+  for _, name := range []string{".htpasswd", ".HTPASSWD", ".HtPasswd"} {
+    if !matchesIgnore(nil, name) {
+      t.Errorf("Expected %s to be hidden", name)
+    }
+  }
+}
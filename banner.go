@@ -0,0 +1,86 @@
+package main
+
+import (
+  "fmt"
+  "strings"
+)
+
+// configSummary describes the effective configuration in one line for the startup log, with the
+// addresses the listeners are bound to; tlsAddr is empty without -tls-port. It reads the settings
+// after the config file and command line have been applied, so it shows what actually runs.
+func configSummary(addr, tlsAddr string) string {
+  source := "roots " + strings.Join(roots, ", ")
+  if activeArchive != nil {
+    source = "archive " + archivePath
+  }
+
+  listen := "http on " + addr
+  if tlsAddr != "" {
+    listen += ", https on " + tlsAddr
+  } else if tlsCert != "" || tlsKey != "" {
+    listen = "https on " + addr
+  }
+
+  summary := fmt.Sprintf("%s, %s, %d workers", listen, source, workers)
+  if configPath != "" {
+    summary += ", config " + configPath
+  }
+
+  features := enabledFeatures()
+  if len(features) == 0 {
+    return summary + ", no optional features"
+  }
+  return summary + ", features: " + strings.Join(features, " ")
+}
+
+// enabledFeatures lists the optional behaviours switched on, in a fixed order.
+func enabledFeatures() []string {
+  var features []string
+  add := func(enabled bool, name string) {
+    if enabled {
+      features = append(features, name)
+    }
+  }
+
+  add(http09, "http09")
+  add(maxQueue > 0, fmt.Sprintf("max-queue=%d", maxQueue))
+  add(maxConnsPerIP > 0, fmt.Sprintf("max-conns-per-ip=%d", maxConnsPerIP))
+  add(redirectHTTPS, "redirect-https")
+  add(keepAliveTimeout > 0, "keepalive="+keepAliveTimeout.String())
+  add(gzipEnabled, "gzip")
+  add(precompressed, "precompressed")
+  add(cacheSize > 0, "cache="+cacheSize.String())
+  add(uploadsEnabled, "upload")
+  add(webdavEnabled, "webdav")
+  add(len(mounts) > 0, "mounts="+mountPrefixes())
+  add(checksumsEnabled, "checksums")
+  add(stripPrefix != "", "strip-prefix="+stripPrefix)
+  add(baseHref != "", "base-href="+baseHref)
+  add(len(redirects) > 0, fmt.Sprintf("redirects=%d", len(redirects)))
+  add(caseInsensitive, "case-insensitive")
+  add(len(tryExtensions) > 0, "try-extensions="+tryExtensions.String())
+  add(len(extensionAliases) > 0, fmt.Sprintf("ext-aliases=%d", len(extensionAliases)))
+  add(len(allowedExtensions) > 0, "allowed-ext="+allowedExtensions.String())
+  add(len(allowPatterns) > 0 || len(denyPatterns) > 0 || len(agentRules) > 0, "access-rules")
+  add(maintenanceFile != "", "maintenance-file")
+  add(byteQuota > 0, "quota="+byteQuota.String())
+  add(sendfileHeader != "", "sendfile="+sendfileHeader)
+  add(sitemapEnabled, "sitemap")
+  add(metricsEnabled, "metrics")
+  add(speedtestMax > 0, "speedtest-max="+speedtestMax.String())
+  add(healthChecks, "health-checks")
+  add(configEndpointAuth != "", "config-endpoint")
+  add(statsPaths > 0, "stats")
+  add(secureHeaders, "secure-headers")
+  add(etagMode != "weak", "etag="+etagMode)
+  return features
+}
+
+// mountPrefixes lists the URL prefixes of the -mount directories.
+func mountPrefixes() string {
+  prefixes := make([]string, len(mounts))
+  for i, m := range mounts {
+    prefixes[i] = m.prefix
+  }
+  return strings.Join(prefixes, ",")
+}
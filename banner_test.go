@@ -0,0 +1,75 @@
+package main
+
+import (
+  "flag"
+  "strings"
+  "testing"
+  "time"
+)
+
+func TestConfigSummary(t *testing.T) {
+  originalRoots, originalWorkers, originalConfig := roots, workers, configPath
+  originalGzip, originalKeepAlive, originalUploads := gzipEnabled, keepAliveTimeout, uploadsEnabled
+  originalWebdav, originalMounts, originalQuota := webdavEnabled, mounts, byteQuota
+  originalQueue, originalConnsPerIP, originalRedirects := maxQueue, maxConnsPerIP, redirects
+  originalAliases, originalBaseHref, originalHTTP09 := extensionAliases, baseHref, http09
+  originalCase, originalAllowed, originalEndpoint := caseInsensitive, allowedExtensions, configEndpointAuth
+  defer func() {
+    roots, workers, configPath = originalRoots, originalWorkers, originalConfig
+    gzipEnabled, keepAliveTimeout, uploadsEnabled = originalGzip, originalKeepAlive, originalUploads
+    webdavEnabled, mounts, byteQuota = originalWebdav, originalMounts, originalQuota
+    maxQueue, maxConnsPerIP, redirects = originalQueue, originalConnsPerIP, originalRedirects
+    extensionAliases, baseHref, http09 = originalAliases, originalBaseHref, originalHTTP09
+    caseInsensitive, allowedExtensions, configEndpointAuth = originalCase, originalAllowed, originalEndpoint
+  }()
+
+  roots, workers, configPath = rootList{"./public"}, 4, ""
+  gzipEnabled, keepAliveTimeout, uploadsEnabled = false, 0, false
+  webdavEnabled, mounts, byteQuota = false, nil, 0
+  maxQueue, maxConnsPerIP, redirects = 0, 0, nil
+  extensionAliases, baseHref, http09 = aliasMap{}, "", false
+  caseInsensitive, allowedExtensions, configEndpointAuth = false, nil, ""
+
+  expected := "http on [::]:8080, roots ./public, 4 workers, no optional features"
+  if summary := configSummary("[::]:8080", ""); summary != expected {
+    t.Errorf("Expected %q, got %q", expected, summary)
+  }
+
+  roots, workers, configPath = rootList{"./theme", "./base"}, 2, "ghttpd.json"
+  gzipEnabled, keepAliveTimeout, uploadsEnabled = true, 2*time.Second, true
+  webdavEnabled, byteQuota, maxQueue, maxConnsPerIP = true, 10<<30, 16, 8
+  baseHref, http09, caseInsensitive, configEndpointAuth = "auto", true, true, "admin.htpasswd"
+  for _, setting := range []struct {
+    value flag.Value
+    text  string
+  }{
+    {&mounts, "/downloads=" + t.TempDir()},
+    {&redirects, "/old=/new"},
+    {&extensionAliases, ".txt=.json:text/plain"},
+    {&allowedExtensions, ".css,.js"},
+  } {
+    if err := setting.value.Set(setting.text); err != nil {
+      t.Fatalf("Unexpected error: %v", err)
+    }
+  }
+
+  summary := configSummary("127.0.0.1:9000", "127.0.0.1:8443")
+  for _, part := range []string{
+    "http on 127.0.0.1:9000, https on 127.0.0.1:8443",
+    "roots ./theme, ./base",
+    "2 workers",
+    "config ghttpd.json",
+    "features: http09 max-queue=16 max-conns-per-ip=8 keepalive=2s gzip",
+    " upload webdav mounts=/downloads ",
+    " base-href=auto redirects=1 case-insensitive ext-aliases=1 allowed-ext=.css,.js ",
+    " quota=10737418240 ",
+    " config-endpoint",
+  } {
+    if !strings.Contains(summary, part) {
+      t.Errorf("Expected %q in the summary, got %q", part, summary)
+    }
+  }
+  if strings.Contains(summary, "no optional features") {
+    t.Errorf("Expected enabled features to be listed, got %q", summary)
+  }
+}
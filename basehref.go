@@ -0,0 +1,79 @@
+package main
+
+import (
+  "bytes"
+  "fmt"
+  "html"
+  "io"
+  "io/fs"
+  "regexp"
+  "strings"
+)
+
+// baseHref sets the <base href> of served HTML pages: "auto" derives it from the -strip-prefix
+// and -mount the page is served under, so an application built for "/" works below a prefix;
+// any other value is used as is. Empty leaves pages untouched.
+var baseHref string
+
+// maxBaseHrefFile bounds the pages rewritten; larger HTML files are sent unchanged.
+const maxBaseHrefFile = 1 << 20
+
+var (
+  baseTagPattern = regexp.MustCompile(`(?i)<base\b[^>]*>`)
+  headTagPattern = regexp.MustCompile(`(?i)<head\b[^>]*>`)
+)
+
+// validateBaseHref checks the -base-href value.
+func validateBaseHref(value string) error {
+  if value == "" || value == "auto" || strings.HasPrefix(value, "/") || strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") {
+    return nil
+  }
+  return fmt.Errorf("invalid -base-href %q: expected auto, a path or an http(s) URL", value)
+}
+
+// baseHrefFor returns the base URL for a page served at req.path.
+func baseHrefFor(req *request) string {
+  if baseHref != "auto" {
+    return baseHref
+  }
+  base := req.prefix
+  if m, _ := mounts.match(req.path); m != nil {
+    base += m.prefix
+  }
+  return strings.TrimSuffix(base, "/") + "/"
+}
+
+// sizedInfo reports a size other than the file's, for content rewritten before it is sent.
+type sizedInfo struct {
+  fs.FileInfo
+  size int64
+}
+
+func (i sizedInfo) Size() int64 {
+  return i.size
+}
+
+// rewriteBaseHref returns content with its <base> tag replaced, or one added at the start of
+// <head>, pointing at the -base-href for req. Pages without a <head>, too large to rewrite or not
+// HTML are returned unchanged, as are encoded variants.
+func rewriteBaseHref(req *request, contentType string, info fs.FileInfo, content io.ReadSeeker, v variant) (fs.FileInfo, io.ReadSeeker, error) {
+  if baseHref == "" || v.encoding != "" || !strings.HasPrefix(contentType, "text/html") || info.Size() > maxBaseHrefFile {
+    return info, content, nil
+  }
+
+  page, err := io.ReadAll(content)
+  if err != nil {
+    return nil, nil, err
+  }
+
+  tag := []byte(`<base href="` + html.EscapeString(baseHrefFor(req)) + `">`)
+  var rewritten []byte
+  if loc := baseTagPattern.FindIndex(page); loc != nil {
+    rewritten = bytes.Join([][]byte{page[:loc[0]], tag, page[loc[1]:]}, nil)
+  } else if loc := headTagPattern.FindIndex(page); loc != nil {
+    rewritten = bytes.Join([][]byte{page[:loc[1]], tag, page[loc[1]:]}, nil)
+  } else {
+    rewritten = page
+  }
+  return sizedInfo{FileInfo: info, size: int64(len(rewritten))}, bytes.NewReader(rewritten), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+  "strconv"
+  "strings"
+  "testing"
+)
+
+func TestBaseHref(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "index.html":    "<!doctype html><html><head><title>App</title></head><body></body></html>",
+    "based.html":    `<html><HEAD lang="en"><base href="/" target="_self"></HEAD></html>`,
+    "fragment.html": "<p>no head</p>",
+    "app.js":        "<head>",
+  })
+  useRoots(t, tempDir)
+
+  originalPrefix, originalBase := stripPrefix, baseHref
+  defer func() { stripPrefix, baseHref = originalPrefix, originalBase }()
+  stripPrefix = "/app"
+
+  testCases := []struct {
+    name         string
+    base         string
+    path         string
+    expectedBody string
+  }{
+    {"Injected from the prefix", "auto", "/app/index.html", `<!doctype html><html><head><base href="/app/"><title>App</title></head><body></body></html>`},
+    {"Existing tag rewritten", "auto", "/app/based.html", `<html><HEAD lang="en"><base href="/app/"></HEAD></html>`},
+    {"Fixed value", "https://cdn.example.com/app/", "/app/index.html", `<head><base href="https://cdn.example.com/app/"><title>`},
+    {"No head", "auto", "/app/fragment.html", "<p>no head</p>"},
+    {"Not HTML", "auto", "/app/app.js", "<head>"},
+    {"Disabled", "", "/app/index.html", "<html><head><title>App</title>"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      baseHref = tc.base
+
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      headers, body, _ := strings.Cut(response, "\r\n\r\n")
+      if !strings.HasPrefix(headers, "HTTP/1.1 200 OK") {
+        t.Fatalf("Expected 200, got: %s", response)
+      }
+      if !strings.Contains(body, tc.expectedBody) {
+        t.Errorf("Expected %q in body, got: %s", tc.expectedBody, body)
+      }
+      if !strings.Contains(headers+"\r\n", "Content-Length: "+strconv.Itoa(len(body))+"\r\n") {
+        t.Errorf("Expected Content-Length to match the rewritten body of %d bytes, got: %s", len(body), headers)
+      }
+    })
+  }
+
+  // Pages in a mount are based at the mount, below the stripped prefix.
+  originalMounts := mounts
+  defer func() { mounts = originalMounts }()
+  mounts = nil
+  if err := mounts.Set("/spa=" + tempDir); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  baseHref = "auto"
+  conn := newMockConn("GET /app/spa/index.html HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+  if response := conn.GetWrittenData(); !strings.Contains(response, `<head><base href="/app/spa/">`) {
+    t.Errorf("Expected the mount in the base href, got: %s", response)
+  }
+
+  for _, invalid := range []string{"app/", "ftp://host/"} {
+    if err := validateBaseHref(invalid); err == nil {
+      t.Errorf("Expected error for -base-href %q", invalid)
+    }
+  }
+}
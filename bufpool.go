@@ -0,0 +1,57 @@
+package main
+
+import (
+  "bufio"
+  "io"
+  "sync"
+)
+
+// bufferSize is the size of the pooled buffers bodies are copied through.
+var bufferSize = byteSize(32 << 10)
+
+// readBufferSize is the size of the pooled connection readers. Request and header lines longer
+// than it are still read, in several pieces, up to -max-header-size; raising it lets large
+// headers such as big cookies be read with fewer copies.
+var readBufferSize = byteSize(4 << 10)
+
+// Connection readers and copy buffers are pooled so a busy server does not allocate them anew
+// for every connection and response.
+var (
+  readerPool = sync.Pool{New: func() any { return bufio.NewReaderSize(nil, int(readBufferSize)) }}
+  copyPool   = sync.Pool{New: func() any {
+    buf := make([]byte, bufferSize)
+    return &buf
+  }}
+)
+
+// getReader returns a pooled reader reading from r.
+func getReader(r io.Reader) *bufio.Reader {
+  reader := readerPool.Get().(*bufio.Reader)
+  reader.Reset(r)
+  return reader
+}
+
+// putReader returns reader to the pool. Reset drops any unread bytes along with the connection.
+func putReader(reader *bufio.Reader) {
+  reader.Reset(nil)
+  readerPool.Put(reader)
+}
+
+// copyN copies n bytes from src to dst like io.CopyN, through a pooled buffer. The buffer is
+// cleared before it goes back to the pool, so no content outlives the response it belongs to.
+func copyN(dst io.Writer, src io.Reader, n int64) (int64, error) {
+  buf := copyPool.Get().(*[]byte)
+  defer func() {
+    clear(*buf)
+    copyPool.Put(buf)
+  }()
+
+  written, err := io.CopyBuffer(dst, io.LimitReader(src, n), *buf)
+  if written == n {
+    return n, nil
+  }
+  if err == nil {
+    err = io.EOF
+  }
+  return written, err
+}
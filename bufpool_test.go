@@ -0,0 +1,73 @@
+package main
+
+import (
+  "bytes"
+  "io"
+  "log"
+  "strings"
+  "testing"
+)
+
+func TestCopyN(t *testing.T) {
+  var dst bytes.Buffer
+  if n, err := copyN(&dst, strings.NewReader("hello world"), 5); n != 5 || err != nil || dst.String() != "hello" {
+    t.Errorf("Expected 5 bytes \"hello\", got %d %q: %v", n, dst.String(), err)
+  }
+
+  dst.Reset()
+  if n, err := copyN(&dst, strings.NewReader("short"), 10); n != 5 || err != io.EOF {
+    t.Errorf("Expected io.EOF after 5 bytes, got %d: %v", n, err)
+  }
+
+  // A pooled buffer comes back cleared.
+  buf := copyPool.Get().(*[]byte)
+  defer copyPool.Put(buf)
+  if bytes.Contains(*buf, []byte("short")) {
+    t.Errorf("Expected pooled buffers to be cleared")
+  }
+}
+
+func TestPooledReaderReset(t *testing.T) {
+  reader := getReader(strings.NewReader("first connection, unread tail"))
+  reader.ReadString(',')
+  putReader(reader)
+
+  reader = getReader(strings.NewReader("second"))
+  defer putReader(reader)
+  if data, _ := io.ReadAll(reader); string(data) != "second" {
+    t.Errorf("Expected only the new connection's data, got %q", data)
+  }
+}
+
+func BenchmarkCopyBody(b *testing.B) {
+  content := bytes.Repeat([]byte("x"), 256<<10)
+
+  b.Run("io.CopyN", func(b *testing.B) {
+    b.ReportAllocs()
+    for b.Loop() {
+      io.CopyN(struct{ io.Writer }{io.Discard}, struct{ io.Reader }{bytes.NewReader(content)}, int64(len(content)))
+    }
+  })
+
+  b.Run("pooled", func(b *testing.B) {
+    b.ReportAllocs()
+    for b.Loop() {
+      copyN(struct{ io.Writer }{io.Discard}, struct{ io.Reader }{bytes.NewReader(content)}, int64(len(content)))
+    }
+  })
+}
+
+func BenchmarkHandleConnection(b *testing.B) {
+  tempDir := b.TempDir()
+  writeTestFiles(b, tempDir, map[string]string{"page.html": strings.Repeat("x", 64<<10)})
+  useRoots(b, tempDir)
+
+  output := log.Writer()
+  log.SetOutput(io.Discard)
+  defer log.SetOutput(output)
+
+  b.ReportAllocs()
+  for b.Loop() {
+    handleConnection(newMockConn("GET /page.html HTTP/1.1\r\n\r\n"))
+  }
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+  "container/list"
+  "os"
+  "sync"
+  "time"
+)
+
+// fileCache keeps the contents of small files in memory, evicting the least recently used
+// entries once the total size exceeds its capacity. Entries are validated against the file's
+// size and modification time, so changed files are re-read from disk.
+// A nil *fileCache is valid and caches nothing.
+type fileCache struct {
+  capacity int64
+  maxFile  int64
+
+  mu      sync.Mutex
+  used    int64
+  order   *list.List
+  entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+  path    string
+  size    int64
+  modTime time.Time
+  data    []byte
+}
+
+var contentCache *fileCache
+
+func newFileCache(capacity, maxFile int64) *fileCache {
+  return &fileCache{
+    capacity: capacity,
+    maxFile:  maxFile,
+    order:    list.New(),
+    entries:  make(map[string]*list.Element),
+  }
+}
+
+// fits reports whether a file of the given size may be cached.
+func (c *fileCache) fits(size int64) bool {
+  return c != nil && size <= c.maxFile && size <= c.capacity
+}
+
+// get returns the cached contents of path if they are still current for info.
+func (c *fileCache) get(path string, info os.FileInfo) ([]byte, bool) {
+  if c == nil {
+    return nil, false
+  }
+
+  c.mu.Lock()
+  defer c.mu.Unlock()
+
+  element, ok := c.entries[path]
+  if !ok {
+    return nil, false
+  }
+
+  entry := element.Value.(*cacheEntry)
+  if entry.size != info.Size() || !entry.modTime.Equal(info.ModTime()) {
+    c.remove(element)
+    return nil, false
+  }
+
+  c.order.MoveToFront(element)
+  return entry.data, true
+}
+
+func (c *fileCache) put(path string, info os.FileInfo, data []byte) {
+  if !c.fits(int64(len(data))) {
+    return
+  }
+
+  c.mu.Lock()
+  defer c.mu.Unlock()
+
+  if element, ok := c.entries[path]; ok {
+    c.remove(element)
+  }
+
+  c.entries[path] = c.order.PushFront(&cacheEntry{path: path, size: info.Size(), modTime: info.ModTime(), data: data})
+  c.used += int64(len(data))
+
+  for c.used > c.capacity {
+    c.remove(c.order.Back())
+  }
+}
+
+func (c *fileCache) remove(element *list.Element) {
+  entry := c.order.Remove(element).(*cacheEntry)
+  delete(c.entries, entry.path)
+  c.used -= int64(len(entry.data))
+}
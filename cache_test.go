@@ -0,0 +1,104 @@
+package main
+
+import (
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+  "time"
+)
+
+// useContentCache installs a content cache for the duration of the test.
+func useContentCache(t *testing.T, cache *fileCache) {
+  t.Helper()
+  original := contentCache
+  contentCache = cache
+  t.Cleanup(func() { contentCache = original })
+}
+
+func TestRangeOnCachedFile(t *testing.T) {
+  path := filepath.Join(t.TempDir(), "video.bin")
+  if err := os.WriteFile(path, []byte("abcdefghij"), 0644); err != nil {
+    t.Fatalf("Failed to create test file: %v", err)
+  }
+  useContentCache(t, newFileCache(1<<20, 1<<20))
+
+  // The first request populates the cache.
+  conn := newMockConn("")
+  sendFile(conn, &request{}, path)
+  if !strings.HasSuffix(conn.GetWrittenData(), "abcdefghij") {
+    t.Fatalf("Unexpected response: %s", conn.GetWrittenData())
+  }
+
+  // Rewrite the file keeping size and modification time, so only the cache still has the old bytes.
+  info, _ := os.Stat(path)
+  if err := os.WriteFile(path, []byte("ABCDEFGHIJ"), 0644); err != nil {
+    t.Fatalf("Failed to rewrite test file: %v", err)
+  }
+  if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+    t.Fatalf("Failed to reset modification time: %v", err)
+  }
+
+  conn = newMockConn("")
+  sendFile(conn, &request{headers: map[string]string{"range": "bytes=3-6"}}, path)
+  response := conn.GetWrittenData()
+
+  if !strings.HasPrefix(response, "HTTP/1.1 206 Partial Content") {
+    t.Errorf("Expected 206, got: %s", response)
+  }
+  if !strings.Contains(response, "Content-Range: bytes 3-6/10") {
+    t.Errorf("Expected Content-Range for 3-6, got: %s", response)
+  }
+  if !strings.HasSuffix(response, "\r\n\r\ndefg") {
+    t.Errorf("Expected the cached slice defg, got: %s", response)
+  }
+}
+
+func TestFileCacheInvalidation(t *testing.T) {
+  path := filepath.Join(t.TempDir(), "page.html")
+  if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+    t.Fatalf("Failed to create test file: %v", err)
+  }
+  info, _ := os.Stat(path)
+
+  cache := newFileCache(1<<20, 1<<20)
+  cache.put(path, info, []byte("old"))
+
+  if err := os.WriteFile(path, []byte("newer"), 0644); err != nil {
+    t.Fatalf("Failed to rewrite test file: %v", err)
+  }
+  os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+  info, _ = os.Stat(path)
+
+  if _, ok := cache.get(path, info); ok {
+    t.Errorf("Expected a stale entry to be invalidated")
+  }
+}
+
+func TestFileCacheEviction(t *testing.T) {
+  dir := t.TempDir()
+  cache := newFileCache(10, 10)
+
+  var infos []os.FileInfo
+  for i, name := range []string{"a", "b", "c"} {
+    path := filepath.Join(dir, name)
+    os.WriteFile(path, []byte("1234"), 0644)
+    info, _ := os.Stat(path)
+    infos = append(infos, info)
+    cache.put(path, info, []byte("1234"))
+    if i == 1 {
+      // Touch "a" so "b" becomes the least recently used entry.
+      cache.get(filepath.Join(dir, "a"), infos[0])
+    }
+  }
+
+  if _, ok := cache.get(filepath.Join(dir, "b"), infos[1]); ok {
+    t.Errorf("Expected the least recently used entry to be evicted")
+  }
+  if _, ok := cache.get(filepath.Join(dir, "a"), infos[0]); !ok {
+    t.Errorf("Expected recently used entry to stay cached")
+  }
+  if cache.fits(11) {
+    t.Errorf("Expected files above the per-file limit not to fit")
+  }
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+  "log"
+  "os"
+  "path"
+  "strings"
+  "sync"
+)
+
+// caseInsensitive lets request paths match files whose names differ only in case, for sites moved
+// from case-insensitive file systems. Only misses pay for the directory scans.
+var caseInsensitive bool
+
+// caseMatches caches the on-disk spelling found for request paths, keyed by their lower-case form.
+var caseMatches = struct {
+  sync.Mutex
+  paths map[string]string
+}{paths: map[string]string{}}
+
+// matchPathCase returns the URL path spelled as on disk for urlPath, matching each segment
+// case-insensitively in the document roots, or below the prefix of the mount holding urlPath, and
+// whether one was found.
+func matchPathCase(urlPath string) (string, bool) {
+  cleaned := cleanURLPath(urlPath)
+  key := strings.ToLower(cleaned)
+
+  caseMatches.Lock()
+  cached, ok := caseMatches.paths[key]
+  caseMatches.Unlock()
+  if ok && existsInRoots(cached) {
+    return withTrailingSlash(cached, urlPath), true
+  }
+
+  dirs, rest := rootsFor(cleaned)
+  prefix := strings.TrimSuffix(cleaned, cleanURLPath(rest))
+  for _, root := range dirs {
+    if matched, ok := matchSegments(root, strings.ToLower(rest)); ok {
+      matched = path.Join(prefix, matched)
+      log.Printf("Warning: %s served as %s by case-insensitive match", urlPath, matched)
+      caseMatches.Lock()
+      caseMatches.paths[key] = matched
+      caseMatches.Unlock()
+      return withTrailingSlash(matched, urlPath), true
+    }
+  }
+  return "", false
+}
+
+// existsInRoots reports whether some document root, or the mount holding urlPath, still has it,
+// so stale cache entries left by renamed or deleted files are scanned for again.
+func existsInRoots(urlPath string) bool {
+  dirs, rest := rootsFor(urlPath)
+  for _, root := range dirs {
+    if _, err := os.Stat(resolvePath(root, rest)); err == nil {
+      return true
+    }
+  }
+  return false
+}
+
+// withTrailingSlash keeps the trailing slash of the original request on the matched path.
+func withTrailingSlash(matched, urlPath string) string {
+  if strings.HasSuffix(urlPath, "/") && matched != "/" {
+    return matched + "/"
+  }
+  return matched
+}
+
+// matchSegments walks the lower-case URL path down from root, picking for each segment the
+// directory entry whose name equals it case-insensitively.
+func matchSegments(root, lowerPath string) (string, bool) {
+  matched := "/"
+  for _, segment := range strings.Split(strings.Trim(lowerPath, "/"), "/") {
+    if segment == "" {
+      continue
+    }
+    entries, err := os.ReadDir(resolvePath(root, matched))
+    if err != nil {
+      return "", false
+    }
+    found := false
+    for _, entry := range entries {
+      if strings.EqualFold(entry.Name(), segment) {
+        matched, found = path.Join(matched, entry.Name()), true
+        break
+      }
+    }
+    if !found {
+      return "", false
+    }
+  }
+  return matched, true
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+  "encoding/base64"
+  "strings"
+  "testing"
+)
+
+func TestCaseInsensitivePaths(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "file.txt":             "lower case",
+    "Docs/Guide.html":      "guide",
+    "Docs/images/Logo.png": "logo",
+  })
+  useRoots(t, tempDir)
+  logs := captureLog(t)
+
+  original := caseInsensitive
+  defer func() { caseInsensitive = original }()
+
+  testCases := []struct {
+    name         string
+    enabled      bool
+    path         string
+    expectedCode string
+    expectedBody string
+  }{
+    {"Disabled", false, "/FILE.TXT", "HTTP/1.1 404 Not Found", "Not Found"},
+    {"File", true, "/FILE.TXT", "HTTP/1.1 200 OK", "lower case"},
+    {"Cached match", true, "/File.Txt", "HTTP/1.1 200 OK", "lower case"},
+    {"Nested path", true, "/docs/guide.HTML", "HTTP/1.1 200 OK", "guide"},
+    {"Directory", true, "/DOCS/", "HTTP/1.1 200 OK", `<a href="/DOCS/Guide.html">Guide.html</a>`},
+    {"Exact match", true, "/Docs/images/Logo.png", "HTTP/1.1 200 OK", "logo"},
+    {"No match", true, "/missing.txt", "HTTP/1.1 404 Not Found", "Not Found"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      caseInsensitive = tc.enabled
+
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+      if !strings.Contains(response, tc.expectedBody) {
+        t.Errorf("Expected body %q, got: %s", tc.expectedBody, response)
+      }
+    })
+  }
+
+  if !strings.Contains(logs.String(), "Warning: /FILE.TXT served as /file.txt by case-insensitive match") {
+    t.Errorf("Expected a warning for the case-insensitive match, got: %s", logs)
+  }
+}
+
+func TestCaseInsensitiveAccessRules(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "private/.htpasswd":  "alice:$apr1$saltsalt$LrttParrLPdxvgutaSXWJ0\n",
+    "private/secret.txt": "secret",
+    "denied/s.txt":       "denied",
+    "public/open.txt":    "open",
+  })
+  useRoots(t, tempDir)
+  useAccessRules(t, nil, []string{"^/denied/"})
+  captureLog(t)
+
+  original := caseInsensitive
+  caseInsensitive = true
+  defer func() { caseInsensitive = original }()
+
+  authHeader := "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte("alice:secret")) + "\r\n"
+
+  testCases := []struct {
+    name         string
+    path         string
+    header       string
+    expectedCode string
+  }{
+    {"Protected file", "/PRIVATE/secret.txt", "", "HTTP/1.1 401 Unauthorized"},
+    {"Protected listing", "/Private/", "", "HTTP/1.1 401 Unauthorized"},
+    {"Protected with credentials", "/PRIVATE/secret.txt", authHeader, "HTTP/1.1 200 OK"},
+    {"Denied path", "/DENIED/s.txt", "", "HTTP/1.1 403 Forbidden"},
+    {"Unprotected path", "/PUBLIC/open.txt", "", "HTTP/1.1 200 OK"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n" + tc.header + "\r\n")
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+    })
+  }
+}
+
+func TestCaseInsensitiveMounts(t *testing.T) {
+  siteDir, filesDir := t.TempDir(), t.TempDir()
+  writeTestFiles(t, siteDir, map[string]string{"files/report.pdf": "from the roots"})
+  writeTestFiles(t, filesDir, map[string]string{"Reports/Q1.PDF": "from the mount"})
+  useRoots(t, siteDir)
+  captureLog(t)
+
+  originalCase, originalMounts := caseInsensitive, mounts
+  defer func() { caseInsensitive, mounts = originalCase, originalMounts }()
+  caseInsensitive, mounts = true, nil
+  if err := mounts.Set("/files=" + filesDir); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+
+  testCases := []struct {
+    name         string
+    path         string
+    expectedCode string
+    expectedBody string
+  }{
+    {"Mount file", "/files/reports/q1.pdf", "HTTP/1.1 200 OK", "from the mount"},
+    {"Cached mount match", "/files/REPORTS/q1.pdf", "HTTP/1.1 200 OK", "from the mount"},
+    {"Mount directory", "/files/REPORTS/", "HTTP/1.1 200 OK", `<a href="/files/REPORTS/Q1.PDF">Q1.PDF</a>`},
+    {"Roots not consulted", "/files/REPORT.pdf", "HTTP/1.1 404 Not Found", "Not Found"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+      if !strings.Contains(response, tc.expectedBody) {
+        t.Errorf("Expected body %q, got: %s", tc.expectedBody, response)
+      }
+    })
+  }
+}
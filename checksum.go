@@ -0,0 +1,103 @@
+package main
+
+import (
+  "crypto/md5"
+  "crypto/sha256"
+  "encoding/hex"
+  "hash"
+  "io"
+  "net"
+  "os"
+  "strconv"
+  "sync"
+  "time"
+)
+
+// checksumsEnabled answers ?checksum=sha256 (or md5) with the file's digest instead of its content,
+// so clients can verify a download without fetching it twice.
+var checksumsEnabled bool
+
+// checksumAlgorithms are the digests ?checksum may ask for; an empty value means sha256.
+var checksumAlgorithms = map[string]func() hash.Hash{
+  "sha256": sha256.New,
+  "md5":    md5.New,
+}
+
+type checksumEntry struct {
+  modTime time.Time
+  size    int64
+  sum     string
+}
+
+// checksums caches digests by algorithm and path. Entries are used only while the file's
+// modification time and size are unchanged.
+var checksums = struct {
+  sync.Mutex
+  entries map[string]checksumEntry
+}{entries: map[string]checksumEntry{}}
+
+// wantsChecksum reports whether req asks for a checksum rather than the file.
+func wantsChecksum(req *request) bool {
+  return checksumsEnabled && req.query.Has("checksum")
+}
+
+// sendChecksum answers with the hex digest of the file at path, as plain text.
+func sendChecksum(conn net.Conn, req *request, path string) {
+  algorithm := req.query.Get("checksum")
+  if algorithm == "" {
+    algorithm = "sha256"
+  }
+  newHash, ok := checksumAlgorithms[algorithm]
+  if !ok {
+    sendError(conn, 400, "Bad Request")
+    return
+  }
+
+  sum, err := fileChecksum(path, algorithm, newHash)
+  if err != nil {
+    sendFSError(conn, err)
+    return
+  }
+
+  body := sum + "\n"
+  header := responseHeader{}
+  header.set("Content-Type", "text/plain; charset=utf-8")
+  header.set("Content-Length", strconv.Itoa(len(body)))
+  writeResponseHeader(conn, 200, "OK", header)
+  if req.method != "HEAD" {
+    conn.Write([]byte(body))
+  }
+}
+
+// fileChecksum returns the digest of the file at path, from the cache when the file is unchanged.
+func fileChecksum(path, algorithm string, newHash func() hash.Hash) (string, error) {
+  file, err := os.Open(path)
+  if err != nil {
+    return "", err
+  }
+  defer file.Close()
+
+  info, err := file.Stat()
+  if err != nil {
+    return "", err
+  }
+
+  key := algorithm + ":" + path
+  checksums.Lock()
+  entry, ok := checksums.entries[key]
+  checksums.Unlock()
+  if ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+    return entry.sum, nil
+  }
+
+  h := newHash()
+  if _, err := io.Copy(h, file); err != nil {
+    return "", err
+  }
+  sum := hex.EncodeToString(h.Sum(nil))
+
+  checksums.Lock()
+  checksums.entries[key] = checksumEntry{modTime: info.ModTime(), size: info.Size(), sum: sum}
+  checksums.Unlock()
+  return sum, nil
+}
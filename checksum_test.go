@@ -0,0 +1,78 @@
+package main
+
+import (
+  "crypto/md5"
+  "crypto/sha256"
+  "encoding/hex"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+  "time"
+)
+
+func TestChecksums(t *testing.T) {
+  tempDir := t.TempDir()
+  content := strings.Repeat("release data\n", 100)
+  writeTestFiles(t, tempDir, map[string]string{"release.tar": content})
+  useRoots(t, tempDir)
+
+  checksumsEnabled = true
+  defer func() { checksumsEnabled = false }()
+
+  sha := sha256.Sum256([]byte(content))
+  md := md5.Sum([]byte(content))
+
+  testCases := []struct {
+    name         string
+    path         string
+    expectedCode string
+    expectedBody string
+  }{
+    {"SHA-256", "/release.tar?checksum=sha256", "HTTP/1.1 200 OK", hex.EncodeToString(sha[:]) + "\n"},
+    {"Default algorithm", "/release.tar?checksum", "HTTP/1.1 200 OK", hex.EncodeToString(sha[:]) + "\n"},
+    {"MD5", "/release.tar?checksum=md5", "HTTP/1.1 200 OK", hex.EncodeToString(md[:]) + "\n"},
+    {"Unknown algorithm", "/release.tar?checksum=crc32", "HTTP/1.1 400 Bad Request", ""},
+    {"Missing file", "/missing.tar?checksum=sha256", "HTTP/1.1 404 Not Found", ""},
+    {"Without the parameter", "/release.tar", "HTTP/1.1 200 OK", content},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+      if tc.expectedBody != "" && !strings.HasSuffix(response, "\r\n\r\n"+tc.expectedBody) {
+        t.Errorf("Expected body %q, got: %s", tc.expectedBody, response)
+      }
+    })
+  }
+
+  // A changed file is hashed again rather than answered from the cache.
+  updated := "new release\n"
+  path := filepath.Join(tempDir, "release.tar")
+  if err := os.WriteFile(path, []byte(updated), 0644); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  later := time.Now().Add(time.Minute)
+  if err := os.Chtimes(path, later, later); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  conn := newMockConn("GET /release.tar?checksum=sha256 HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+  sha = sha256.Sum256([]byte(updated))
+  if response := conn.GetWrittenData(); !strings.HasSuffix(response, hex.EncodeToString(sha[:])+"\n") {
+    t.Errorf("Expected the checksum of the updated file, got: %s", response)
+  }
+
+  checksumsEnabled = false
+  conn = newMockConn("GET /release.tar?checksum=sha256 HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+  if response := conn.GetWrittenData(); !strings.HasSuffix(response, updated) {
+    t.Errorf("Expected the file without -checksums, got: %s", response)
+  }
+}
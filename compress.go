@@ -0,0 +1,180 @@
+package main
+
+import (
+  "bufio"
+  "compress/gzip"
+  "fmt"
+  "io"
+  "net"
+  "os"
+  "strings"
+)
+
+var (
+  gzipEnabled bool
+  gzipLevel   = 6
+)
+
+func validateGzipLevel(level int) error {
+  if level < gzip.BestSpeed || level > gzip.BestCompression {
+    return fmt.Errorf("invalid gzip level %d (expected %d to %d)", level, gzip.BestSpeed, gzip.BestCompression)
+  }
+  return nil
+}
+
+// mediaPrefixList is a flag holding comma separated content type prefixes. Setting it replaces
+// the list, so the defaults can be narrowed as well as extended.
+type mediaPrefixList []string
+
+func (l *mediaPrefixList) String() string {
+  return strings.Join(*l, ",")
+}
+
+func (l *mediaPrefixList) Set(value string) error {
+  var prefixes []string
+  for _, item := range strings.Split(value, ",") {
+    if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+      prefixes = append(prefixes, item)
+    }
+  }
+  *l = prefixes
+  return nil
+}
+
+// gzipTypes lists the content type prefixes compressed by -gzip.
+var gzipTypes = mediaPrefixList{"text/", "application/json", "application/javascript", "application/xml", "image/svg+xml"}
+
+// compressible reports whether content of this type is on the -gzip-types allowlist.
+func compressible(contentType string) bool {
+  mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+  mediaType = strings.TrimSpace(mediaType)
+
+  for _, prefix := range gzipTypes {
+    if strings.HasPrefix(mediaType, prefix) {
+      return true
+    }
+  }
+  return false
+}
+
+// acceptsGzip reports whether the client asked for gzip. Without Accept-Encoding the identity
+// encoding is used, as older clients may not cope with anything else.
+func acceptsGzip(req *request) bool {
+  header := req.header("Accept-Encoding")
+  if strings.TrimSpace(header) == "" {
+    return false
+  }
+  return negotiate(header, []string{"gzip", "identity"}) == "gzip"
+}
+
+var precompressed bool
+
+// sidecarEncodings lists the precompressed sidecar extensions by encoding, in order of preference.
+var sidecarEncodings = []struct {
+  encoding string
+  ext      string
+}{
+  {encoding: "br", ext: ".br"},
+  {encoding: "gzip", ext: ".gz"},
+}
+
+// encodedETag derives the entity tag of an encoded variant from a tag computed for its content.
+func encodedETag(etag, encoding string) string {
+  return strings.TrimSuffix(etag, "\"") + "-" + encoding + "\""
+}
+
+// selectSidecar picks the precompressed sidecar of the file at path to send for req: path.br
+// or path.gz, whichever the client prefers among those that exist. It returns path itself
+// when the client prefers the identity encoding, when no sidecar exists or for range requests.
+func selectSidecar(req *request, path string) (string, variant) {
+  var offers []string
+  sidecars := make(map[string]string)
+  for _, sidecar := range sidecarEncodings {
+    if info, err := os.Stat(path + sidecar.ext); err == nil && info.Mode().IsRegular() {
+      offers = append(offers, sidecar.encoding)
+      sidecars[sidecar.encoding] = path + sidecar.ext
+    }
+  }
+  if len(offers) == 0 {
+    return path, variant{}
+  }
+
+  v := variant{vary: true}
+  header := req.header("Accept-Encoding")
+  if strings.TrimSpace(header) == "" || req.header("Range") != "" {
+    return path, v
+  }
+
+  choice := negotiate(header, append(offers, "identity"))
+  if sidecar, ok := sidecars[choice]; ok {
+    v.encoding = choice
+    return sidecar, v
+  }
+  return path, v
+}
+
+// sendGzip writes size bytes of content gzip compressed at -gzip-level. The compressed length
+// is not known up front, so HTTP/1.1 bodies are sent in chunks, keeping the connection open;
+// older clients cannot read chunks, so their body is delimited by closing the connection.
+func sendGzip(conn net.Conn, req *request, code int, reason string, header responseHeader, content io.Reader, size int64) {
+  chunked := strings.TrimSpace(req.version) == "HTTP/1.1"
+  header.set("Content-Encoding", "gzip")
+  if chunked {
+    header.set("Transfer-Encoding", "chunked")
+  } else {
+    header.set("Connection", "close")
+  }
+  writeResponseHeader(conn, code, reason, header)
+  if bodyOmitted(conn) {
+    return
+  }
+
+  var body io.Writer = conn
+  var chunks *bufio.Writer
+  if chunked {
+    // Buffering before the chunk framing keeps the many small writes of gzip out of separate chunks.
+    chunks = bufio.NewWriterSize(chunkedWriter{conn}, 32<<10)
+    body = chunks
+  }
+
+  gz, err := gzip.NewWriterLevel(body, gzipLevel)
+  if err != nil {
+    abortResponse(conn)
+    return
+  }
+  if _, err := copyN(gz, content, size); err != nil {
+    // Without the last chunk the client sees the body is incomplete; the connection is closed.
+    abortResponse(conn)
+    return
+  }
+  gz.Close()
+  if chunked {
+    if err := chunks.Flush(); err != nil {
+      abortResponse(conn)
+      return
+    }
+    io.WriteString(conn, "0\r\n\r\n")
+  }
+}
+
+// chunkedWriter frames each write to w as one chunk of the chunked transfer coding. The last,
+// empty chunk ending the body is written by the caller.
+type chunkedWriter struct {
+  w io.Writer
+}
+
+func (c chunkedWriter) Write(b []byte) (int, error) {
+  if len(b) == 0 {
+    return 0, nil
+  }
+  if _, err := fmt.Fprintf(c.w, "%x\r\n", len(b)); err != nil {
+    return 0, err
+  }
+  if _, err := c.w.Write(b); err != nil {
+    return 0, err
+  }
+  if _, err := io.WriteString(c.w, "\r\n"); err != nil {
+    return 0, err
+  }
+  return len(b), nil
+}
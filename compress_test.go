@@ -0,0 +1,247 @@
+package main
+
+import (
+  "bufio"
+  "compress/gzip"
+  "fmt"
+  "io"
+  "math/rand"
+  "strconv"
+  "strings"
+  "testing"
+)
+
+// useGzip enables -gzip at level for the duration of the test.
+func useGzip(t *testing.T, level int) {
+  t.Helper()
+  originalEnabled, originalLevel := gzipEnabled, gzipLevel
+  gzipEnabled, gzipLevel = true, level
+  t.Cleanup(func() { gzipEnabled, gzipLevel = originalEnabled, originalLevel })
+}
+
+// compressibleText returns deterministic text with enough redundancy for levels to differ.
+func compressibleText() string {
+  words := []string{"static", "file", "server", "listing", "worker", "request", "header", "range"}
+  rng := rand.New(rand.NewSource(1))
+  var builder strings.Builder
+  for i := 0; i < 20000; i++ {
+    fmt.Fprintf(&builder, "%s%d ", words[rng.Intn(len(words))], rng.Intn(100))
+  }
+  return builder.String()
+}
+
+// readChunked reads a chunked body from reader and returns its chunks joined, failing the test on
+// malformed framing or a missing last chunk.
+func readChunked(t *testing.T, reader *bufio.Reader) string {
+  t.Helper()
+  var decoded strings.Builder
+  for {
+    line, err := reader.ReadString('\n')
+    if err != nil {
+      t.Fatalf("Failed to read chunk size: %v", err)
+    }
+    size, err := strconv.ParseInt(strings.TrimSpace(line), 16, 64)
+    if err != nil {
+      t.Fatalf("Invalid chunk size %q", line)
+    }
+    chunk := make([]byte, size+2)
+    if _, err := io.ReadFull(reader, chunk); err != nil || string(chunk[size:]) != "\r\n" {
+      t.Fatalf("Malformed chunk of %d bytes (%v)", size, err)
+    }
+    if size == 0 {
+      return decoded.String()
+    }
+    decoded.Write(chunk[:size])
+  }
+}
+
+func TestValidateGzipLevel(t *testing.T) {
+  for _, level := range []int{0, -1, 10} {
+    if err := validateGzipLevel(level); err == nil {
+      t.Errorf("Expected error for level %d", level)
+    }
+  }
+  for _, level := range []int{1, 6, 9} {
+    if err := validateGzipLevel(level); err != nil {
+      t.Errorf("Unexpected error for level %d: %v", level, err)
+    }
+  }
+}
+
+func TestGzipResponses(t *testing.T) {
+  tempDir := t.TempDir()
+  text := compressibleText()
+  writeTestFiles(t, tempDir, map[string]string{"page.txt": text, "image.png": "\x89PNG\r\n\x1a\nnot really"})
+  useRoots(t, tempDir)
+
+  fetch := func(t *testing.T, request string) (string, string) {
+    conn := newMockConn(request)
+    handleConnection(conn)
+    headers, body, _ := strings.Cut(conn.GetWrittenData(), "\r\n\r\n")
+    return headers, body
+  }
+
+  bodySizes := map[int]int{}
+  for _, level := range []int{1, 9} {
+    t.Run(fmt.Sprintf("Level %d", level), func(t *testing.T) {
+      useGzip(t, level)
+
+      headers, body := fetch(t, "GET /page.txt HTTP/1.1\r\nAccept-Encoding: gzip, deflate\r\n\r\n")
+      for _, expected := range []string{"Content-Encoding: gzip", "Vary: Accept-Encoding", "Transfer-Encoding: chunked", "-gzip\""} {
+        if !strings.Contains(headers, expected) {
+          t.Errorf("Expected %q in headers, got: %s", expected, headers)
+        }
+      }
+      if strings.Contains(headers, "Content-Length") || strings.Contains(headers, "Connection: close") {
+        t.Errorf("Expected no Content-Length and no Connection: close for a chunked body, got: %s", headers)
+      }
+
+      body = readChunked(t, bufio.NewReader(strings.NewReader(body)))
+      gz, err := gzip.NewReader(strings.NewReader(body))
+      if err != nil {
+        t.Fatalf("Expected a gzip body: %v", err)
+      }
+      decoded, err := io.ReadAll(gz)
+      if err != nil || string(decoded) != text {
+        t.Errorf("Expected the body to decompress to the file (%v)", err)
+      }
+      bodySizes[level] = len(body)
+    })
+  }
+  if bodySizes[9] >= bodySizes[1] {
+    t.Errorf("Expected level 9 (%d bytes) to compress better than level 1 (%d bytes)", bodySizes[9], bodySizes[1])
+  }
+
+  useGzip(t, 6)
+  headers, body := fetch(t, "GET /page.txt HTTP/1.0\r\nAccept-Encoding: gzip\r\n\r\n")
+  if !strings.Contains(headers, "Connection: close") || strings.Contains(headers, "Transfer-Encoding") {
+    t.Errorf("Expected an HTTP/1.0 body delimited by closing the connection, got: %s", headers)
+  }
+  if gz, err := gzip.NewReader(strings.NewReader(body)); err != nil {
+    t.Errorf("Expected an unframed gzip body for HTTP/1.0: %v", err)
+  } else if decoded, err := io.ReadAll(gz); err != nil || string(decoded) != text {
+    t.Errorf("Expected the HTTP/1.0 body to decompress to the file (%v)", err)
+  }
+
+  testCases := []struct {
+    name    string
+    request string
+  }{
+    {name: "No Accept-Encoding", request: "GET /page.txt HTTP/1.1\r\n\r\n"},
+    {name: "gzip refused", request: "GET /page.txt HTTP/1.1\r\nAccept-Encoding: gzip;q=0\r\n\r\n"},
+    {name: "Range request", request: "GET /page.txt HTTP/1.1\r\nAccept-Encoding: gzip\r\nRange: bytes=0-9\r\n\r\n"},
+    {name: "Incompressible type", request: "GET /image.png HTTP/1.1\r\nAccept-Encoding: gzip\r\n\r\n"},
+  }
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      headers, _ := fetch(t, tc.request)
+      if strings.Contains(headers, "Content-Encoding") {
+        t.Errorf("Expected an uncompressed response, got: %s", headers)
+      }
+    })
+  }
+}
+
+func TestPrecompressedSidecars(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "app.js":    "console.log('plain')",
+    "app.js.gz": "gzip bytes",
+    "app.js.br": "brotli bytes",
+    "solo.css":  "body {}",
+  })
+  useRoots(t, tempDir)
+
+  original := precompressed
+  precompressed = true
+  defer func() { precompressed = original }()
+
+  testCases := []struct {
+    name             string
+    path             string
+    acceptEncoding   string
+    expectedEncoding string
+    expectedBody     string
+    expectVary       bool
+  }{
+    {name: "Identity", path: "/app.js", acceptEncoding: "", expectedBody: "console.log('plain')", expectVary: true},
+    {name: "Gzip sidecar", path: "/app.js", acceptEncoding: "gzip", expectedEncoding: "gzip", expectedBody: "gzip bytes", expectVary: true},
+    {name: "Brotli preferred", path: "/app.js", acceptEncoding: "gzip, br", expectedEncoding: "br", expectedBody: "brotli bytes", expectVary: true},
+    {name: "Client preference wins", path: "/app.js", acceptEncoding: "br;q=0.5, gzip", expectedEncoding: "gzip", expectedBody: "gzip bytes", expectVary: true},
+    {name: "No sidecar", path: "/solo.css", acceptEncoding: "gzip, br", expectedBody: "body {}", expectVary: false},
+  }
+
+  etags := make(map[string]string)
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      request := "GET " + tc.path + " HTTP/1.1\r\n"
+      if tc.acceptEncoding != "" {
+        request += "Accept-Encoding: " + tc.acceptEncoding + "\r\n"
+      }
+      conn := newMockConn(request + "\r\n")
+      handleConnection(conn)
+
+      headers, body, _ := strings.Cut(conn.GetWrittenData(), "\r\n\r\n")
+      if body != tc.expectedBody {
+        t.Errorf("Expected body %q, got %q", tc.expectedBody, body)
+      }
+      if !strings.Contains(headers, "Content-Type: text/") {
+        t.Errorf("Expected the type of the original file, got: %s", headers)
+      }
+      if got := strings.Contains(headers, "Content-Encoding: "+tc.expectedEncoding); tc.expectedEncoding != "" && !got {
+        t.Errorf("Expected Content-Encoding %s, got: %s", tc.expectedEncoding, headers)
+      }
+      if tc.expectedEncoding == "" && strings.Contains(headers, "Content-Encoding") {
+        t.Errorf("Expected no Content-Encoding, got: %s", headers)
+      }
+      if strings.Contains(headers, "Vary: Accept-Encoding") != tc.expectVary {
+        t.Errorf("Expected Vary present to be %v, got: %s", tc.expectVary, headers)
+      }
+
+      for _, line := range strings.Split(headers, "\r\n") {
+        if etag, found := strings.CutPrefix(line, "ETag: "); found {
+          etags[tc.path+" "+tc.expectedEncoding] = etag
+        }
+      }
+    })
+  }
+
+  identity, gz, br := etags["/app.js "], etags["/app.js gzip"], etags["/app.js br"]
+  if identity == "" || identity == gz || identity == br || gz == br {
+    t.Errorf("Expected distinct ETags per encoding, got identity %s, gzip %s, br %s", identity, gz, br)
+  }
+}
+
+func TestGzipTypes(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"page.html": compressibleText(), "data.csv": compressibleText()})
+  useRoots(t, tempDir)
+  useGzip(t, 6)
+
+  original := gzipTypes
+  defer func() { gzipTypes = original }()
+  if err := gzipTypes.Set("text/html, application/json"); err != nil {
+    t.Fatalf("Failed to set gzip types: %v", err)
+  }
+
+  testCases := []struct {
+    name       string
+    path       string
+    compressed bool
+  }{
+    {"Type on the list", "/page.html", true},
+    {"Type off the list", "/data.csv", false},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\nAccept-Encoding: gzip\r\n\r\n")
+      handleConnection(conn)
+      headers, _, _ := strings.Cut(conn.GetWrittenData(), "\r\n\r\n")
+
+      if compressed := strings.Contains(headers, "Content-Encoding: gzip"); compressed != tc.compressed {
+        t.Errorf("Expected compressed=%v, got: %s", tc.compressed, headers)
+      }
+    })
+  }
+}
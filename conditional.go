@@ -0,0 +1,163 @@
+package main
+
+import (
+  "crypto/sha256"
+  "encoding/base64"
+  "fmt"
+  "io"
+  "net"
+  "os"
+  "strings"
+  "sync"
+  "time"
+)
+
+// httpTimeFormat is the IMF-fixdate format used by Last-Modified and If-Modified-Since.
+const httpTimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// etagMode is the -etag value: "weak" derives weak entity tags from size and modification time,
+// "strong" strong ones from a SHA-256 hash of the content.
+var etagMode = "weak"
+
+func validateETagMode(mode string) error {
+  if mode != "weak" && mode != "strong" {
+    return fmt.Errorf("unknown etag mode %q (expected weak or strong)", mode)
+  }
+  return nil
+}
+
+// etagFor returns a weak entity tag derived from the file's modification time and size. It is weak
+// because two versions written within the clock's resolution could share it.
+func etagFor(info os.FileInfo) string {
+  return formatETag(fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size()), true)
+}
+
+// formatETag quotes opaque as an entity tag, prefixed with W/ when it is weak.
+func formatETag(opaque string, weak bool) string {
+  if weak {
+    return "W/\"" + opaque + "\""
+  }
+  return "\"" + opaque + "\""
+}
+
+// parseETags splits an If-None-Match or If-Match value into its entity tags, kept in their
+// W/"opaque" or "opaque" form. wildcard is set for "*". ok is false when the value is malformed.
+func parseETags(value string) (tags []string, wildcard bool, ok bool) {
+  value = strings.TrimSpace(value)
+  if value == "*" {
+    return nil, true, true
+  }
+
+  for value != "" {
+    start := value
+    value = strings.TrimPrefix(value, "W/")
+    if !strings.HasPrefix(value, "\"") {
+      return nil, false, false
+    }
+    end := strings.IndexByte(value[1:], '"')
+    if end < 0 {
+      return nil, false, false
+    }
+    tagLen := len(start) - len(value) + end + 2
+    tags = append(tags, start[:tagLen])
+
+    value = strings.TrimLeft(start[tagLen:], " \t")
+    if value != "" && !strings.HasPrefix(value, ",") {
+      return nil, false, false
+    }
+    value = strings.TrimLeft(value, ", \t")
+  }
+  return tags, false, len(tags) > 0
+}
+
+// etagsMatch compares two entity tags. The weak comparison only looks at the opaque tags; the
+// strong comparison also requires both to be strong.
+func etagsMatch(a, b string, weak bool) bool {
+  aOpaque, aWeak := strings.CutPrefix(a, "W/")
+  bOpaque, bWeak := strings.CutPrefix(b, "W/")
+  if !weak && (aWeak || bWeak) {
+    return false
+  }
+  return aOpaque == bOpaque
+}
+
+// hashedETag is a content hash computed for one version of a file.
+type hashedETag struct {
+  modTime time.Time
+  size    int64
+  etag    string
+}
+
+// etagHashes caches content hashes by file key; an entry is valid while modification time and size match.
+var etagHashes = struct {
+  sync.Mutex
+  entries map[string]hashedETag
+}{entries: make(map[string]hashedETag)}
+
+// contentETag returns the entity tag for content, the file identified by key and described by
+// info. Under -etag strong, seekable content is hashed once per version and rewound afterwards;
+// content that cannot be rewound falls back to the size and modification time tag.
+func contentETag(key string, info os.FileInfo, content io.Reader) (string, error) {
+  seeker, ok := content.(io.ReadSeeker)
+  if etagMode != "strong" || !ok {
+    return etagFor(info), nil
+  }
+
+  etagHashes.Lock()
+  cached, found := etagHashes.entries[key]
+  etagHashes.Unlock()
+  if found && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+    return cached.etag, nil
+  }
+
+  hash := sha256.New()
+  if _, err := io.Copy(hash, seeker); err != nil {
+    return "", err
+  }
+  if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+    return "", err
+  }
+  etag := formatETag(base64.RawURLEncoding.EncodeToString(hash.Sum(nil)), false)
+
+  etagHashes.Lock()
+  etagHashes.entries[key] = hashedETag{modTime: info.ModTime(), size: info.Size(), etag: etag}
+  etagHashes.Unlock()
+  return etag, nil
+}
+
+// notModified reports whether the conditional headers of req match the current representation.
+// If-None-Match takes precedence; If-Modified-Since is only consulted without it.
+func notModified(req *request, etag string, modTime time.Time) bool {
+  // If-None-Match uses the weak comparison, so a weak tag still validates a cached copy.
+  if ifNoneMatch := req.header("If-None-Match"); ifNoneMatch != "" {
+    tags, wildcard, ok := parseETags(ifNoneMatch)
+    if wildcard {
+      return true
+    }
+    for _, tag := range tags {
+      if ok && etagsMatch(tag, etag, true) {
+        return true
+      }
+    }
+    return false
+  }
+
+  if ifModifiedSince := req.header("If-Modified-Since"); ifModifiedSince != "" {
+    since, err := time.Parse(httpTimeFormat, ifModifiedSince)
+    if err != nil {
+      return false
+    }
+    return !modTime.Truncate(time.Second).After(since)
+  }
+
+  return false
+}
+
+// send304 answers a matching conditional request. The response carries the validators a 200
+// would have had but, unlike other responses, neither a body nor a Content-Length.
+func send304(conn net.Conn, etag string, modTime time.Time) {
+  header := responseHeader{}
+  header.set("ETag", etag)
+  header.set("Last-Modified", modTime.UTC().Format(httpTimeFormat))
+  writeResponseHeader(conn, 304, "Not Modified", header)
+}
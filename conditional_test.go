@@ -0,0 +1,181 @@
+package main
+
+import (
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+  "time"
+)
+
+func TestConditionalRequests(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"page.html": "<p>hello</p>"})
+  useRoots(t, tempDir)
+
+  info, err := os.Stat(filepath.Join(tempDir, "page.html"))
+  if err != nil {
+    t.Fatalf("Failed to stat test file: %v", err)
+  }
+  etag := etagFor(info)
+  lastModified := info.ModTime().UTC().Format(httpTimeFormat)
+  earlier := info.ModTime().Add(-time.Hour).UTC().Format(httpTimeFormat)
+
+  testCases := []struct {
+    name           string
+    header         string
+    expectedStatus string
+  }{
+    {name: "Matching ETag", header: "If-None-Match: " + etag, expectedStatus: "304"},
+    {name: "ETag in list", header: "If-None-Match: \"other\", " + etag, expectedStatus: "304"},
+    {name: "Strong form of weak ETag", header: "If-None-Match: " + strings.TrimPrefix(etag, "W/"), expectedStatus: "304"},
+    {name: "Unquoted ETag", header: "If-None-Match: " + strings.Trim(strings.TrimPrefix(etag, "W/"), "\""), expectedStatus: "200"},
+    {name: "Wildcard", header: "If-None-Match: *", expectedStatus: "304"},
+    {name: "Stale ETag", header: "If-None-Match: \"other\"", expectedStatus: "200"},
+    {name: "Not modified since", header: "If-Modified-Since: " + lastModified, expectedStatus: "304"},
+    {name: "Modified since", header: "If-Modified-Since: " + earlier, expectedStatus: "200"},
+    {name: "ETag wins over date", header: "If-None-Match: \"other\"\r\nIf-Modified-Since: " + lastModified, expectedStatus: "200"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn("GET /page.html HTTP/1.1\r\n" + tc.header + "\r\n\r\n")
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.HasPrefix(response, "HTTP/1.1 "+tc.expectedStatus) {
+        t.Fatalf("Expected status %s, got: %s", tc.expectedStatus, response)
+      }
+      if tc.expectedStatus != "304" {
+        return
+      }
+
+      headers, body, _ := strings.Cut(response, "\r\n\r\n")
+      if body != "" {
+        t.Errorf("Expected no body in a 304, got: %q", body)
+      }
+      if strings.Contains(headers, "Content-Length") {
+        t.Errorf("Expected no Content-Length in a 304, got: %s", headers)
+      }
+      if !strings.Contains(headers, "\r\nETag: "+etag+"\r\n") {
+        t.Errorf("Expected ETag %s to be echoed, got: %s", etag, headers)
+      }
+    })
+  }
+}
+
+func TestStrongETag(t *testing.T) {
+  tempDir := t.TempDir()
+  filePath := filepath.Join(tempDir, "data.txt")
+  writeTestFiles(t, tempDir, map[string]string{"data.txt": "aaaa"})
+  useRoots(t, tempDir)
+
+  original := etagMode
+  defer func() { etagMode = original }()
+
+  fetchETag := func() string {
+    conn := newMockConn("GET /data.txt HTTP/1.1\r\n\r\n")
+    handleConnection(conn)
+    for _, line := range strings.Split(conn.GetWrittenData(), "\r\n") {
+      if etag, found := strings.CutPrefix(line, "ETag: "); found {
+        return etag
+      }
+    }
+    t.Fatalf("Expected an ETag in the response")
+    return ""
+  }
+
+  info, err := os.Stat(filePath)
+  if err != nil {
+    t.Fatalf("Failed to stat test file: %v", err)
+  }
+  modTime := info.ModTime()
+
+  etagMode = "strong"
+  var tags []string
+  for i, content := range []string{"aaaa", "bbbb"} {
+    if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+      t.Fatalf("Failed to write test file: %v", err)
+    }
+    // Identical size; the new modification time invalidates the cached hash.
+    stamp := modTime.Add(time.Duration(i) * time.Second)
+    if err := os.Chtimes(filePath, stamp, stamp); err != nil {
+      t.Fatalf("Failed to set modification time: %v", err)
+    }
+    tags = append(tags, fetchETag())
+  }
+
+  if tags[0] == tags[1] {
+    t.Errorf("Expected the strong ETag to change with the content, got %s twice", tags[0])
+  }
+  if current, err := os.Stat(filePath); err == nil && tags[1] == etagFor(current) {
+    t.Errorf("Expected a content hash, got the metadata ETag %s", tags[1])
+  }
+
+  conn := newMockConn("GET /data.txt HTTP/1.1\r\nIf-None-Match: " + tags[1] + "\r\n\r\n")
+  handleConnection(conn)
+  if response := conn.GetWrittenData(); !strings.HasPrefix(response, "HTTP/1.1 304") {
+    t.Errorf("Expected the strong ETag to validate, got: %s", response)
+  }
+}
+
+func TestParseETags(t *testing.T) {
+  testCases := []struct {
+    name     string
+    value    string
+    tags     []string
+    wildcard bool
+    ok       bool
+  }{
+    {name: "Quoted", value: `"abc123"`, tags: []string{`"abc123"`}, ok: true},
+    {name: "Weak", value: `W/"abc123"`, tags: []string{`W/"abc123"`}, ok: true},
+    {name: "Wildcard", value: ` * `, wildcard: true, ok: true},
+    {name: "List", value: `"a", W/"b" ,"c"`, tags: []string{`"a"`, `W/"b"`, `"c"`}, ok: true},
+    {name: "Comma inside tag", value: `"a,b", "c"`, tags: []string{`"a,b"`, `"c"`}, ok: true},
+    {name: "Empty tag", value: `""`, tags: []string{`""`}, ok: true},
+    {name: "Unquoted", value: `abc123`},
+    {name: "Unterminated", value: `"abc`},
+    {name: "Lowercase weak prefix", value: `w/"abc"`},
+    {name: "Missing comma", value: `"a" "b"`},
+    {name: "Wildcard in list", value: `"a", *`},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      tags, wildcard, ok := parseETags(tc.value)
+      if ok != tc.ok || wildcard != tc.wildcard || strings.Join(tags, " ") != strings.Join(tc.tags, " ") {
+        t.Errorf("Expected tags %q, wildcard %v, ok %v, got %q, %v, %v", tc.tags, tc.wildcard, tc.ok, tags, wildcard, ok)
+      }
+    })
+  }
+}
+
+func TestETagsMatch(t *testing.T) {
+  testCases := []struct {
+    a, b        string
+    weakMatch   bool
+    strongMatch bool
+  }{
+    {`"1"`, `"1"`, true, true},
+    {`W/"1"`, `W/"1"`, true, false},
+    {`W/"1"`, `"1"`, true, false},
+    {`"1"`, `"2"`, false, false},
+    {`W/"1"`, `W/"2"`, false, false},
+  }
+
+  for _, tc := range testCases {
+    if match := etagsMatch(tc.a, tc.b, true); match != tc.weakMatch {
+      t.Errorf("Expected weak comparison of %s and %s to be %v", tc.a, tc.b, tc.weakMatch)
+    }
+    if match := etagsMatch(tc.a, tc.b, false); match != tc.strongMatch {
+      t.Errorf("Expected strong comparison of %s and %s to be %v", tc.a, tc.b, tc.strongMatch)
+    }
+  }
+
+  if tag := formatETag("abc", true); tag != `W/"abc"` {
+    t.Errorf(`Expected W/"abc", got %s`, tag)
+  }
+  if tag := formatETag("abc", false); tag != `"abc"` {
+    t.Errorf(`Expected "abc", got %s`, tag)
+  }
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "flag"
+  "fmt"
+  "log"
+  "os"
+  "slices"
+  "sort"
+)
+
+var configPath string
+
+// cliFlags records the flags given on the command line; they take precedence over the config file.
+var cliFlags = map[string]bool{}
+
+// reloadableFlags lists the options re-applied from the config file on SIGHUP.
+var reloadableFlags = map[string]bool{"mime-types": true, "header": true}
+
+// resetter is implemented by repeatable flags, which append on every Set: reloads reset them
+// before applying the config file again.
+type resetter interface {
+  reset()
+}
+
+// configValues holds the config file values applied at startup. Reloads compare against them, as
+// the flags print their values normalized, e.g. "10MB" as 10485760.
+var configValues map[string][]string
+
+// readConfigFile reads a JSON object whose keys are flag names (without the leading dash), e.g.
+//
+//   {"p": "8000", "d": ["./theme", "./base"], "w": 4, "log-format": "json"}
+//
+// Values may be strings, numbers or booleans; arrays set repeatable flags once per element.
+// It returns the values of each field as the strings passed to the flag.
+func readConfigFile(path string) (map[string][]string, error) {
+  data, err := os.ReadFile(path)
+  if err != nil {
+    return nil, err
+  }
+
+  decoder := json.NewDecoder(bytes.NewReader(data))
+  decoder.UseNumber()
+
+  var raw map[string]any
+  if err := decoder.Decode(&raw); err != nil {
+    return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+  }
+
+  values := make(map[string][]string, len(raw))
+  for name, value := range raw {
+    items, isArray := value.([]any)
+    if !isArray {
+      items = []any{value}
+    }
+
+    for _, item := range items {
+      switch v := item.(type) {
+      case string:
+        values[name] = append(values[name], v)
+      case json.Number:
+        values[name] = append(values[name], v.String())
+      case bool:
+        values[name] = append(values[name], fmt.Sprint(v))
+      default:
+        return nil, fmt.Errorf("config field %q: unsupported value %v", name, item)
+      }
+    }
+  }
+
+  return values, nil
+}
+
+// applyConfig sets the flags of fs from config values, skipping the flags named in skip.
+// Unknown fields and invalid values are reported with the name of the offending field.
+func applyConfig(fs *flag.FlagSet, values map[string][]string, skip map[string]bool) error {
+  names := make([]string, 0, len(values))
+  for name := range values {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+
+  for _, name := range names {
+    if name == "config" || fs.Lookup(name) == nil {
+      return fmt.Errorf("config field %q: unknown option", name)
+    }
+    if skip[name] {
+      continue
+    }
+
+    for _, value := range values[name] {
+      if err := fs.Set(name, value); err != nil {
+        return fmt.Errorf("config field %q: %v", name, err)
+      }
+    }
+  }
+
+  return nil
+}
+
+// reloadConfigFile re-applies the reloadable options of fs from the config file. Changes to other
+// options are ignored with a log note, since they need a restart.
+func reloadConfigFile(fs *flag.FlagSet) error {
+  if configPath == "" {
+    return nil
+  }
+
+  values, err := readConfigFile(configPath)
+  if err != nil {
+    return err
+  }
+
+  reloadable := make(map[string][]string)
+  for name, value := range values {
+    if reloadableFlags[name] {
+      reloadable[name] = value
+    } else if fs.Lookup(name) != nil && !cliFlags[name] && !slices.Equal(value, configValues[name]) {
+      log.Printf("Config field %q changed but requires a restart, ignoring", name)
+    }
+  }
+
+  for name := range reloadableFlags {
+    if f := fs.Lookup(name); f != nil && !cliFlags[name] {
+      if r, ok := f.Value.(resetter); ok {
+        r.reset()
+      }
+    }
+  }
+  return applyConfig(fs, reloadable, cliFlags)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+  "flag"
+  "os"
+  "path/filepath"
+  "reflect"
+  "strings"
+  "testing"
+  "time"
+)
+
+// writeConfig writes content to a config file in a temporary directory and returns its path.
+func writeConfig(t *testing.T, content string) string {
+  t.Helper()
+  path := filepath.Join(t.TempDir(), "ghttpd.json")
+  if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+    t.Fatalf("Failed to write config: %v", err)
+  }
+  return path
+}
+
+func TestApplyConfig(t *testing.T) {
+  fs := flag.NewFlagSet("test", flag.ContinueOnError)
+  var (
+    testPort    string
+    testRoots   rootList
+    testWorkers int
+    testMerge   bool
+    testTimeout time.Duration
+  )
+  fs.StringVar(&testPort, "p", "8080", "")
+  fs.Var(&testRoots, "d", "")
+  fs.IntVar(&testWorkers, "w", 1, "")
+  fs.BoolVar(&testMerge, "merge-listings", false, "")
+  fs.DurationVar(&testTimeout, "shutdown-timeout", time.Second, "")
+
+  if err := fs.Parse([]string{"-p", "9000"}); err != nil {
+    t.Fatalf("Failed to parse flags: %v", err)
+  }
+  explicit := map[string]bool{}
+  fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+  values, err := readConfigFile(writeConfig(t, `{
+    "p": "8000",
+    "d": ["./theme", "./base"],
+    "w": 4,
+    "merge-listings": true,
+    "shutdown-timeout": "5s"
+  }`))
+  if err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  if err := applyConfig(fs, values, explicit); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+
+  if testPort != "9000" {
+    t.Errorf("Expected command-line port to win, got %s", testPort)
+  }
+  if !reflect.DeepEqual(testRoots, rootList{"./theme", "./base"}) {
+    t.Errorf("Expected both roots from the config file, got %v", testRoots)
+  }
+  if testWorkers != 4 || !testMerge || testTimeout != 5*time.Second {
+    t.Errorf("Unexpected effective settings: workers=%d merge=%v timeout=%v", testWorkers, testMerge, testTimeout)
+  }
+}
+
+func TestApplyConfigErrors(t *testing.T) {
+  testCases := []struct {
+    name          string
+    content       string
+    expectedField string
+  }{
+    {name: "Unknown field", content: `{"port": "8080"}`, expectedField: `"port"`},
+    {name: "Invalid value", content: `{"w": "many"}`, expectedField: `"w"`},
+    {name: "Nested object", content: `{"d": {"path": "."}}`, expectedField: `"d"`},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      fs := flag.NewFlagSet("test", flag.ContinueOnError)
+      var testWorkers int
+      var testRoots rootList
+      fs.IntVar(&testWorkers, "w", 1, "")
+      fs.Var(&testRoots, "d", "")
+
+      values, err := readConfigFile(writeConfig(t, tc.content))
+      if err == nil {
+        err = applyConfig(fs, values, nil)
+      }
+      if err == nil || !strings.Contains(err.Error(), tc.expectedField) {
+        t.Errorf("Expected an error naming %s, got: %v", tc.expectedField, err)
+      }
+    })
+  }
+
+  if _, err := readConfigFile(writeConfig(t, `{"p": `)); err == nil {
+    t.Errorf("Expected an error for malformed JSON")
+  }
+}
+
+func TestReloadConfigUnchanged(t *testing.T) {
+  fs := flag.NewFlagSet("test", flag.ContinueOnError)
+  var (
+    testMaxFile byteSize
+    testTimeout time.Duration
+    testRoots   rootList
+    testMerge   bool
+  )
+  fs.Var(&testMaxFile, "cache-max-file", "")
+  fs.DurationVar(&testTimeout, "shutdown-timeout", time.Second, "")
+  fs.Var(&testRoots, "d", "")
+  fs.BoolVar(&testMerge, "merge-listings", false, "")
+
+  originalPath, originalValues := configPath, configValues
+  defer func() { configPath, configValues = originalPath, originalValues }()
+  configPath = writeConfig(t, `{"cache-max-file": "10MB", "shutdown-timeout": "90s", "d": ["./a", "./b"], "merge-listings": 1}`)
+
+  values, err := readConfigFile(configPath)
+  if err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  if err := applyConfig(fs, values, nil); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  configValues = values
+
+  logs := captureLog(t)
+  if err := reloadConfigFile(fs); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  if logs.Len() != 0 {
+    t.Errorf("Expected nothing logged for an unchanged config, got: %s", logs)
+  }
+
+  if err := os.WriteFile(configPath, []byte(`{"cache-max-file": "20MB", "shutdown-timeout": "90s", "d": ["./a", "./b"], "merge-listings": 1}`), 0644); err != nil {
+    t.Fatalf("Failed to rewrite config: %v", err)
+  }
+  if err := reloadConfigFile(fs); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  if !strings.Contains(logs.String(), `Config field "cache-max-file" changed but requires a restart`) {
+    t.Errorf("Expected a restart note for the changed field, got: %s", logs)
+  }
+  if testMaxFile != 10<<20 {
+    t.Errorf("Expected the running value to stay, got %d", testMaxFile)
+  }
+}
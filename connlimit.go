@@ -0,0 +1,57 @@
+package main
+
+import (
+  "net"
+  "net/netip"
+  "sync"
+)
+
+// maxConnsPerIP caps the simultaneous connections from one peer address, so a single client
+// cannot hold every worker with parallel keep-alive connections; 0 leaves them unlimited. The
+// peer is the address connecting, which behind a proxy is the proxy itself.
+var maxConnsPerIP int
+
+// connsPerIP counts the open connections of each peer address while maxConnsPerIP is set.
+var connsPerIP = struct {
+  sync.Mutex
+  counts map[netip.Addr]int
+}{counts: map[netip.Addr]int{}}
+
+// acquireConn counts conn against its peer address and reports whether it is within
+// -max-conns-per-ip. Refused connections are not counted; accepted ones must be released with
+// releaseConn once closed. Connections without an IP peer, such as Unix sockets, are not limited.
+func acquireConn(conn net.Conn) bool {
+  ip := remoteIP(conn)
+  if maxConnsPerIP <= 0 || !ip.IsValid() {
+    return true
+  }
+
+  connsPerIP.Lock()
+  defer connsPerIP.Unlock()
+  if connsPerIP.counts[ip] >= maxConnsPerIP {
+    return false
+  }
+  connsPerIP.counts[ip]++
+  return true
+}
+
+// releaseConn gives back the slot acquireConn took for conn.
+func releaseConn(conn net.Conn) {
+  ip := remoteIP(conn)
+  if maxConnsPerIP <= 0 || !ip.IsValid() {
+    return
+  }
+
+  connsPerIP.Lock()
+  defer connsPerIP.Unlock()
+  if connsPerIP.counts[ip]--; connsPerIP.counts[ip] <= 0 {
+    delete(connsPerIP.counts, ip)
+  }
+}
+
+// connsFrom returns the number of open connections counted for ip.
+func connsFrom(ip netip.Addr) int {
+  connsPerIP.Lock()
+  defer connsPerIP.Unlock()
+  return connsPerIP.counts[ip]
+}
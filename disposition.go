@@ -0,0 +1,93 @@
+package main
+
+import (
+  "fmt"
+  "mime"
+  "path/filepath"
+  "strings"
+)
+
+// dispositionRule maps an extension (".zip") or a content type ("application/pdf", "image/*")
+// to the Content-Disposition type sent by default, "inline" or "attachment".
+type dispositionRule struct {
+  pattern     string
+  disposition string
+}
+
+// dispositionList is the -disposition flag: rules checked in order, the first match winning.
+type dispositionList []dispositionRule
+
+var dispositionRules dispositionList
+
+func (l *dispositionList) String() string {
+  rules := make([]string, len(*l))
+  for i, rule := range *l {
+    rules[i] = rule.pattern + "=" + rule.disposition
+  }
+  return strings.Join(rules, ",")
+}
+
+// Set appends the comma separated pattern=disposition rules of value.
+func (l *dispositionList) Set(value string) error {
+  for _, item := range strings.Split(value, ",") {
+    item = strings.TrimSpace(item)
+    if item == "" {
+      continue
+    }
+
+    pattern, disposition, found := strings.Cut(item, "=")
+    pattern, disposition = strings.ToLower(strings.TrimSpace(pattern)), strings.ToLower(strings.TrimSpace(disposition))
+    if !found || pattern == "" {
+      return fmt.Errorf("invalid disposition rule %q: expected pattern=inline or pattern=attachment", item)
+    }
+    if disposition != "inline" && disposition != "attachment" {
+      return fmt.Errorf("invalid disposition %q for %s: expected inline or attachment", disposition, pattern)
+    }
+    if !strings.HasPrefix(pattern, ".") && !strings.Contains(pattern, "/") {
+      return fmt.Errorf("invalid disposition pattern %q: expected an extension or a content type", pattern)
+    }
+
+    *l = append(*l, dispositionRule{pattern: pattern, disposition: disposition})
+  }
+  return nil
+}
+
+// match returns the disposition of the first rule matching the file name or content type, or "".
+func (l dispositionList) match(name, contentType string) string {
+  ext := strings.ToLower(filepath.Ext(name))
+  mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+  mediaType = strings.TrimSpace(mediaType)
+
+  for _, rule := range l {
+    switch {
+    case strings.HasPrefix(rule.pattern, "."):
+      if rule.pattern == ext {
+        return rule.disposition
+      }
+    case strings.HasSuffix(rule.pattern, "/*"):
+      if strings.HasPrefix(mediaType, strings.TrimSuffix(rule.pattern, "*")) {
+        return rule.disposition
+      }
+    case rule.pattern == mediaType:
+      return rule.disposition
+    }
+  }
+  return ""
+}
+
+// contentDisposition returns the Content-Disposition header for serving the file at path, or ""
+// to leave it out. A ?download query parameter forces an attachment; otherwise the rules decide.
+func contentDisposition(req *request, path, contentType string) string {
+  disposition := dispositionRules.match(path, contentType)
+  if req.query.Has("download") {
+    disposition = "attachment"
+  }
+
+  switch disposition {
+  case "attachment":
+    return mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(path)})
+  case "inline":
+    return "inline"
+  }
+  return ""
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+  "strings"
+  "testing"
+)
+
+// useDispositionRules sets -disposition to value for the duration of the test.
+func useDispositionRules(t *testing.T, value string) {
+  t.Helper()
+  original := dispositionRules
+  dispositionRules = nil
+  if err := dispositionRules.Set(value); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  t.Cleanup(func() { dispositionRules = original })
+}
+
+func TestDispositionListSet(t *testing.T) {
+  for _, value := range []string{"zip=attachment", ".zip", ".zip=download", "=inline"} {
+    var rules dispositionList
+    if err := rules.Set(value); err == nil {
+      t.Errorf("Expected error for %q", value)
+    }
+  }
+}
+
+func TestContentDisposition(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "bundle.zip": "zip",
+    "manual.pdf": "pdf",
+    "photo.png":  "png",
+    "notes.txt":  "txt",
+  })
+  useRoots(t, tempDir)
+  useDispositionRules(t, ".zip=attachment,application/pdf=inline,image/*=inline")
+
+  testCases := []struct {
+    name     string
+    path     string
+    expected string
+  }{
+    {
+      name:     "Zip downloads",
+      path:     "/bundle.zip",
+      expected: "Content-Disposition: attachment; filename=bundle.zip\r\n",
+    },
+    {
+      name:     "PDF renders inline",
+      path:     "/manual.pdf",
+      expected: "Content-Disposition: inline\r\n",
+    },
+    {
+      name:     "Wildcard content type",
+      path:     "/photo.png",
+      expected: "Content-Disposition: inline\r\n",
+    },
+    {
+      name:     "Download parameter overrides the policy",
+      path:     "/manual.pdf?download",
+      expected: "Content-Disposition: attachment; filename=manual.pdf\r\n",
+    },
+    {
+      name:     "Unmatched files keep the default",
+      path:     "/notes.txt",
+      expected: "",
+    },
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.HasPrefix(response, "HTTP/1.1 200 OK") {
+        t.Fatalf("Expected 200, got: %s", response)
+      }
+      if tc.expected == "" {
+        if strings.Contains(response, "Content-Disposition") {
+          t.Errorf("Expected no Content-Disposition, got: %s", response)
+        }
+      } else if !strings.Contains(response, tc.expected) {
+        t.Errorf("Expected %q, got: %s", tc.expected, response)
+      }
+    })
+  }
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+  "errors"
+  "fmt"
+  "io/fs"
+  "net"
+  "path"
+  "path/filepath"
+  "strings"
+)
+
+// extensionList is a flag holding comma separated file extensions, such as ".html,.htm".
+type extensionList []string
+
+func (l *extensionList) String() string {
+  return strings.Join(*l, ",")
+}
+
+func (l *extensionList) Set(value string) error {
+  var extensions []string
+  for _, item := range strings.Split(value, ",") {
+    item = strings.TrimSpace(item)
+    if item == "" {
+      continue
+    }
+    if len(item) < 2 || item[0] != '.' || strings.Contains(item, "/") {
+      return fmt.Errorf("invalid extension %q: expected a form like .html", item)
+    }
+    extensions = append(extensions, item)
+  }
+  *l = extensions
+  return nil
+}
+
+// tryExtensions lists the extensions appended, in order, to request paths that match nothing,
+// so /about can be served from about.html. Empty disables the fallback.
+var tryExtensions extensionList
+
+// allowedExtensions, when not empty, lists the only extensions files may be served with; other
+// files are refused with 403 even when they exist. Directory listings are unaffected.
+var allowedExtensions extensionList
+
+// extensionAllowed reports whether the file at path may be served under -allowed-ext. Extensions
+// match case-insensitively, and files without one are refused once the list is set.
+func extensionAllowed(path string) bool {
+  if len(allowedExtensions) == 0 {
+    return true
+  }
+  ext := filepath.Ext(path)
+  for _, allowed := range allowedExtensions {
+    if strings.EqualFold(ext, allowed) {
+      return true
+    }
+  }
+  return false
+}
+
+// locateWithExtension looks for a regular file at urlPath plus one of the -try-extensions, and
+// returns it with the URL path it was found at. Paths naming a directory, with a trailing slash,
+// are left alone. fs.ErrNotExist is returned when no extension matches.
+func locateWithExtension(urlPath string) (string, string, error) {
+  if strings.HasSuffix(urlPath, "/") {
+    return "", "", fs.ErrNotExist
+  }
+  for _, extension := range tryExtensions {
+    file, _, err := locateResource(urlPath + extension)
+    if errors.Is(err, fs.ErrNotExist) {
+      continue
+    }
+    if err != nil {
+      return "", "", err
+    }
+    if file != "" {
+      return file, urlPath + extension, nil
+    }
+  }
+  return "", "", fs.ErrNotExist
+}
+
+// extensionAlias serves requests for one extension from the file with another, under a fixed
+// content type: with ".txt" aliased to ".json" as text/plain, /data.txt serves data.json as text.
+type extensionAlias struct {
+  target      string
+  contentType string
+}
+
+// aliasMap is the repeatable -ext-alias flag, keyed by the requested extension.
+type aliasMap map[string]extensionAlias
+
+var extensionAliases = aliasMap{}
+
+func (m *aliasMap) String() string {
+  var items []string
+  for ext, alias := range *m {
+    items = append(items, ext+"="+alias.target+":"+alias.contentType)
+  }
+  return strings.Join(items, " ")
+}
+
+// Set adds an ".alias=.ext:content/type" mapping.
+func (m *aliasMap) Set(value string) error {
+  ext, rest, found := strings.Cut(value, "=")
+  target, contentType, hasType := strings.Cut(rest, ":")
+  ext, target, contentType = strings.TrimSpace(ext), strings.TrimSpace(target), strings.TrimSpace(contentType)
+
+  var extensions extensionList
+  if !found || !hasType || !strings.Contains(contentType, "/") || extensions.Set(ext+","+target) != nil || len(extensions) != 2 {
+    return fmt.Errorf("invalid extension alias %q: expected .alias=.ext:content/type", value)
+  }
+  if *m == nil {
+    *m = aliasMap{}
+  }
+  (*m)[ext] = extensionAlias{target: target, contentType: contentType}
+  return nil
+}
+
+// serveAlias serves req from the file its -ext-alias points to, unless the access rules refuse
+// that file, and reports whether it answered req. The alias is consulted before the request path
+// itself, so it wins over a file of the alias name.
+func serveAlias(conn net.Conn, req *request) bool {
+  ext := path.Ext(req.path)
+  alias, ok := extensionAliases[ext]
+  if !ok {
+    return false
+  }
+
+  target := strings.TrimSuffix(req.path, ext) + alias.target
+  file, _, err := locateResource(target)
+  if err != nil || file == "" {
+    return false
+  }
+
+  if servedPathAllowed(conn, req, target) {
+    req.path, req.contentType = target, alias.contentType
+    sendFile(conn, req, file)
+  }
+  return true
+}
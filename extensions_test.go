@@ -0,0 +1,237 @@
+package main
+
+import (
+  "strings"
+  "testing"
+)
+
+func TestTryExtensions(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "about.html":      "about page",
+    "legacy.htm":      "legacy page",
+    "docs/index.html": "docs index",
+    "docs.html":       "docs page",
+    "notes.txt":       "notes",
+    "blog/post.htm":   "post htm",
+    "blog/post.html":  "post html",
+  })
+  useRoots(t, tempDir)
+
+  original := tryExtensions
+  defer func() { tryExtensions = original }()
+  if err := tryExtensions.Set(".html, .htm"); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+
+  testCases := []struct {
+    name         string
+    path         string
+    expectedCode string
+    expectedBody string
+  }{
+    {"Extensionless URL", "/about", "HTTP/1.1 200 OK", "about page"},
+    {"Second extension", "/legacy", "HTTP/1.1 200 OK", "legacy page"},
+    {"First extension wins", "/blog/post", "HTTP/1.1 200 OK", "post html"},
+    {"Exact file first", "/notes.txt", "HTTP/1.1 200 OK", "notes"},
+    {"Directory first", "/docs/", "HTTP/1.1 200 OK", "index.html"},
+    {"Trailing slash not rewritten", "/about/", "HTTP/1.1 404 Not Found", "Not Found"},
+    {"No match", "/contact", "HTTP/1.1 404 Not Found", "Not Found"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+      if !strings.Contains(response, tc.expectedBody) {
+        t.Errorf("Expected body %q, got: %s", tc.expectedBody, response)
+      }
+    })
+  }
+
+  tryExtensions = nil
+  conn := newMockConn("GET /about HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+  if response := conn.GetWrittenData(); !strings.HasPrefix(response, "HTTP/1.1 404 Not Found") {
+    t.Errorf("Expected 404 without -try-extensions, got: %s", response)
+  }
+
+  var extensions extensionList
+  for _, invalid := range []string{"html", ".", ".a/b"} {
+    if err := extensions.Set(invalid); err == nil {
+      t.Errorf("Expected error for extension %q", invalid)
+    }
+  }
+}
+
+func TestTryExtensionsAccessRules(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "admin.html": "admin",
+    "about.html": "about",
+  })
+  useRoots(t, tempDir)
+  useAccessRules(t, nil, []string{`^/admin\.html$`})
+
+  original := tryExtensions
+  defer func() { tryExtensions = original }()
+  tryExtensions = nil
+  if err := tryExtensions.Set(".html"); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+
+  testCases := []struct {
+    name         string
+    path         string
+    expectedCode string
+  }{
+    {"Denied file", "/admin.html", "HTTP/1.1 403 Forbidden"},
+    {"Denied through an extension", "/admin", "HTTP/1.1 403 Forbidden"},
+    {"Permitted through an extension", "/about", "HTTP/1.1 200 OK"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+
+      if response := conn.GetWrittenData(); !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+    })
+  }
+}
+
+func TestExtensionAliases(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "api/data.json": `{"ok":true}`,
+    "api/data.txt":  "shadowed",
+    "api/other.txt": "plain file",
+  })
+  useRoots(t, tempDir)
+
+  original := extensionAliases
+  extensionAliases = aliasMap{}
+  defer func() { extensionAliases = original }()
+  for _, alias := range []string{".txt=.json:text/plain; charset=utf-8", ".js=.json:application/javascript"} {
+    if err := extensionAliases.Set(alias); err != nil {
+      t.Fatalf("Unexpected error: %v", err)
+    }
+  }
+
+  testCases := []struct {
+    name         string
+    path         string
+    expectedType string
+    expectedBody string
+  }{
+    {"Alias as text", "/api/data.txt", "text/plain; charset=utf-8", `{"ok":true}`},
+    {"Alias as script", "/api/data.js", "application/javascript", `{"ok":true}`},
+    {"Underlying file", "/api/data.json", "application/json", `{"ok":true}`},
+    {"Alias without target", "/api/other.txt", "text/plain; charset=utf-8", "plain file"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.HasPrefix(response, "HTTP/1.1 200 OK") || !strings.HasSuffix(response, tc.expectedBody) {
+        t.Errorf("Expected %q, got: %s", tc.expectedBody, response)
+      }
+      if !strings.Contains(response, "Content-Type: "+tc.expectedType+"\r\n") {
+        t.Errorf("Expected Content-Type %s, got: %s", tc.expectedType, response)
+      }
+    })
+  }
+
+  var aliases aliasMap
+  for _, invalid := range []string{".txt=.json", "txt=.json:text/plain", ".txt=json:text/plain", ".txt=.json:plain"} {
+    if err := aliases.Set(invalid); err == nil {
+      t.Errorf("Expected error for alias %q", invalid)
+    }
+  }
+}
+
+func TestExtensionAliasAccessRules(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"data.json": `{"secret":true}`})
+  useRoots(t, tempDir)
+  useAccessRules(t, nil, []string{`\.json$`})
+
+  original := extensionAliases
+  extensionAliases = aliasMap{}
+  defer func() { extensionAliases = original }()
+  if err := extensionAliases.Set(".txt=.json:text/plain"); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+
+  for _, path := range []string{"/data.json", "/data.txt"} {
+    conn := newMockConn("GET " + path + " HTTP/1.1\r\n\r\n")
+    handleConnection(conn)
+    if response := conn.GetWrittenData(); !strings.HasPrefix(response, "HTTP/1.1 403 Forbidden") {
+      t.Errorf("Expected 403 for %s, got: %s", path, response)
+    }
+  }
+}
+
+func TestAllowedExtensions(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "style.css":      "body {}",
+    "logo.PNG":       "png",
+    "config.yaml":    "secret: true",
+    "Makefile":       "all:",
+    "assets/app.css": "app",
+  })
+  useRoots(t, tempDir)
+
+  original := allowedExtensions
+  defer func() { allowedExtensions = original }()
+  if err := allowedExtensions.Set(".css,.png"); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+
+  testCases := []struct {
+    name         string
+    path         string
+    expectedCode string
+  }{
+    {"Allowed extension", "/style.css", "HTTP/1.1 200 OK"},
+    {"Allowed in another case", "/logo.PNG", "HTTP/1.1 200 OK"},
+    {"Disallowed extension", "/config.yaml", "HTTP/1.1 403 Forbidden"},
+    {"No extension", "/Makefile", "HTTP/1.1 403 Forbidden"},
+    {"Missing file", "/missing.yaml", "HTTP/1.1 404 Not Found"},
+    {"Directory listing", "/assets/", "HTTP/1.1 200 OK"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+
+      if response := conn.GetWrittenData(); !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+    })
+  }
+
+  useArchive(t, map[string]string{"style.css": "body {}", "config.yaml": "secret: true"}, nil)
+  for path, expectedCode := range map[string]string{
+    "/style.css":   "HTTP/1.1 200 OK",
+    "/config.yaml": "HTTP/1.1 403 Forbidden",
+  } {
+    conn := newMockConn("GET " + path + " HTTP/1.1\r\n\r\n")
+    handleConnection(conn)
+    if response := conn.GetWrittenData(); !strings.HasPrefix(response, expectedCode) {
+      t.Errorf("Expected %s from the archive for %s, got: %s", expectedCode, path, response)
+    }
+  }
+}
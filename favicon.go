@@ -0,0 +1,79 @@
+package main
+
+import (
+  "bytes"
+  "encoding/binary"
+  "fmt"
+  "image"
+  "image/color"
+  "image/png"
+  "net"
+  "os"
+  "strconv"
+  "sync"
+)
+
+// faviconPath is the URL path browsers request on their own for the tab icon.
+const faviconPath = "/favicon.ico"
+
+// favicon is the -favicon value used when no root has a favicon.ico: empty answers 404 as for
+// any missing file, "default" serves a built-in icon, "none" answers 204 without a body and
+// anything else names an icon file to serve.
+var favicon string
+
+func validateFavicon(value string) error {
+  switch value {
+  case "", "default", "none":
+    return nil
+  }
+  info, err := os.Stat(value)
+  if err != nil {
+    return fmt.Errorf("favicon: %v", err)
+  }
+  if info.IsDir() {
+    return fmt.Errorf("favicon: %s is a directory", value)
+  }
+  return nil
+}
+
+// defaultFavicon is a 16x16 icon in ICO format wrapping a PNG image, built on first use.
+var defaultFavicon = sync.OnceValue(func() []byte {
+  img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+  for y := 0; y < 16; y++ {
+    for x := 0; x < 16; x++ {
+      if x >= 2 && x < 14 && y >= 2 && y < 14 {
+        img.Set(x, y, color.RGBA{R: 0x00, G: 0x7a, B: 0xcc, A: 0xff})
+      }
+    }
+  }
+  var encoded bytes.Buffer
+  png.Encode(&encoded, img)
+
+  var ico bytes.Buffer
+  // ICONDIR: reserved, type 1 (icon), one image.
+  binary.Write(&ico, binary.LittleEndian, [3]uint16{0, 1, 1})
+  // ICONDIRENTRY: 16x16, no palette, reserved, 1 plane, 32 bits per pixel, data size and offset.
+  ico.Write([]byte{16, 16, 0, 0})
+  binary.Write(&ico, binary.LittleEndian, [2]uint16{1, 32})
+  binary.Write(&ico, binary.LittleEndian, [2]uint32{uint32(encoded.Len()), 6 + 16})
+  ico.Write(encoded.Bytes())
+  return ico.Bytes()
+})
+
+// sendFavicon answers a favicon request the roots could not serve, as configured by -favicon.
+func sendFavicon(conn net.Conn, req *request) {
+  switch favicon {
+  case "none":
+    writeResponseHeader(conn, 204, "No Content", responseHeader{})
+  case "default":
+    body := defaultFavicon()
+    header := responseHeader{}
+    header.set("Content-Type", "image/x-icon")
+    header.set("Content-Length", strconv.Itoa(len(body)))
+    header.set("Cache-Control", "max-age=86400")
+    writeResponseHeader(conn, 200, "OK", header)
+    conn.Write(body)
+  default:
+    sendFile(conn, req, favicon)
+  }
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+  "bytes"
+  "image/png"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+func useFavicon(t *testing.T, value string) {
+  original := favicon
+  favicon = value
+  t.Cleanup(func() { favicon = original })
+}
+
+func TestFavicon(t *testing.T) {
+  tempDir := t.TempDir()
+  iconDir := t.TempDir()
+  writeTestFiles(t, iconDir, map[string]string{"custom.ico": "custom icon"})
+  useRoots(t, tempDir)
+
+  testCases := []struct {
+    name         string
+    favicon      string
+    expectedCode string
+    expectedBody string
+  }{
+    {"Unset", "", "HTTP/1.1 404 Not Found", "Not Found"},
+    {"None", "none", "HTTP/1.1 204 No Content", ""},
+    {"Custom file", filepath.Join(iconDir, "custom.ico"), "HTTP/1.1 200 OK", "custom icon"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      useFavicon(t, tc.favicon)
+      conn := newMockConn("GET /favicon.ico HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+      response := conn.GetWrittenData()
+
+      if !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+      if _, body, _ := strings.Cut(response, "\r\n\r\n"); body != tc.expectedBody {
+        t.Errorf("Expected body %q, got %q", tc.expectedBody, body)
+      }
+    })
+  }
+}
+
+func TestDefaultFavicon(t *testing.T) {
+  useRoots(t, t.TempDir())
+  useFavicon(t, "default")
+
+  conn := newMockConn("GET /favicon.ico HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+  headers, body, _ := strings.Cut(conn.GetWrittenData(), "\r\n\r\n")
+
+  if !strings.HasPrefix(headers, "HTTP/1.1 200 OK") || !strings.Contains(headers, "Content-Type: image/x-icon") {
+    t.Fatalf("Expected a 200 image/x-icon response, got: %s", headers)
+  }
+  if !bytes.HasPrefix([]byte(body), []byte{0, 0, 1, 0, 1, 0}) {
+    t.Fatalf("Expected an ICO header, got: %q", body[:min(len(body), 6)])
+  }
+  if _, err := png.Decode(strings.NewReader(body[22:])); err != nil {
+    t.Errorf("Expected the icon to hold a PNG image: %v", err)
+  }
+}
+
+func TestFaviconFromRootWins(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"favicon.ico": "site icon"})
+  useRoots(t, tempDir)
+  useFavicon(t, "default")
+
+  conn := newMockConn("GET /favicon.ico HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+  if _, body, _ := strings.Cut(conn.GetWrittenData(), "\r\n\r\n"); body != "site icon" {
+    t.Errorf("Expected the root's favicon.ico, got %q", body)
+  }
+}
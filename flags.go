@@ -0,0 +1,54 @@
+package main
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+)
+
+// byteSize is a flag holding a number of bytes, accepting an optional
+// KB, MB, GB or TB suffix (powers of 1024), e.g. "64MB".
+type byteSize int64
+
+var byteUnits = []struct {
+  suffix     string
+  multiplier int64
+}{
+  {"TB", 1 << 40},
+  {"GB", 1 << 30},
+  {"MB", 1 << 20},
+  {"KB", 1 << 10},
+  {"B", 1},
+}
+
+func parseByteSize(value string) (int64, error) {
+  number, multiplier := strings.ToUpper(strings.TrimSpace(value)), int64(1)
+  for _, unit := range byteUnits {
+    if trimmed, found := strings.CutSuffix(number, unit.suffix); found {
+      number, multiplier = strings.TrimSpace(trimmed), unit.multiplier
+      break
+    }
+  }
+
+  n, err := strconv.ParseInt(number, 10, 64)
+  if err != nil || n < 0 {
+    return 0, fmt.Errorf("invalid size %q", value)
+  }
+  if n > (1<<63-1)/multiplier {
+    return 0, fmt.Errorf("size %q is too large", value)
+  }
+  return n * multiplier, nil
+}
+
+func (b *byteSize) String() string {
+  return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(value string) error {
+  n, err := parseByteSize(value)
+  if err != nil {
+    return err
+  }
+  *b = byteSize(n)
+  return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+  testCases := []struct {
+    value       string
+    expected    int64
+    shouldError bool
+  }{
+    {value: "0", expected: 0},
+    {value: "512", expected: 512},
+    {value: "4KB", expected: 4 << 10},
+    {value: "64mb", expected: 64 << 20},
+    {value: "10 GB", expected: 10 << 30},
+    {value: "1TB", expected: 1 << 40},
+    {value: "-1", shouldError: true},
+    {value: "lots", shouldError: true},
+    {value: "99999999TB", shouldError: true},
+  }
+
+  for _, tc := range testCases {
+    got, err := parseByteSize(tc.value)
+    if tc.shouldError {
+      if err == nil {
+        t.Errorf("Expected error for %q", tc.value)
+      }
+      continue
+    }
+    if err != nil || got != tc.expected {
+      t.Errorf("parseByteSize(%q) = %d, %v; expected %d", tc.value, got, err, tc.expected)
+    }
+  }
+}
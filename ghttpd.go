@@ -2,109 +2,684 @@ package main
 
 import (
   "bufio"
+  "bytes"
+  "crypto/tls"
   "errors"
   "flag"
   "fmt"
+  "html"
   "io"
+  "io/fs"
   "log"
-  "mime"
   "net"
   "net/url"
   "os"
+  "os/signal"
   "path/filepath"
   "runtime"
+  "strconv"
   "strings"
+  "sync"
+  "syscall"
   "time"
 )
 
+// rootList is a repeatable flag holding the document roots, tried in order.
+type rootList []string
+
+func (r *rootList) String() string {
+  return strings.Join(*r, ",")
+}
+
+func (r *rootList) Set(value string) error {
+  *r = append(*r, value)
+  return nil
+}
+
 var (
   port string
-	dir string
+  roots rootList
+  mergeListings bool
+  listingSort listingOrder
   workers int
+  tlsCert string
+  tlsKey string
+  logFormat string
+  logTLS bool
+  mimeTypesFile string
+  shutdownTimeout time.Duration
+  stripPrefix string
+  defaultType = "application/octet-stream"
+  serverTiming bool
+  cacheSize byteSize
+  cacheMaxFile = byteSize(1 << 20)
+  tcpNoDelay = true
+  rawPaths bool
+  http09 bool
 )
 
+// http09Version is the version given to HTTP/0.9 simple requests, which carry none.
+const http09Version = "HTTP/0.9"
+
 func main() {
 
   flag.StringVar(&port, "p", "8080", "Server port")
-  flag.StringVar(&dir, "d", ".", "Directory to serve")
+  flag.Var(&roots, "d", "Directory to serve (repeat to add fallback roots, tried in order)")
+  flag.StringVar(&archivePath, "archive", "", "Serve files from a .zip, .tar, .tar.gz or .tgz archive instead of -d")
+  flag.BoolVar(&rawPaths, "raw-paths", false, "Use request paths as received, without percent-decoding (for proxies that already decode them)")
+  flag.BoolVar(&http09, "http09", false, "Answer HTTP/0.9 simple requests (\"GET /path\" without a version) with the bare body instead of 400")
+  flag.StringVar(&stripPrefix, "strip-prefix", "", "URL path prefix removed before mapping requests to files; other paths get 404")
+  flag.StringVar(&baseHref, "base-href", "", "Set the <base href> of served HTML pages: auto (from -strip-prefix and -mount) or a fixed path or URL")
+  flag.StringVar(&trailingDots, "trailing-dots", trailingDots, "Path segments ending in dots or spaces, which Windows ignores: reject (400), strip or allow")
+  flag.BoolVar(&sitemapEnabled, "sitemap", false, "Serve a generated /sitemap.xml of all files when the roots do not contain one")
+  flag.Var(&directorySteps, "directory-strategy", "Comma separated steps tried in order for directory requests: index, spa, listing; none applying answers 403")
+  flag.Var(&mounts, "mount", "Serve a URL prefix from its own directory, as /prefix=dir[;strategy=steps][;index=file][;read-only] (repeatable)")
+  flag.StringVar(&indexFile, "index", indexFile, "Index file served by the index and spa directory steps")
+  flag.StringVar(&mobileIndex, "mobile-index", "", "Index file variant served instead to mobile User-Agents, e.g. index.mobile.html")
+  flag.Var(&mobilePatterns, "mobile-pattern", "Regular expression matching mobile User-Agents for -mobile-index (repeatable; replaces the built-in check)")
+  flag.IntVar(&listingMaxDepth, "listing-max-depth", 0, "Skip the listing step for directories deeper than this many path segments (0 for no limit)")
+  flag.StringVar(&favicon, "favicon", "", "Answer a missing /favicon.ico with default (built-in icon), none (204) or the named icon file; unset answers 404")
+  flag.BoolVar(&mergeListings, "merge-listings", false, "Merge directory listings across all document roots instead of showing the first match")
+  flag.StringVar(&listingFormat, "listing-format", listingFormat, "Directory listing format: auto (negotiated from Accept), html, json or text")
+  flag.IntVar(&listingNameMax, "listing-name-max", 0, "Truncate names longer than this many characters in HTML listings (0 shows full names)")
+  flag.BoolVar(&listingSummary, "listing-summary", false, "Show the number of files and subdirectories and the total file size above HTML listings")
+  flag.BoolVar(&listingDetails, "listing-details", false, "Show modification times and file sizes in HTML listings")
+  flag.StringVar(&listingDateFormat, "listing-date-format", listingDateFormat, "Go time layout for modification times in HTML listings, e.g. 2006-01-02T15:04:05Z07:00 for RFC 3339")
+  flag.StringVar(&listingTimezone, "listing-timezone", listingTimezone, "Timezone of listing modification times: Local, UTC or an IANA name such as Europe/Rome")
+  flag.StringVar(&listingTheme, "listing-theme", "", "Built-in CSS theme for HTML listings: light or dark (unset leaves them unstyled)")
+  flag.StringVar(&listingCSSFile, "listing-css", "", "CSS file embedded in HTML listings after the -listing-theme styles")
+  flag.StringVar(&listingFooter, "listing-footer", "", "HTML inserted as-is after the entries of HTML listings")
+  flag.StringVar(&listingFooterFile, "listing-footer-file", "", "File holding the HTML inserted after the entries of HTML listings")
+  flag.Var(&listingSort, "listing-sort", "Default listing order: comma separated dirs-first, case-insensitive, natural")
   flag.IntVar(&workers, "w", runtime.NumCPU(), "Number of workers")
+  flag.IntVar(&maxQueue, "max-queue", 0, "Connections allowed to wait for a busy worker before new ones get 503 (0 waits for a worker)")
+  flag.IntVar(&maxConnsPerIP, "max-conns-per-ip", 0, "Simultaneous connections allowed from one address before new ones get 429 (0 is unlimited)")
+  flag.DurationVar(&keepAliveTimeout, "keepalive-timeout", 0, "Idle time allowed between requests on a persistent HTTP/1.1 connection (0 closes after each response)")
+  flag.IntVar(&maxKeepAliveRequests, "max-keepalive-requests", 100, "Requests served on a persistent connection before it is closed (0 for no limit)")
+  flag.BoolVar(&tcpNoDelay, "tcp-nodelay", tcpNoDelay, "Set TCP_NODELAY on accepted connections (disable to let Nagle's algorithm batch small writes)")
+  flag.StringVar(&tlsCert, "tls-cert", "", "TLS certificate file (enables HTTPS together with -tls-key)")
+  flag.StringVar(&tlsKey, "tls-key", "", "TLS private key file")
+  flag.StringVar(&tlsPort, "tls-port", "", "Serve HTTPS on this port while -p serves plaintext (requires -tls-cert and -tls-key)")
+  flag.BoolVar(&redirectHTTPS, "redirect-https", false, "Redirect plaintext requests to the -tls-port listener with 301")
+  flag.BoolVar(&secureHeaders, "secure-headers", false, "Add recommended security headers (nosniff, frame denial, referrer policy, CSP on listings) to all responses")
+  flag.Var(&preloads, "preload", "\"/page.html=/asset.css,/asset.js\" assets announced with Link: rel=preload on that HTML page (repeatable)")
+  flag.Var(&customHeaders, "header", "Extra \"Name: value\" response header, overriding -secure-headers (repeatable)")
+  flag.BoolVar(&healthChecks, "health-checks", false, "Serve /healthz (liveness) and /readyz (readiness) endpoints")
+  flag.BoolVar(&metricsEnabled, "metrics", false, "Serve Prometheus metrics at /metrics")
+  flag.Var(&speedtestMax, "speedtest-max", "Serve /__speedtest?size=N, streaming up to this many bytes (e.g. 100MB) for throughput tests; 0 disables it")
+  flag.StringVar(&configEndpointAuth, "config-endpoint-auth", "", "Serve the effective routing configuration as JSON at /__config to the users of this htpasswd file")
+  flag.IntVar(&statsPaths, "stats-paths", 0, "Count hits for up to this many request paths and serve the most requested at /stats (0 disables)")
+  flag.DurationVar(&statsInterval, "stats-interval", 0, "Log the number of active connections at this interval (0 disables)")
+  flag.BoolVar(&serverTiming, "server-timing", false, "Add a Server-Timing header with parse, stat and read durations")
+  flag.Var(&allowPatterns, "allow", "Regular expression a request path must match to be served (repeatable; any match allows)")
+  flag.Var(&agentRules, "user-agent-rule", "pattern=block refuses requests whose User-Agent matches pattern; pattern=/prefix serves them from under /prefix (repeatable; first match applies)")
+  flag.Var(&denyPatterns, "deny", "Regular expression of request paths answered with 403 (repeatable; checked before -allow)")
+  flag.Var(&trustedProxies, "trusted-proxies", "Comma separated proxy CIDRs whose Forwarded/X-Forwarded-For headers are trusted for the client address")
+  flag.StringVar(&trustedProxyHeader, "trusted-proxy-header", "", "Header, e.g. X-Forwarded-Proto, giving the original scheme of requests from -trusted-proxies")
+  flag.Var(&currentLogLevel, "log-level", "Log level: error, info or debug (debug adds per-worker messages)")
+  flag.StringVar(&accessLogPath, "access-log", "", "Append access logs to this file instead of stderr (reopened on SIGHUP)")
+  flag.BoolVar(&logErrorsOnly, "log-requests-only-errors", false, "Only write access log entries for 4xx and 5xx responses")
+  flag.StringVar(&logFormat, "log-format", "text", "Access log format: text or json")
+  flag.BoolVar(&logTLS, "log-tls", false, "Include negotiated TLS version and cipher suite in access logs")
+  flag.Var(&dispositionRules, "disposition", "Comma separated pattern=inline|attachment rules; patterns are extensions (.zip) or content types (image/*)")
+  flag.StringVar(&defaultType, "default-type", defaultType, "Content-Type for files with an unknown extension")
+  flag.Var(&magicSignatures, "magic", "Comma separated [offset:]hex=content/type file signatures for files with unknown extensions (repeatable)")
+  flag.StringVar(&mimeTypesFile, "mime-types", "", "mime.types style file with content type overrides (reloaded on SIGHUP)")
+  flag.DurationVar(&exitOnIdle, "exit-on-idle", 0, "Shut down gracefully once no connection has arrived for this long (0 runs until signaled)")
+  flag.IntVar(&exitAfterConnections, "exit-after-connections", 0, "Shut down gracefully after accepting this many connections (0 runs until signaled)")
+  flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "Maximum time to wait for in-flight requests on shutdown")
+  flag.StringVar(&etagMode, "etag", etagMode, "ETag source: weak (size and modification time) or strong (SHA-256 of the content, cached per file)")
+  flag.BoolVar(&webdavEnabled, "webdav", false, "Answer OPTIONS and PROPFIND so WebDAV clients can mount the roots read-only")
+  flag.BoolVar(&serverOptions, "server-options", true, "Answer \"OPTIONS *\" with the methods and features the server supports")
+  flag.BoolVar(&checksumsEnabled, "checksums", false, "Answer ?checksum=sha256 or ?checksum=md5 with the file's digest instead of its content")
+  flag.BoolVar(&uploadsEnabled, "upload", false, "Accept PUT requests storing files under the first -d directory")
+  flag.Var(&maxUploadSize, "max-upload-size", "Largest PUT body accepted; larger uploads get 413")
+  flag.Var(&byteQuota, "quota", "Bytes that may be sent, e.g. 10GB, before requests get 503 until the quota resets (0 for no quota)")
+  flag.DurationVar(&quotaInterval, "quota-reset", 0, "Period after which the -quota starts over, e.g. 720h (0 resets only on SIGHUP)")
+  flag.StringVar(&maintenanceFile, "maintenance-file", "", "While this file exists, content requests are answered with 503 (checked at most once a second)")
+  flag.StringVar(&maintenancePageFile, "maintenance-page", "", "HTML file sent with the 503 responses of -maintenance-file")
+  flag.StringVar(&sendfileHeader, "sendfile-header", "", "Answer file requests with this header, X-Sendfile or X-Accel-Redirect, and no body, for a proxy to serve the file")
+  flag.BoolVar(&gzipEnabled, "gzip", false, "Compress text-like files with gzip for clients that accept it")
+  flag.BoolVar(&precompressed, "precompressed", false, "Serve file.br or file.gz in place of file to clients accepting that encoding")
+  flag.BoolVar(&caseInsensitive, "case-insensitive", false, "On a miss, serve the file whose path matches the request ignoring case (scans directories; matches are cached)")
+  flag.Var(&redirects, "redirect", "A /old=/new or /old=https://host/new redirect, 301 unless followed by \" 302\"; a trailing / moves a whole directory; repeatable")
+  flag.Var(&extensionAliases, "ext-alias", "Serve requests for one extension from the file with another under a fixed type, e.g. .txt=.json:text/plain (repeatable)")
+  flag.Var(&tryExtensions, "try-extensions", "Comma separated extensions tried in order when a request path matches nothing, e.g. .html,.htm")
+  flag.Var(&allowedExtensions, "allowed-ext", "Comma separated extensions, e.g. .css,.js,.png, that files must have to be served; others get 403 (empty serves everything)")
+  flag.Var(&gzipTypes, "gzip-types", "Comma separated content type prefixes compressed by -gzip, replacing the defaults")
+  flag.IntVar(&gzipLevel, "gzip-level", gzipLevel, "gzip compression level from 1 (fastest) to 9 (smallest)")
+  flag.Var(&bufferSize, "buffer-size", "Size of the pooled buffers response bodies are copied through")
+  flag.Var(&readBufferSize, "read-buffer-size", "Size of the pooled connection read buffers, up to -max-header-size; longer header lines are read in pieces")
+  flag.Var(&maxHeaderBytes, "max-header-size", "Largest request line and header fields accepted together before answering 431")
+  flag.Var(&cacheSize, "cache-size", "Memory for caching file contents, e.g. 64MB (0 disables the cache)")
+  flag.Var(&cacheMaxFile, "cache-max-file", "Largest file kept in the content cache")
+  flag.StringVar(&cpuProfile, "cpu-profile", "", "Write a CPU profile covering the whole run to this file, flushed on shutdown")
+  flag.StringVar(&memProfile, "mem-profile", "", "Write a heap profile to this file on shutdown")
+  flag.StringVar(&configPath, "config", "", "JSON config file keyed by flag name; command-line flags override it")
   flag.Parse()
 
-  if _, err := os.Stat(dir); os.IsNotExist(err) {
-		log.Fatalf("Error: directory %s does not exist\n", dir)
+  flag.Visit(func(f *flag.Flag) { cliFlags[f.Name] = true })
+  if configPath != "" {
+    values, err := readConfigFile(configPath)
+    if err == nil {
+      err = applyConfig(flag.CommandLine, values, cliFlags)
+      configValues = values
+    }
+    if err != nil {
+      log.Fatalf("Error: %v", err)
+    }
   }
 
-  listener, err := net.Listen("tcp", ":"+port)
+  if err := validateLogFormat(logFormat); err != nil {
+    log.Fatalf("Error: %v", err)
+  }
+
+  if err := validateListingFormat(listingFormat); err != nil {
+    log.Fatalf("Error: %v", err)
+  }
+
+  if err := validateTrailingDots(trailingDots); err != nil {
+    log.Fatalf("Error: %v", err)
+  }
+
+  if err := validateETagMode(etagMode); err != nil {
+    log.Fatalf("Error: %v", err)
+  }
+
+  if err := validateGzipLevel(gzipLevel); err != nil {
+    log.Fatalf("Error: %v", err)
+  }
+
+  if err := loadListingTimezone(); err != nil {
+    log.Fatalf("Error: %v", err)
+  }
+
+  if err := loadListingStyle(); err != nil {
+    log.Fatalf("Error: %v", err)
+  }
+
+  if err := loadListingFooter(); err != nil {
+    log.Fatalf("Error: %v", err)
+  }
+
+  if err := validateFavicon(favicon); err != nil {
+    log.Fatalf("Error: %v", err)
+  }
+
+  if err := loadMaintenancePage(); err != nil {
+    log.Fatalf("Error: %v", err)
+  }
+
+  if err := validateBaseHref(baseHref); err != nil {
+    log.Fatalf("Error: %v", err)
+  }
+
+  if err := validateReadBuffer(); err != nil {
+    log.Fatalf("Error: %v", err)
+  }
+
+  header, err := validateSendfileHeader(sendfileHeader)
   if err != nil {
-		log.Fatalf("Error starting server: %v", err)
+    log.Fatalf("Error: %v", err)
   }
-  defer listener.Close()
+  sendfileHeader = header
 
-  log.Println("Listening on port " + port)
+  if accessLogPath != "" {
+    file, err := openLogFile(accessLogPath)
+    if err != nil {
+      log.Fatalf("Error: %v", err)
+    }
+    accessLogFile = file
+    accessLog = log.New(file, "", log.LstdFlags)
+  }
 
-  connChan := make(chan net.Conn)
+  if len(roots) == 0 {
+    roots = rootList{"."}
+  }
 
-  for i := range workers {
-    go func(workerID int) {
-      for conn := range connChan {
-          log.Printf("Worker %d: handling connection", workerID)
-          handleConnection(conn)
-      }
-    }(i)
+  if archivePath != "" {
+    archive, err := openArchive(archivePath)
+    if err != nil {
+      log.Fatalf("Error: %v", err)
+    }
+    activeArchive = archive
+  }
+
+  for _, dir := range roots {
+    if _, err := os.Stat(dir); os.IsNotExist(err) && activeArchive == nil {
+      log.Fatalf("Error: directory %s does not exist\n", dir)
+    }
+  }
+  if err := validateMounts(); err != nil {
+    log.Fatalf("Error: %v", err)
+  }
+
+  if statsPaths > 0 {
+    pathHits = newPathCounter(statsPaths)
   }
-  
-  for {
 
-    conn, err := listener.Accept()
-    conn.SetDeadline(time.Now().Add(5 * time.Second))
+  if cacheSize > 0 {
+    contentCache = newFileCache(int64(cacheSize), int64(cacheMaxFile))
+  }
+
+  if err := reloadSettings(); err != nil {
+    log.Fatalf("Error: %v", err)
+  }
+  watchReload()
+
+  listener, err := net.Listen("tcp", ":"+port)
+  if err != nil {
+    log.Fatalf("Error: %v", bindError(port, "p", err))
+  }
+
+  if redirectHTTPS && tlsPort == "" && trustedProxyHeader == "" {
+    log.Fatalf("Error: -redirect-https requires -tls-port or -trusted-proxy-header")
+  }
+
+  // Without -tls-port a certificate turns the -p listener into HTTPS; with it, -p stays plaintext.
+  var tlsListener net.Listener
+  if tlsCert != "" || tlsKey != "" || tlsPort != "" {
+    tlsConfig, err := loadTLSConfig(tlsCert, tlsKey)
     if err != nil {
       log.Fatalf("Error: %v", err)
-      return
     }
-    connChan <- conn
+    if tlsPort == "" {
+      listener = tls.NewListener(listener, tlsConfig)
+    } else {
+      plain, err := net.Listen("tcp", ":"+tlsPort)
+      if err != nil {
+        log.Fatalf("Error: %v", bindError(tlsPort, "tls-port", err))
+      }
+      tlsListener = tls.NewListener(plain, tlsConfig)
+    }
+  }
+
+  tlsAddr := ""
+  if tlsListener != nil {
+    tlsAddr = tlsListener.Addr().String()
+  }
+  log.Println("Listening on port " + port)
+  log.Println("Configuration: " + configSummary(listener.Addr().String(), tlsAddr))
+
+  stopProfiling, err := startProfiling()
+  if err != nil {
+    log.Fatalf("Error: %v", err)
+  }
+
+  server := NewServer(listener, workers)
+  if tlsListener != nil {
+    log.Println("Listening for HTTPS on port " + tlsPort)
+    server.AddListener(tlsListener)
+  }
+
+  if statsInterval > 0 {
+    go logStats(statsInterval, server.Done())
+  }
+
+  go func() {
+    signals := make(chan os.Signal, 1)
+    signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+    <-signals
+
+    log.Println("Shutting down, waiting for in-flight requests")
+    server.Shutdown(shutdownTimeout)
+  }()
+
+  if err := server.Run(); err != nil {
+    stopProfiling()
+    log.Fatalf("Error: %v", err)
   }
+  <-server.Done()
+  stopProfiling()
+}
+
+// request holds the parsed request line and header fields of an HTTP request.
+type request struct {
+  method  string
+  path    string
+  query   url.Values
+  version string
+  headers map[string]string
+
+  // rawQuery is the query string as received, for redirects to repeat it unchanged.
+  rawQuery string
+
+  // body reads the request body, which follows the header on the connection.
+  body io.Reader
+
+  // prefix is the part of the request path stripped by -strip-prefix; path holds the remainder.
+  prefix string
+
+  // vary lists request header fields, besides Accept-Encoding, the response was chosen by.
+  vary []string
+
+  // contentType, when set by -ext-alias, replaces the Content-Type derived from the file.
+  contentType string
+  // settings holds the reloadable settings the request is served with; see config.
+  settings *settings
+}
+
+// header returns the value of the named header field, matched case-insensitively.
+func (r *request) header(name string) string {
+  return r.headers[strings.ToLower(name)]
 }
 
 func handleConnection(conn net.Conn) {
 
+  activeConnections.Add(1)
+  totalConnections.Add(1)
+  defer activeConnections.Add(-1)
   defer conn.Close()
 
-  method, path, version, err := parseRequest(conn)
+  if !handshake(conn) {
+    return
+  }
 
-  if err != nil {
-    log.Printf("Error parsing request: %v", err)
-    sendError(conn, 400, "Bad Request")
+  // A single reader spans all requests on the connection, so pipelined bytes are not lost.
+  reader := getReader(conn)
+  defer putReader(reader)
+
+  for served := 0; served == 0 || awaitNextRequest(conn, reader); served++ {
+
+    rc := newResponseConn(conn)
+    req, err := parseRequest(reader)
+
+    if err == io.EOF {
+      debugf("Client closed the connection")
+      return
+    }
+    if err != nil {
+      log.Printf("Error parsing request: %v", err)
+      var statusErr *statusError
+      if errors.As(err, &statusErr) {
+        sendError(rc, statusErr.code, statusErr.message)
+        return
+      }
+      sendError(rc, 400, "Bad Request")
+      return
+    }
+
+    rc.settings = req.config()
+    rc.closeAfter = !wantsKeepAlive(req) || (maxKeepAliveRequests > 0 && served+1 >= maxKeepAliveRequests)
+    rc.head = req.method == "HEAD"
+    rc.simple = req.version == http09Version
+    rc.recordTiming("parse", rc.start)
+    handleRequest(rc, req)
+    logRequest(rc, req)
+    recordServed(rc.written)
+    pathHits.record(req.prefix + req.path)
+
+    if rc.closeAfter {
+      return
+    }
+  }
+}
+
+func handleRequest(conn net.Conn, req *request) {
+
+  if isHTTP2Preface(req) {
+    sendError(conn, 505, "HTTP Version Not Supported")
     return
   }
 
-  log.Printf("New Request [Method: %s, Path: %s, Version: %s]", method, path, version)
+  if isAsteriskForm(req) {
+    handleAsterisk(conn, req)
+    return
+  }
 
-  if err := validateRequest(method, version); err != nil {
+  if err := validateRequest(req.method, req.version); err != nil {
+    drainRejectedBody(req)
+    var statusErr *statusError
+    if errors.As(err, &statusErr) {
+      sendErrorWithHeader(conn, statusErr.code, statusErr.message, statusErr.header)
+      return
+    }
     sendError(conn, 400, err.Error())
     return
   }
-  
-  serveResource(conn, path)
-}
 
-func serveResource(conn net.Conn, path string) {
+  if handler := internalEndpoint(req.path); handler != nil {
+    handler(conn, req)
+    return
+  }
 
-  fullPath := filepath.Join(dir, path)
-  fileInfo, err := os.Stat(fullPath)
-  
-  if os.IsNotExist(err) {
+  if inMaintenance() {
+    sendMaintenance(conn)
+    return
+  }
+
+  if exceeded, retryAfter := quotaExceeded(); exceeded {
+    sendQuotaExceeded(conn, retryAfter)
+    return
+  }
+
+  if redirectHTTPS && requestScheme(conn, req) != "https" {
+    sendHTTPSRedirect(conn, req)
+    return
+  }
+
+  if !stripRequestPrefix(req, stripPrefix) {
     sendError(conn, 404, "Not Found")
     return
-  } else if err != nil {
-    sendError(conn, 500, "Internal Server Error")
+  }
+
+  urlPath, ok := applyTrailingDots(req.path)
+  if !ok || !portablePath(urlPath) {
+    sendError(conn, 400, "Bad Request")
     return
   }
+  req.path = urlPath
 
-  if fileInfo.IsDir() {
-    generateDirectoryListing(conn, path, fullPath)
-  } else {
-    sendFile(conn, fullPath)
+  if !applyUserAgentRules(req) || !pathPermitted(req.path) {
+    sendError(conn, 403, "Forbidden")
+    return
+  }
+
+  if activeArchive == nil && !authorized(req, req.path) {
+    sendUnauthorized(conn)
+    return
+  }
+
+  switch req.method {
+  case "OPTIONS":
+    sendDAVOptions(conn)
+    return
+  case "PROPFIND":
+    handlePropfind(conn, req)
+    return
+  }
+
+  if req.method == "PUT" {
+    handleUpload(conn, req)
+    return
+  }
+
+  serveResource(conn, req)
+}
+
+func serveResource(conn net.Conn, req *request) {
+
+  if serveRedirect(conn, req) {
+    return
+  }
+
+  if activeArchive != nil {
+    activeArchive.serve(conn, req)
+    return
+  }
+
+  if serveAlias(conn, req) {
+    return
+  }
+
+  statStart := time.Now()
+  file, dirs, err := locateResource(req.path)
+  if errors.Is(err, fs.ErrNotExist) && caseInsensitive {
+    if matched, ok := matchPathCase(req.path); ok {
+      if !servedPathAllowed(conn, req, matched) {
+        return
+      }
+      file, dirs, err = locateResource(matched)
+    }
+  }
+  if errors.Is(err, fs.ErrNotExist) && len(tryExtensions) > 0 {
+    if found, foundPath, extErr := locateWithExtension(req.path); !errors.Is(extErr, fs.ErrNotExist) {
+      if extErr == nil && !servedPathAllowed(conn, req, foundPath) {
+        return
+      }
+      file, err = found, extErr
+    }
+  }
+  recordTiming(conn, "stat", statStart)
+
+  if errors.Is(err, fs.ErrNotExist) && !rootsAvailable() {
+    sendError(conn, 503, "Service Unavailable")
+    return
+  }
+
+  if errors.Is(err, fs.ErrNotExist) && sitemapEnabled && req.path == sitemapPath {
+    sendSitemap(conn, req)
+    return
+  }
+
+  if errors.Is(err, fs.ErrNotExist) && favicon != "" && req.path == faviconPath {
+    sendFavicon(conn, req)
+    return
   }
+
+  if err != nil {
+    sendFSError(conn, err)
+    return
+  }
+
+  if file != "" {
+    sendFile(conn, req, file)
+    return
+  }
+
+  serveDirectory(conn, req, dirs)
+}
+
+// locateResource resolves a request path against the document roots in order, or against the
+// directory of the -mount it falls under. It returns the
+// first regular file found, or the directories backing the path: only the first one unless
+// -merge-listings is set. Paths hidden by a .ghttpdignore file are skipped in that root.
+// fs.ErrNotExist is returned when no root contains the path.
+func locateResource(urlPath string) (string, []string, error) {
+
+  var dirs []string
+
+  searchRoots, urlPath := rootsFor(urlPath)
+  for _, root := range searchRoots {
+    if pathIgnored(root, cleanURLPath(urlPath)) {
+      continue
+    }
+
+    fullPath := resolvePath(root, urlPath)
+    fileInfo, err := os.Stat(fullPath)
+
+    if os.IsNotExist(err) {
+      continue
+    } else if err != nil {
+      return "", nil, err
+    }
+
+    // Opening a FIFO or device could block a worker or stream endlessly, so only regular files are served.
+    if !fileInfo.IsDir() && !fileInfo.Mode().IsRegular() {
+      return "", nil, fmt.Errorf("%s is not a regular file: %w", fullPath, fs.ErrPermission)
+    }
+
+    if !fileInfo.IsDir() {
+      if len(dirs) == 0 {
+        return fullPath, nil, nil
+      }
+      continue
+    }
+
+    dirs = append(dirs, fullPath)
+    if !mergeListings {
+      break
+    }
+  }
+
+  if len(dirs) == 0 {
+    return "", nil, fs.ErrNotExist
+  }
+  return "", dirs, nil
+}
+
+var (
+  missingRootsMu sync.Mutex
+  missingRoots = map[string]bool{}
+)
+
+// rootsAvailable re-stats every document root and reports whether all of them exist.
+// A root disappearing or coming back is logged once per transition.
+func rootsAvailable() bool {
+  missingRootsMu.Lock()
+  defer missingRootsMu.Unlock()
+
+  available := true
+  for _, root := range roots {
+    info, err := os.Stat(root)
+    missing := err != nil || !info.IsDir()
+
+    if missing && !missingRoots[root] {
+      log.Printf("Error: document root %s is no longer available, answering 503", root)
+    } else if !missing && missingRoots[root] {
+      log.Printf("Document root %s is available again", root)
+    }
+
+    missingRoots[root] = missing
+    available = available && !missing
+  }
+  return available
+}
+
+// stripRequestPrefix removes prefix from the request path, recording it in req.prefix.
+// It reports false when the path is not under prefix. An empty or "/" prefix matches everything.
+func stripRequestPrefix(req *request, prefix string) bool {
+  prefix = "/" + strings.Trim(prefix, "/")
+  if prefix == "/" {
+    return true
+  }
+
+  rest, found := strings.CutPrefix(req.path, prefix)
+  if !found || (rest != "" && !strings.HasPrefix(rest, "/")) {
+    return false
+  }
+
+  req.prefix, req.path = prefix, "/"+strings.TrimPrefix(rest, "/")
+  return true
+}
+
+// isHTTP2Preface reports whether req is the start of the HTTP/2 connection preface
+// ("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n") sent by clients using prior knowledge.
+func isHTTP2Preface(req *request) bool {
+  return req.method == "PRI" && req.path == "*" && strings.TrimSpace(req.version) == "HTTP/2.0"
+}
+
+// statusError is a request error answered with a specific status code and header fields.
+type statusError struct {
+  code    int
+  message string
+  header  responseHeader
+}
+
+func (e *statusError) Error() string {
+  return e.message
+}
+
+// allowedMethods lists the methods served, for Allow headers.
+func allowedMethods() string {
+  methods := "GET, HEAD"
+  if uploadsEnabled {
+    methods += ", PUT"
+  }
+  if webdavEnabled {
+    methods += ", OPTIONS, PROPFIND"
+  }
+  return methods
 }
 
 func validateRequest(method, version string) error {
@@ -112,14 +687,50 @@ func validateRequest(method, version string) error {
     return fmt.Errorf("invalid HTTP version")
   }
 
-  if method != "GET" {
+  // This is not a forward proxy, so tunnelling is refused explicitly.
+  if method == "CONNECT" {
+    return &statusError{code: 405, message: "Method Not Allowed", header: responseHeader{{name: "Allow", value: allowedMethods()}}}
+  }
+
+  switch {
+  case method == "GET" || method == "HEAD":
+  case method == "PUT" && uploadsEnabled:
+  case (method == "OPTIONS" || method == "PROPFIND") && webdavEnabled:
+  default:
     return fmt.Errorf("method not allowed")
   }
 
   return nil
 }
 
-// parseRequest reads the first line from the given connection, parses it, and returns the HTTP method, path, and version.
+// maxDrain bounds the body read and discarded from a rejected request. Closing a connection with
+// unread data makes the kernel reset it, which can destroy the error response before the client
+// reads it; bodies larger than this are left unread rather than tie up the worker.
+const maxDrain = 64 << 10
+
+// drainRejectedBody logs, at debug level, the body size a rejected request declared and discards
+// the body when it is small enough.
+func drainRejectedBody(req *request) {
+  if length := discardBody(req); length > 0 {
+    debugf("Rejected %s %s declared a %d byte body", req.method, req.path, length)
+  }
+}
+
+// discardBody reads and discards a request body of up to maxDrain bytes, returning the length the
+// request declared, or 0 when it declared none.
+func discardBody(req *request) int64 {
+  length, err := strconv.ParseInt(strings.TrimSpace(req.header("Content-Length")), 10, 64)
+  if err != nil || length <= 0 {
+    return 0
+  }
+  if req.body != nil && length <= maxDrain {
+    io.CopyN(io.Discard, req.body, length)
+  }
+  return length
+}
+
+// parseRequest reads the request line and header fields from the given reader and returns them as a request.
+// The reader is reused when it is already a *bufio.Reader, so any bytes after the header stay buffered there.
 // If the request is invalid, it returns an error instead.
 // HTTP Request e.g.:
 // GET /test HTTP/1.1
@@ -129,83 +740,568 @@ func validateRequest(method, version string) error {
 //
 // username=foo&password=bar
 //
-func parseRequest(conn net.Conn) (string, string, string, error) {
+func parseRequest(r io.Reader) (*request, error) {
 
-  firstLine, err := bufio.NewReader(conn).ReadString('\n')
-  if err != nil {
+  reader, ok := r.(*bufio.Reader)
+  if !ok {
+    reader = bufio.NewReader(r)
+  }
+
+  // A client closing before sending anything ends the connection cleanly; io.EOF reports that.
+  budget := int(maxHeaderBytes)
+  firstLine, err := readLine(reader, &budget)
+  if err == io.EOF && firstLine == "" {
+    return nil, io.EOF
+  } else if errors.Is(err, errHeaderTooLarge) {
+    return nil, err
+  } else if err != nil {
     log.Printf("Error: %v", err)
-    return "", "", "", errors.New("invalid request format")
+    return nil, errors.New("invalid request format")
   }
 
   parts := strings.Split(firstLine, " ")
+
+  // An HTTP/0.9 simple request is "GET /path" alone, without a version or header fields.
+  simple := http09 && len(parts) == 2 && parts[0] == "GET"
+  if simple {
+    parts = append(parts, http09Version)
+    parts[1] = strings.TrimRight(parts[1], "\r\n")
+  }
+
   if len(parts) != 3 {
     log.Printf("Error: Invalid request")
-    return "", "", "", fmt.Errorf("invalid Request line")
+    return nil, fmt.Errorf("invalid Request line")
   }
 
-  method, rawPath, version := parts[0], parts[1], parts[2]
+  method, target, version := parts[0], parts[1], parts[2]
+  rawPath, rawQuery, err := splitTarget(method, target)
+  if err != nil {
+    return nil, err
+  }
 
-  path, err := url.PathUnescape(rawPath)
+  // Behind a proxy that already decoded the path, decoding again would corrupt literal percent signs.
+  path := rawPath
+  if !rawPaths {
+    path, err = url.PathUnescape(rawPath)
+    if err != nil {
+      return nil, fmt.Errorf("invalid URL encoding")
+    }
+  }
+
+  // Control characters would end up verbatim in access logs and could split response headers.
+  if containsControl(method) || containsControl(path) || containsControl(strings.TrimRight(version, "\r\n")) {
+    return nil, fmt.Errorf("control character in request line")
+  }
+
+  query, err := url.ParseQuery(rawQuery)
   if err != nil {
-    return "", "", "", fmt.Errorf("invalid URL encoding")
+    return nil, fmt.Errorf("invalid query string")
+  }
+
+  headers := map[string]string{}
+  if !simple {
+    headers, err = readHeaders(reader, &budget)
+    if err != nil {
+      return nil, err
+    }
   }
 
-  return method, path, version, nil
+  return &request{method: method, path: path, query: query, rawQuery: rawQuery, version: version, headers: headers, body: reader}, nil
 }
 
-func sendFile(conn net.Conn, path string) {
-  
-  file, err := os.Open(path)
+// splitTarget returns the escaped path and the query of a request target. Targets are accepted in
+// origin form ("/path?query"), absolute form ("http://host/path?query", whose host is ignored),
+// asterisk form ("*") and, for CONNECT, authority form ("host:port"), which is refused later.
+// Anything else, such as a missing path, is rejected.
+func splitTarget(method, target string) (string, string, error) {
+  switch {
+  case strings.HasPrefix(target, "/"):
+    rawPath, rawQuery, _ := strings.Cut(target, "?")
+    return rawPath, rawQuery, nil
+  case target == "*":
+    return target, "", nil
+  case method == "CONNECT" && target != "":
+    return target, "", nil
+  }
+
+  u, err := url.ParseRequestURI(target)
+  if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+    return "", "", fmt.Errorf("invalid request target")
+  }
+  rawPath := u.EscapedPath()
+  if rawPath == "" {
+    rawPath = "/"
+  }
+  return rawPath, u.RawQuery, nil
+}
+
+// containsControl reports whether s holds an ASCII control character, such as CR, LF or NUL.
+func containsControl(s string) bool {
+  return strings.ContainsFunc(s, func(r rune) bool { return r < 0x20 || r == 0x7f })
+}
+
+// maxHeaderBytes bounds the request line and header fields of a request together.
+var maxHeaderBytes = byteSize(64 << 10)
+
+// validateReadBuffer checks that -read-buffer-size is usable and within -max-header-size, which
+// bounds how much of a request's header may be buffered anyway.
+func validateReadBuffer() error {
+  if readBufferSize < 16 || readBufferSize > maxHeaderBytes {
+    return fmt.Errorf("-read-buffer-size must be between 16B and the -max-header-size of %s, got %s", maxHeaderBytes.String(), readBufferSize.String())
+  }
+  return nil
+}
+
+var errHeaderTooLarge = &statusError{code: 431, message: "Request Header Fields Too Large"}
+
+// readLine reads up to and including the next newline, however many reads it arrives in, taking
+// its length from budget. Lines that would exceed the budget fail with errHeaderTooLarge; slow
+// clients are bounded by the connection deadline. Like ReadString, it returns the data read
+// together with io.EOF when the connection ends without a newline.
+func readLine(reader *bufio.Reader, budget *int) (string, error) {
+  var line []byte
+  for {
+    chunk, err := reader.ReadSlice('\n')
+    if len(line)+len(chunk) > *budget {
+      return "", errHeaderTooLarge
+    }
+    line = append(line, chunk...)
+    if err == bufio.ErrBufferFull {
+      continue
+    }
+    *budget -= len(line)
+    return string(line), err
+  }
+}
+
+// readHeaders reads header fields up to the blank line ending the header section.
+// Field names are lower-cased and repeated fields are joined with ", ".
+// A connection closed right after the request line is treated as a request without headers.
+func readHeaders(reader *bufio.Reader, budget *int) (map[string]string, error) {
+
+  headers := make(map[string]string)
+
+  for {
+    line, err := readLine(reader, budget)
+    if err == io.EOF && line == "" {
+      return headers, nil
+    } else if errors.Is(err, errHeaderTooLarge) {
+      return nil, err
+    } else if err != nil {
+      return nil, errors.New("invalid header format")
+    }
+
+    line = strings.TrimRight(line, "\r\n")
+    if line == "" {
+      return headers, nil
+    }
+
+    name, value, found := strings.Cut(line, ":")
+    if !found || name == "" || strings.TrimSpace(name) != name {
+      return nil, fmt.Errorf("invalid header line")
+    }
+
+    name, value = strings.ToLower(name), strings.TrimSpace(value)
+    if existing, ok := headers[name]; ok {
+      value = existing + ", " + value
+    }
+    headers[name] = value
+  }
+}
+
+func sendFile(conn net.Conn, req *request, path string) {
+
+  if !extensionAllowed(path) {
+    sendError(conn, 403, "Forbidden")
+    return
+  }
+
+  if wantsChecksum(req) {
+    sendChecksum(conn, req, path)
+    return
+  }
+
+  if sendfileHeader != "" {
+    sendInternalRedirect(conn, req, path)
+    return
+  }
+
+  readStart := time.Now()
+
+  // A precompressed sidecar stands in for the file; the response still describes the file.
+  openPath, v := path, variant{}
+  if precompressed {
+    openPath, v = selectSidecar(req, path)
+  }
+  file, err := os.Open(openPath)
+
+  // The file was found moments ago but may have been deleted or renamed since. A vanished
+  // sidecar leaves the file itself to serve; a vanished file is a 404, not a server error.
+  if errors.Is(err, fs.ErrNotExist) && openPath != path {
+    openPath, v = path, variant{}
+    file, err = os.Open(openPath)
+  }
+  if errors.Is(err, fs.ErrNotExist) {
+    debugf("%s vanished between stat and open", path)
+  }
 
   if err != nil {
-    sendError(conn, 500, "Internal Server Error")
+    sendFSError(conn, err)
     return
   }
 
   defer file.Close()
 
-  ext := filepath.Ext(path)
-  contentType := mime.TypeByExtension(ext)
+  info, err := file.Stat()
+  if err != nil {
+    sendError(conn, 500, "Internal Server Error")
+    return
+  }
+
+  // Cached and uncached files share the same path below, so ranges slice the cached bytes directly.
+  var content io.ReadSeeker = file
+  if data, ok := contentCache.get(openPath, info); ok {
+    content = bytes.NewReader(data)
+  } else if contentCache.fits(info.Size()) {
+    data, err := io.ReadAll(io.LimitReader(file, info.Size()))
+    if err != nil {
+      sendError(conn, 500, "Internal Server Error")
+      return
+    }
+    contentCache.put(openPath, info, data)
+    content = bytes.NewReader(data)
+  }
 
+  contentType := req.contentType
   if contentType == "" {
-    contentType = "application/octet-stream"
+    contentType = contentTypeFor(req, path)
   }
-
-  info, err := file.Stat()
+  sendInfo, content, err := rewriteBaseHref(req, contentType, info, content, v)
   if err != nil {
     sendError(conn, 500, "Internal Server Error")
     return
   }
-  
-  header := fmt.Sprintf(
-    "HTTP/1.1 200 OK\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n", contentType, info.Size())
-  conn.Write([]byte(header))
-  io.Copy(conn, file)
+
+  sendContent(conn, req, path, sendInfo, content, readStart, v)
 }
 
-func generateDirectoryListing(conn net.Conn, path string, fullPath string) {
+// variant describes which representation of a resource content holds.
+type variant struct {
+  // encoding is the Content-Encoding content is already stored in, or "" for the identity encoding.
+  encoding string
+  // vary is set when other encodings of the resource exist, so caches must key on Accept-Encoding.
+  vary bool
+}
+
+// sendContent sends a file's content, read from disk or another source, as the response to req.
+// Ranges are served when content can seek; other content is always sent whole.
+func sendContent(conn net.Conn, req *request, name string, info fs.FileInfo, content io.Reader, readStart time.Time, v variant) {
+
+  // Files with an unknown extension are identified by their leading bytes where possible.
+  // Encoded content says nothing about the type it decodes to, so it is not sniffed.
+  contentType := req.contentType
+  if contentType == "" {
+    contentType = contentTypeFor(req, name)
+  }
+  if contentType == "" && v.encoding == "" {
+    head, rest, err := peekHead(content)
+    if err != nil {
+      sendError(conn, 500, "Internal Server Error")
+      return
+    }
+    content, contentType = rest, sniffContentType(head)
+    // Extensionless files without a signature are often plain text, such as README or LICENSE.
+    if contentType == "" && filepath.Ext(name) == "" && looksLikeText(head, len(head) < sniffLen) {
+      contentType = "text/plain; charset=utf-8"
+    }
+  }
+  if contentType == "" {
+    contentType = defaultType
+  }
+
+  recordTiming(conn, "read", readStart)
+
+  // Ranges address the identity encoding, so range requests are never compressed.
+  varies := v.vary || (gzipEnabled && compressible(contentType))
+  compress := v.encoding == "" && gzipEnabled && compressible(contentType) && req.header("Range") == "" && acceptsGzip(req)
 
-  files, err := os.ReadDir(fullPath)
+  // Each encoding gets its own entity tag so caches never mix up the variants.
+  etag, err := contentETag(name+"\x00"+v.encoding, info, content)
   if err != nil {
     sendError(conn, 500, "Internal Server Error")
     return
   }
+  if compress {
+    etag = encodedETag(etag, "gzip")
+  } else if v.encoding != "" {
+    etag = encodedETag(etag, v.encoding)
+  }
+  if notModified(req, etag, info.ModTime()) {
+    send304(conn, etag, info.ModTime())
+    return
+  }
+
+  seeker, seekable := content.(io.ReadSeeker)
+
+  header := responseHeader{}
+  header.set("Content-Type", contentType)
+  if seekable {
+    header.set("Accept-Ranges", "bytes")
+  } else {
+    header.set("Accept-Ranges", "none")
+  }
+  header.set("ETag", etag)
+  header.set("Last-Modified", info.ModTime().UTC().Format(httpTimeFormat))
+  if disposition := contentDisposition(req, name, contentType); disposition != "" {
+    header.set("Content-Disposition", disposition)
+  }
+  if v.encoding != "" {
+    header.set("Content-Encoding", v.encoding)
+  }
+  vary := req.vary
+  if varies {
+    vary = append([]string{"Accept-Encoding"}, vary...)
+  }
+  if len(vary) > 0 {
+    header.set("Vary", strings.Join(vary, ", "))
+  }
+  if strings.HasPrefix(contentType, "text/html") {
+    if links := preloadLinks(req.path); links != "" {
+      header.set("Link", links)
+    }
+  }
+
+  if compress {
+    sendGzip(conn, req, 200, "OK", header, content, info.Size())
+    return
+  }
+
+  if rangeHeader := req.header("Range"); rangeHeader != "" && seekable {
+    start, end, ok, err := parseRange(rangeHeader, info.Size())
+    if err != nil {
+      header.set("Content-Range", fmt.Sprintf("bytes */%d", info.Size()))
+      header.set("Content-Length", "0")
+      writeResponseHeader(conn, 416, "Range Not Satisfiable", header)
+      return
+    }
+
+    if ok {
+      if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+        sendError(conn, 500, "Internal Server Error")
+        return
+      }
+      header.set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, info.Size()))
+      header.set("Content-Length", strconv.FormatInt(end-start+1, 10))
+      writeResponseHeader(conn, 206, "Partial Content", header)
+      copyBody(conn, name, content, end-start+1)
+      return
+    }
+  }
+
+  header.set("Content-Length", strconv.FormatInt(info.Size(), 10))
+  writeResponseHeader(conn, 200, "OK", header)
+  copyBody(conn, name, content, info.Size())
+}
+
+// copyBody writes exactly size bytes of content, the length already declared in the header.
+// Content-Length comes from the open descriptor, so a file growing meanwhile is cut at that size.
+// A file shrinking or failing to read meanwhile cannot be made whole, and the status is already
+// sent; the response is aborted instead, closing the connection so the client sees the body end
+// short of its Content-Length.
+func copyBody(conn net.Conn, name string, content io.Reader, size int64) {
+  if bodyOmitted(conn) {
+    return
+  }
+  source := &readRecorder{Reader: content}
+  if written, err := copyN(conn, source, size); err != nil {
+    switch {
+    case source.err != nil && source.err != io.EOF:
+      log.Printf("Error: reading %s failed after %d of %d bytes were sent, closing connection: %v", name, written, size, source.err)
+    case err == io.EOF:
+      log.Printf("Error: file shrank while being sent, closing connection")
+    }
+    abortResponse(conn)
+  }
+}
+
+// readRecorder keeps the last error its reader returned, telling failed reads apart from
+// failed writes to the client.
+type readRecorder struct {
+  io.Reader
+  err error
+}
+
+func (r *readRecorder) Read(p []byte) (int, error) {
+  n, err := r.Reader.Read(p)
+  if err != nil {
+    r.err = err
+  }
+  return n, err
+}
+
+// generateDirectoryListing renders the entries of one or more directories backing path as HTML.
+// prefix is the part of path stripped by -strip-prefix; the breadcrumb trail starts there.
+func generateDirectoryListing(conn net.Conn, prefix, path string, fullPaths ...string) {
+
+  files, err := readListing(fullPaths)
+  if err != nil {
+    sendFSError(conn, err)
+    return
+  }
+  writeHTMLListing(conn, prefix, path, files)
+}
+
+// writeHTMLListing sends files, already filtered and sorted, as the HTML listing of path.
+func writeHTMLListing(conn net.Conn, prefix, path string, files []fs.DirEntry) {
+
+  body := renderHTMLListing(prefix, path, files)
+
+  header := responseHeader{}
+  header.set("Content-Type", "text/html")
+  header.set("Content-Length", strconv.Itoa(len(body)))
+  if secureHeaders {
+    header.set("Content-Security-Policy", listingCSP)
+  }
+  writeResponseHeader(conn, 200, "OK", header)
+  if !bodyOmitted(conn) {
+    conn.Write(body)
+  }
+}
+
+// renderHTMLListing builds the HTML listing page of path.
+func renderHTMLListing(prefix, path string, files []fs.DirEntry) []byte {
 
   var builder strings.Builder
 
-  builder.WriteString("<html><head><title>Directory Listing</title></head><body><h1>Directory Listing</h1><ul>")
+  builder.WriteString("<html><head><title>Directory Listing</title>" + listingStyle() + "</head><body><h1>Directory Listing</h1>")
+  builder.WriteString(breadcrumbs(prefix, strings.TrimPrefix(path, prefix)))
+  if listingSummary {
+    builder.WriteString("<p>" + html.EscapeString(summarizeListing(files)) + "</p>")
+  }
+  builder.WriteString("<ul>")
   
   for _, file := range files {
-    relativePath := filepath.Join(strings.TrimPrefix(path, "."), file.Name())
-    builder.WriteString(fmt.Sprintf("<li><a href=\"%s\">%s</a></li>", relativePath, file.Name()))
+    href := html.EscapeString((&url.URL{Path: joinURLPath(strings.TrimPrefix(path, "."), file.Name())}).EscapedPath())
+
+    display := truncateName(file.Name(), listingNameMax)
+    title := ""
+    if display != file.Name() {
+      title = fmt.Sprintf(" title=\"%s\"", html.EscapeString(file.Name()))
+    }
+    details := ""
+    if listingDetails {
+      details = html.EscapeString(entryDetails(file))
+    }
+    builder.WriteString(fmt.Sprintf("<li><a href=\"%s\"%s>%s</a>%s</li>", href, title, html.EscapeString(display), details))
   }
-  builder.WriteString("</ul></body></html>")
-  
-  response := fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: %d\r\n\r\n%s", builder.Len(), builder.String())
-  conn.Write([]byte(response))
+  builder.WriteString("</ul>")
+  builder.WriteString(listingFooter)
+  builder.WriteString("</body></html>")
+  return []byte(builder.String())
 }
 
 func sendError(conn net.Conn, code int, message string) {
-  response := fmt.Sprintf("HTTP/1.1 %d %s\r\nContent-Type: text/plain\r\nContent-Length: %d\r\n\r\n%s", code, message, len(message), message)
-  conn.Write([]byte(response))
+  sendErrorWithHeader(conn, code, message, nil)
+}
+
+// sendErrorWithHeader sends an error response carrying additional header fields.
+func sendErrorWithHeader(conn net.Conn, code int, message string, extra responseHeader) {
+  header := append(responseHeader{}, extra...)
+  header.set("Content-Type", "text/plain")
+  header.set("Content-Length", strconv.Itoa(len(message)))
+  // After an error the request stream may be out of sync, so the connection is not reused.
+  header.set("Connection", "close")
+  writeResponseHeader(conn, code, message, header)
+  conn.Write([]byte(message))
+}
+
+// errorStatus maps a filesystem error to an HTTP status code and reason phrase.
+func errorStatus(err error) (int, string) {
+  switch {
+  case errors.Is(err, fs.ErrNotExist):
+    return 404, "Not Found"
+  case errors.Is(err, fs.ErrPermission):
+    return 403, "Forbidden"
+  default:
+    return 500, "Internal Server Error"
+  }
+}
+
+// sendFSError answers with the status matching a filesystem error.
+func sendFSError(conn net.Conn, err error) {
+  code, message := errorStatus(err)
+  if code == 500 {
+    log.Printf("Error: %v", err)
+  }
+  sendError(conn, code, message)
+}
+
+// headerField is a single response header field.
+type headerField struct {
+  name  string
+  value string
+}
+
+// responseHeader is an ordered list of response header fields, written in insertion order.
+type responseHeader []headerField
+
+// set replaces the value of the named field, or appends the field if it is not present yet.
+func (h *responseHeader) set(name, value string) {
+  for i := range *h {
+    if strings.EqualFold((*h)[i].name, name) {
+      (*h)[i].value = value
+      return
+    }
+  }
+  *h = append(*h, headerField{name: name, value: value})
+}
+
+// get returns the value of the named field, or "" if it is not present.
+func (h responseHeader) get(name string) string {
+  for _, field := range h {
+    if strings.EqualFold(field.name, name) {
+      return field.value
+    }
+  }
+  return ""
+}
+
+// writeResponseHeader writes the status line and header fields, ending the header section.
+func writeResponseHeader(conn net.Conn, code int, reason string, header responseHeader) {
+  config := activeSettings()
+  if rc, ok := conn.(*responseConn); ok {
+    if rc.settings != nil {
+      config = rc.settings
+    }
+    rc.status = code
+    if rc.simple {
+      rc.headerSent = true
+      return
+    }
+    if strings.EqualFold(header.get("Connection"), "close") {
+      rc.closeAfter = true
+    }
+    // With persistent connections enabled, clients are told when one ends after this response.
+    if rc.closeAfter && keepAliveTimeout > 0 {
+      header.set("Connection", "close")
+    }
+    if serverTiming {
+      header.set("Server-Timing", rc.serverTiming())
+    }
+  }
+  applyExtraHeaders(&header, config)
+
+  var builder strings.Builder
+  fmt.Fprintf(&builder, "HTTP/1.1 %d %s\r\n", code, reason)
+  for _, field := range header {
+    // Values can carry names from the file system; line breaks in them must not start new fields.
+    value := strings.NewReplacer("\r", "", "\n", "").Replace(field.value)
+    fmt.Fprintf(&builder, "%s: %s\r\n", field.name, value)
+  }
+  builder.WriteString("\r\n")
+  conn.Write([]byte(builder.String()))
+
+  if rc, ok := conn.(*responseConn); ok {
+    rc.headerSent = true
+  }
 }
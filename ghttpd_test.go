@@ -1,20 +1,27 @@
 package main
 
 import (
+  "bufio"
   "bytes"
+  "errors"
   "fmt"
+  "io"
+  "io/fs"
   "net"
   "os"
   "path/filepath"
+  "runtime"
   "strings"
+  "syscall"
   "testing"
   "time"
 )
 
 // Mock net.Conn implementation for testing
 type mockConn struct {
-  readBuf  *bytes.Buffer
-  writeBuf *bytes.Buffer
+  readBuf    *bytes.Buffer
+  writeBuf   *bytes.Buffer
+  remoteAddr net.Addr
 }
 
 func newMockConn(input string) *mockConn {
@@ -28,7 +35,7 @@ func (m *mockConn) Read(b []byte) (n int, err error)         { return m.readBuf.
 func (m *mockConn) Write(b []byte) (n int, err error)        { return m.writeBuf.Write(b) }
 func (m *mockConn) Close() error                             { return nil }
 func (m *mockConn) LocalAddr() net.Addr                      { return nil }
-func (m *mockConn) RemoteAddr() net.Addr                     { return nil }
+func (m *mockConn) RemoteAddr() net.Addr                     { return m.remoteAddr }
 func (m *mockConn) SetDeadline(t time.Time) error            { return nil }
 func (m *mockConn) SetReadDeadline(t time.Time) error        { return nil }
 func (m *mockConn) SetWriteDeadline(t time.Time) error       { return nil }
@@ -69,12 +76,63 @@ func TestParseRequest(t *testing.T) {
       expectedVersion: "HTTP/1.1\r\n",
       shouldError:     false,
     },
+    {
+      name:          "Encoded CRLF in path",
+      input:         "GET /a%0d%0aSet-Cookie:%20x=1 HTTP/1.1\r\n",
+      shouldError:   true,
+    },
+    {
+      name:          "Encoded NUL in path",
+      input:         "GET /index.html%00.txt HTTP/1.1\r\n",
+      shouldError:   true,
+    },
+    {
+      name:          "Missing path",
+      input:         "GET  HTTP/1.1\r\n",
+      shouldError:   true,
+    },
+    {
+      name:          "Path without leading slash",
+      input:         "GET index.html HTTP/1.1\r\n",
+      shouldError:   true,
+    },
+    {
+      name:          "Relative scheme-less target",
+      input:         "GET example.com/index.html HTTP/1.1\r\n",
+      shouldError:   true,
+    },
+    {
+      name:            "Absolute form",
+      input:           "GET http://example.com/docs/a%20b.html?x=1 HTTP/1.1\r\n",
+      expectedMethod:  "GET",
+      expectedPath:    "/docs/a b.html",
+      expectedVersion: "HTTP/1.1\r\n",
+    },
+    {
+      name:            "Absolute form without path",
+      input:           "GET http://example.com HTTP/1.1\r\n",
+      expectedMethod:  "GET",
+      expectedPath:    "/",
+      expectedVersion: "HTTP/1.1\r\n",
+    },
+    {
+      name:            "Asterisk form",
+      input:           "OPTIONS * HTTP/1.1\r\n",
+      expectedMethod:  "OPTIONS",
+      expectedPath:    "*",
+      expectedVersion: "HTTP/1.1\r\n",
+    },
+    {
+      name:          "Raw control character in method",
+      input:         "G\x1bT /index.html HTTP/1.1\r\n",
+      shouldError:   true,
+    },
   }
 
   for _, tc := range testCases {
     t.Run(tc.name, func(t *testing.T) {
       conn := newMockConn(tc.input)
-      method, path, version, err := parseRequest(conn)
+      req, err := parseRequest(conn)
 
       if tc.shouldError {
         if err == nil {
@@ -82,22 +140,117 @@ func TestParseRequest(t *testing.T) {
         }
       } else {
         if err != nil {
-          t.Errorf("Unexpected error: %v", err)
+          t.Fatalf("Unexpected error: %v", err)
+        }
+        if req.method != tc.expectedMethod {
+          t.Errorf("Expected method %s, got %s", tc.expectedMethod, req.method)
         }
-        if method != tc.expectedMethod {
-          t.Errorf("Expected method %s, got %s", tc.expectedMethod, method)
+        if req.path != tc.expectedPath {
+          t.Errorf("Expected path %s, got %s", tc.expectedPath, req.path)
         }
-        if path != tc.expectedPath {
-          t.Errorf("Expected path %s, got %s", tc.expectedPath, path)
+        if req.version != tc.expectedVersion {
+          t.Errorf("Expected version %s, got %s", tc.expectedVersion, req.version)
+        }
+      }
+    })
+  }
+}
+
+func TestParseRequestHeaders(t *testing.T) {
+  testCases := []struct {
+    name            string
+    input           string
+    expectedHeaders map[string]string
+    shouldError     bool
+  }{
+    {
+      name:            "Headers are lower-cased and trimmed",
+      input:           "GET / HTTP/1.1\r\nHost: example.com\r\nAccept:  text/html \r\n\r\n",
+      expectedHeaders: map[string]string{"host": "example.com", "accept": "text/html"},
+    },
+    {
+      name:            "Repeated headers are joined",
+      input:           "GET / HTTP/1.1\r\nAccept: text/html\r\naccept: application/json\r\n\r\n",
+      expectedHeaders: map[string]string{"accept": "text/html, application/json"},
+    },
+    {
+      name:        "Header without colon",
+      input:       "GET / HTTP/1.1\r\nBogus header\r\n\r\n",
+      shouldError: true,
+    },
+    {
+      name:        "Whitespace before colon",
+      input:       "GET / HTTP/1.1\r\nHost : example.com\r\n\r\n",
+      shouldError: true,
+    },
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      req, err := parseRequest(newMockConn(tc.input))
+
+      if tc.shouldError {
+        if err == nil {
+          t.Errorf("Expected error but got none")
         }
-        if version != tc.expectedVersion {
-          t.Errorf("Expected version %s, got %s", tc.expectedVersion, version)
+        return
+      }
+      if err != nil {
+        t.Fatalf("Unexpected error: %v", err)
+      }
+      for name, value := range tc.expectedHeaders {
+        if got := req.header(name); got != value {
+          t.Errorf("Expected header %s to be %q, got %q", name, value, got)
         }
       }
     })
   }
 }
 
+func TestHTTP09(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"hello.txt": "hello from 1991"})
+  useRoots(t, tempDir)
+
+  http09 = true
+  defer func() { http09 = false }()
+
+  testCases := []struct {
+    name             string
+    request          string
+    expectedResponse string
+    expectedPrefix   string
+  }{
+    {name: "Simple request", request: "GET /hello.txt\r\n", expectedResponse: "hello from 1991"},
+    {name: "Bare newline", request: "GET /hello.txt\n", expectedResponse: "hello from 1991"},
+    {name: "Missing file", request: "GET /missing.txt\r\n", expectedResponse: "Not Found"},
+    {name: "Only GET", request: "HEAD /hello.txt\r\n", expectedPrefix: "HTTP/1.1 400 Bad Request"},
+    {name: "Full request", request: "GET /hello.txt HTTP/1.1\r\n\r\n", expectedPrefix: "HTTP/1.1 200 OK"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn(tc.request)
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if tc.expectedResponse != "" && response != tc.expectedResponse {
+        t.Errorf("Expected %q alone, got %q", tc.expectedResponse, response)
+      }
+      if tc.expectedPrefix != "" && !strings.HasPrefix(response, tc.expectedPrefix) {
+        t.Errorf("Expected response to start with %q, got %q", tc.expectedPrefix, response)
+      }
+    })
+  }
+
+  http09 = false
+  conn := newMockConn("GET /hello.txt\r\n")
+  handleConnection(conn)
+  if response := conn.GetWrittenData(); !strings.HasPrefix(response, "HTTP/1.1 400 Bad Request") {
+    t.Errorf("Expected 400 without -http09, got %q", response)
+  }
+}
+
 func TestValidateRequest(t *testing.T) {
   testCases := []struct {
     name          string
@@ -123,6 +276,12 @@ func TestValidateRequest(t *testing.T) {
       version:     "NOTHTTP/1.1\r\n",
       shouldError: true,
     },
+    {
+      name:        "CONNECT",
+      method:      "CONNECT",
+      version:     "HTTP/1.1\r\n",
+      shouldError: true,
+    },
   }
 
   for _, tc := range testCases {
@@ -153,13 +312,13 @@ func TestSendError(t *testing.T) {
       name:       "404 Not Found",
       statusCode: 404,
       message:    "Not Found",
-      expectedResponse: "HTTP/1.1 404 Not Found\r\nContent-Type: text/plain\r\nContent-Length: 9\r\n\r\nNot Found",
+      expectedResponse: "HTTP/1.1 404 Not Found\r\nContent-Type: text/plain\r\nContent-Length: 9\r\nConnection: close\r\n\r\nNot Found",
     },
     {
       name:       "500 Internal Server Error",
       statusCode: 500,
       message:    "Internal Server Error",
-      expectedResponse: "HTTP/1.1 500 Internal Server Error\r\nContent-Type: text/plain\r\nContent-Length: 21\r\n\r\nInternal Server Error",
+      expectedResponse: "HTTP/1.1 500 Internal Server Error\r\nContent-Type: text/plain\r\nContent-Length: 21\r\nConnection: close\r\n\r\nInternal Server Error",
     },
   }
 
@@ -176,6 +335,37 @@ func TestSendError(t *testing.T) {
   }
 }
 
+func TestControlCharactersRejected(t *testing.T) {
+  logOutput := captureLog(t)
+
+  for _, path := range []string{"/a%0d%0aX-Injected:%201", "/a%0aNew%20Request%20[Method:%20GET]", "/file%00.txt"} {
+    conn := newMockConn("GET " + path + " HTTP/1.1\r\n\r\n")
+    handleConnection(conn)
+
+    response := conn.GetWrittenData()
+    if !strings.HasPrefix(response, "HTTP/1.1 400 Bad Request") {
+      t.Errorf("Expected 400 for %s, got: %s", path, response)
+    }
+    if strings.Contains(response, "X-Injected") {
+      t.Errorf("Expected no injected header for %s, got: %s", path, response)
+    }
+  }
+
+  if strings.Contains(logOutput.String(), "\nNew Request [Method: GET]") {
+    t.Errorf("Expected no forged log line, got: %s", logOutput)
+  }
+}
+
+func TestMalformedRequestClosesConnection(t *testing.T) {
+  conn := newMockConn("GET /index.html\r\nHost: example.com\r\n\r\n")
+  handleConnection(conn)
+
+  response := conn.GetWrittenData()
+  if !strings.HasPrefix(response, "HTTP/1.1 400 Bad Request") || !strings.Contains(response, "\r\nConnection: close\r\n") {
+    t.Errorf("Expected a 400 with Connection: close, got: %s", response)
+  }
+}
+
 func TestSendFile(t *testing.T) {
   // Create a temporary test file
   tempContent := "This is test content."
@@ -192,10 +382,16 @@ func TestSendFile(t *testing.T) {
   tempFile.Close()
   
   conn := newMockConn("")
-  sendFile(conn, tempFile.Name())
+  sendFile(conn, &request{}, tempFile.Name())
   
+  info, err := os.Stat(tempFile.Name())
+  if err != nil {
+    t.Fatalf("Failed to stat temp file: %v", err)
+  }
+
   response := conn.GetWrittenData()
-  expectedHeader := fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: %d\r\n\r\n", len(tempContent))
+  expectedHeader := fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: text/plain; charset=utf-8\r\nAccept-Ranges: bytes\r\nETag: %s\r\nLast-Modified: %s\r\nContent-Length: %d\r\n\r\n",
+    etagFor(info), info.ModTime().UTC().Format(httpTimeFormat), len(tempContent))
   
   if !strings.HasPrefix(response, expectedHeader) {
     t.Errorf("Expected response to start with:\n%s\n\nGot:\n%s", expectedHeader, response)
@@ -206,6 +402,23 @@ func TestSendFile(t *testing.T) {
   }
 }
 
+func TestSendFileDefaultType(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"README": "plain text", "data.unknownext": "data"})
+
+  originalDefaultType := defaultType
+  defer func() { defaultType = originalDefaultType }()
+  defaultType = "text/plain; charset=utf-8"
+
+  for _, name := range []string{"README", "data.unknownext"} {
+    conn := newMockConn("")
+    sendFile(conn, &request{}, filepath.Join(tempDir, name))
+    if response := conn.GetWrittenData(); !strings.Contains(response, "Content-Type: text/plain; charset=utf-8\r\n") {
+      t.Errorf("Expected the configured default type for %s, got: %s", name, response)
+    }
+  }
+}
+
 func TestGenerateDirectoryListing(t *testing.T) {
   // Create a temporary directory with some files
   tempDir, err := os.MkdirTemp("", "test-dir")
@@ -232,7 +445,7 @@ func TestGenerateDirectoryListing(t *testing.T) {
   }
   
   conn := newMockConn("")
-  generateDirectoryListing(conn, "/testpath", tempDir)
+  generateDirectoryListing(conn, "", "/testpath", tempDir)
   
   response := conn.GetWrittenData()
   
@@ -255,15 +468,15 @@ func TestGenerateDirectoryListing(t *testing.T) {
 
 func TestHandleConnection(t *testing.T) {
   // Set up initial directory for testing
-  originalDir := dir
+  originalRoots := roots
   tempDir, err := os.MkdirTemp("", "test-server")
   if err != nil {
     t.Fatalf("Failed to create temp directory: %v", err)
   }
   defer os.RemoveAll(tempDir)
-  defer func() { dir = originalDir }()
+  defer func() { roots = originalRoots }()
   
-  dir = tempDir
+  roots = rootList{tempDir}
   
   // Create a test file in the temp directory
   testFileName := "test.txt"
@@ -315,6 +528,18 @@ func TestHandleConnection(t *testing.T) {
       expectedCode: "HTTP/1.1 400",
       checkContent: false,
     },
+    {
+      name:         "CONNECT is not proxied",
+      request:      "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n",
+      expectedCode: "HTTP/1.1 405 Method Not Allowed\r\nAllow: GET, HEAD",
+      checkContent: false,
+    },
+    {
+      name:         "HTTP/2 connection preface",
+      request:      "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n",
+      expectedCode: "HTTP/1.1 505 HTTP Version Not Supported",
+      checkContent: false,
+    },
   }
   
   for _, tc := range testCases {
@@ -337,4 +562,521 @@ func TestHandleConnection(t *testing.T) {
       }
     })
   }
-}
\ No newline at end of file
+}
+// useRoots points the server at the given document roots for the duration of the test.
+func useRoots(t testing.TB, dirs ...string) {
+  t.Helper()
+  originalRoots := roots
+  roots = rootList(dirs)
+  t.Cleanup(func() { roots = originalRoots })
+}
+
+// writeTestFiles creates files (with parent directories) under root from a name to content map.
+func writeTestFiles(t testing.TB, root string, files map[string]string) {
+  t.Helper()
+  for name, content := range files {
+    fullPath := filepath.Join(root, filepath.FromSlash(name))
+    if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+      t.Fatalf("Failed to create directory for %s: %v", name, err)
+    }
+    if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+      t.Fatalf("Failed to create test file %s: %v", name, err)
+    }
+  }
+}
+
+func TestServeResourceRootChain(t *testing.T) {
+  theme, base := t.TempDir(), t.TempDir()
+  writeTestFiles(t, theme, map[string]string{"style.css": "theme style", "shared/theme.txt": "theme"})
+  writeTestFiles(t, base, map[string]string{"style.css": "base style", "only-base.txt": "base only", "shared/base.txt": "base"})
+  useRoots(t, theme, base)
+
+  testCases := []struct {
+    name            string
+    path            string
+    merge           bool
+    expectedCode    string
+    expectedContent []string
+    missingContent  []string
+  }{
+    {
+      name:            "File in first root wins",
+      path:            "/style.css",
+      expectedCode:    "HTTP/1.1 200 OK",
+      expectedContent: []string{"theme style"},
+    },
+    {
+      name:            "File only in second root",
+      path:            "/only-base.txt",
+      expectedCode:    "HTTP/1.1 200 OK",
+      expectedContent: []string{"base only"},
+    },
+    {
+      name:         "File in no root",
+      path:         "/missing.txt",
+      expectedCode: "HTTP/1.1 404 Not Found",
+    },
+    {
+      name:            "Listing shows first root only",
+      path:            "/shared",
+      expectedCode:    "HTTP/1.1 200 OK",
+      expectedContent: []string{"theme.txt"},
+      missingContent:  []string{"base.txt"},
+    },
+    {
+      name:            "Merged listing",
+      path:            "/shared",
+      merge:           true,
+      expectedCode:    "HTTP/1.1 200 OK",
+      expectedContent: []string{"theme.txt", "base.txt"},
+    },
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      originalMerge := mergeListings
+      mergeListings = tc.merge
+      defer func() { mergeListings = originalMerge }()
+
+      conn := newMockConn("")
+      serveResource(conn, &request{path: tc.path})
+      response := conn.GetWrittenData()
+
+      if !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected response to start with %s, got: %s", tc.expectedCode, response)
+      }
+      for _, content := range tc.expectedContent {
+        if !strings.Contains(response, content) {
+          t.Errorf("Expected %s in response, got: %s", content, response)
+        }
+      }
+      for _, content := range tc.missingContent {
+        if strings.Contains(response, content) {
+          t.Errorf("Did not expect %s in response, got: %s", content, response)
+        }
+      }
+    })
+  }
+}
+
+func TestErrorStatus(t *testing.T) {
+  testCases := []struct {
+    name         string
+    err          error
+    expectedCode int
+  }{
+    {name: "Not found", err: &fs.PathError{Op: "open", Path: "x", Err: fs.ErrNotExist}, expectedCode: 404},
+    {name: "Permission denied", err: &fs.PathError{Op: "open", Path: "x", Err: fs.ErrPermission}, expectedCode: 403},
+    {name: "Errno permission denied", err: &fs.PathError{Op: "open", Path: "x", Err: syscall.EACCES}, expectedCode: 403},
+    {name: "Other error", err: errors.New("disk on fire"), expectedCode: 500},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      if code, _ := errorStatus(tc.err); code != tc.expectedCode {
+        t.Errorf("Expected %d, got %d", tc.expectedCode, code)
+      }
+    })
+  }
+}
+
+func TestFileVanishedBeforeOpen(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"churn.txt": "here a moment ago"})
+  useRoots(t, tempDir)
+  logs := captureLog(t)
+
+  // serveResource finds the file, then it is deleted before sendFile opens it.
+  file, _, err := locateResource("/churn.txt")
+  if err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  if err := os.Remove(file); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+
+  conn := newMockConn("")
+  sendFile(conn, &request{method: "GET", path: "/churn.txt"}, file)
+
+  if response := conn.GetWrittenData(); !strings.HasPrefix(response, "HTTP/1.1 404 Not Found") {
+    t.Errorf("Expected 404 for a file deleted after stat, got: %s", response)
+  }
+  if strings.Contains(logs.String(), "Error:") {
+    t.Errorf("Expected no error to be logged, got: %s", logs.String())
+  }
+}
+
+func TestPermissionDenied(t *testing.T) {
+  if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+    t.Skip("permission bits are not enforced for this user")
+  }
+
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"secret.txt": "secret", "locked/inner.txt": "inner"})
+  useRoots(t, tempDir)
+
+  os.Chmod(filepath.Join(tempDir, "secret.txt"), 0)
+  os.Chmod(filepath.Join(tempDir, "locked"), 0)
+  defer os.Chmod(filepath.Join(tempDir, "locked"), 0755)
+
+  for _, path := range []string{"/secret.txt", "/locked", "/locked/inner.txt"} {
+    conn := newMockConn(fmt.Sprintf("GET %s HTTP/1.1\r\n\r\n", path))
+    handleConnection(conn)
+    if response := conn.GetWrittenData(); !strings.HasPrefix(response, "HTTP/1.1 403 Forbidden") {
+      t.Errorf("Expected 403 for %s, got: %s", path, response)
+    }
+  }
+}
+
+func TestStripPrefix(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"file.txt": "content", "sub/inner.txt": "inner"})
+  useRoots(t, tempDir)
+
+  testCases := []struct {
+    name            string
+    prefix          string
+    path            string
+    expectedCode    string
+    expectedContent string
+  }{
+    {name: "No prefix configured", prefix: "", path: "/file.txt", expectedCode: "HTTP/1.1 200 OK", expectedContent: "content"},
+    {name: "Path under prefix", prefix: "/app/", path: "/app/file.txt", expectedCode: "HTTP/1.1 200 OK", expectedContent: "content"},
+    {name: "Path outside prefix", prefix: "/app", path: "/file.txt", expectedCode: "HTTP/1.1 404 Not Found"},
+    {name: "Prefix as a partial segment", prefix: "/app", path: "/application/file.txt", expectedCode: "HTTP/1.1 404 Not Found"},
+    {name: "Listing links keep prefix", prefix: "/app", path: "/app", expectedCode: "HTTP/1.1 200 OK", expectedContent: `href="/app/file.txt"`},
+    {name: "Nested listing links keep prefix", prefix: "/app", path: "/app/sub/", expectedCode: "HTTP/1.1 200 OK", expectedContent: `href="/app/sub/inner.txt"`},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      originalPrefix := stripPrefix
+      stripPrefix = tc.prefix
+      defer func() { stripPrefix = originalPrefix }()
+
+      conn := newMockConn(fmt.Sprintf("GET %s HTTP/1.1\r\n\r\n", tc.path))
+      handleConnection(conn)
+      response := conn.GetWrittenData()
+
+      if !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+      if !strings.Contains(response, tc.expectedContent) {
+        t.Errorf("Expected %s in response, got: %s", tc.expectedContent, response)
+      }
+    })
+  }
+}
+
+func TestRootRemovedAtRuntime(t *testing.T) {
+  tempDir := t.TempDir()
+  root := filepath.Join(tempDir, "public")
+  writeTestFiles(t, root, map[string]string{"index.html": "hello"})
+  useRoots(t, root)
+  buf := captureLog(t)
+
+  request := func() string {
+    conn := newMockConn("GET /index.html HTTP/1.1\r\n\r\n")
+    handleConnection(conn)
+    return conn.GetWrittenData()
+  }
+
+  if response := request(); !strings.HasPrefix(response, "HTTP/1.1 200 OK") {
+    t.Fatalf("Expected 200 before removal, got: %s", response)
+  }
+
+  if err := os.RemoveAll(root); err != nil {
+    t.Fatalf("Failed to remove root: %v", err)
+  }
+  if response := request(); !strings.HasPrefix(response, "HTTP/1.1 503 Service Unavailable") {
+    t.Errorf("Expected 503 after removal, got: %s", response)
+  }
+  if !strings.Contains(buf.String(), "is no longer available") {
+    t.Errorf("Expected the missing root to be logged, got: %s", buf.String())
+  }
+
+  writeTestFiles(t, root, map[string]string{"index.html": "hello again"})
+  if response := request(); !strings.HasPrefix(response, "HTTP/1.1 200 OK") {
+    t.Errorf("Expected 200 once the root is back, got: %s", response)
+  }
+}
+
+// hookConn runs onWrite before the first write, letting tests change a file after its header was prepared.
+type hookConn struct {
+  *mockConn
+  onWrite func()
+}
+
+func (h *hookConn) Write(b []byte) (int, error) {
+  if h.onWrite != nil {
+    h.onWrite()
+    h.onWrite = nil
+  }
+  return h.mockConn.Write(b)
+}
+
+func TestSendFileConcurrentModification(t *testing.T) {
+  const content = "0123456789"
+
+  testCases := []struct {
+    name         string
+    modify       func(path string) error
+    expectedBody string
+    expectAbort  bool
+  }{
+    {
+      name:         "Shrunk file aborts the response",
+      modify:       func(path string) error { return os.Truncate(path, 4) },
+      expectedBody: "0123",
+      expectAbort:  true,
+    },
+    {
+      name: "Grown file is capped at the declared length",
+      modify: func(path string) error {
+        file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+        if err != nil {
+          return err
+        }
+        defer file.Close()
+        _, err = file.WriteString("extra")
+        return err
+      },
+      expectedBody: content,
+    },
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      filePath := filepath.Join(t.TempDir(), "data.txt")
+      if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+        t.Fatalf("Failed to write test file: %v", err)
+      }
+
+      mock := newMockConn("")
+      conn := newResponseConn(&hookConn{mockConn: mock, onWrite: func() {
+        if err := tc.modify(filePath); err != nil {
+          t.Errorf("Failed to modify file: %v", err)
+        }
+      }})
+      sendFile(conn, &request{}, filePath)
+
+      headers, body, _ := strings.Cut(mock.GetWrittenData(), "\r\n\r\n")
+      if !strings.Contains(headers+"\r\n", fmt.Sprintf("\r\nContent-Length: %d\r\n", len(content))) {
+        t.Errorf("Expected the length from the open file, got: %s", headers)
+      }
+      if body != tc.expectedBody {
+        t.Errorf("Expected body %q, got %q", tc.expectedBody, body)
+      }
+      if conn.closeAfter != tc.expectAbort {
+        t.Errorf("Expected closeAfter %v, got %v", tc.expectAbort, conn.closeAfter)
+      }
+    })
+  }
+}
+
+// failingReader returns data and then err, like a disk failing partway through a file.
+type failingReader struct {
+  data []byte
+  err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+  if len(r.data) == 0 {
+    return 0, r.err
+  }
+  n := copy(p, r.data)
+  r.data = r.data[n:]
+  return n, nil
+}
+
+func TestSendContentReadError(t *testing.T) {
+  const content = "0123456789"
+  filePath := filepath.Join(t.TempDir(), "data.txt")
+  if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+    t.Fatalf("Failed to write test file: %v", err)
+  }
+  info, err := os.Stat(filePath)
+  if err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  logs := captureLog(t)
+
+  mock := newMockConn("")
+  conn := newResponseConn(mock)
+  reader := &failingReader{data: []byte(content[:4]), err: errors.New("input/output error")}
+  sendContent(conn, &request{method: "GET"}, filePath, info, reader, time.Now(), variant{})
+
+  headers, body, _ := strings.Cut(mock.GetWrittenData(), "\r\n\r\n")
+  if !strings.HasPrefix(headers, "HTTP/1.1 200 OK") || !strings.Contains(headers, "Content-Length: 10") {
+    t.Errorf("Expected the header to declare the full length, got: %s", headers)
+  }
+  if body != "0123" {
+    t.Errorf("Expected the body read before the error, got %q", body)
+  }
+  if !conn.closeAfter {
+    t.Errorf("Expected the connection to be closed after a truncated body")
+  }
+  if !strings.Contains(logs.String(), "failed after 4 of 10 bytes were sent") || !strings.Contains(logs.String(), "input/output error") {
+    t.Errorf("Expected the read error to be logged, got: %s", logs.String())
+  }
+}
+
+func TestHeadRequests(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"docs/a.txt": "alpha", "docs/b.txt": "bravo", "notes.txt": "hello"})
+  useRoots(t, tempDir)
+
+  testCases := []struct {
+    name string
+    path string
+  }{
+    {"Directory listing", "/docs/"},
+    {"File", "/notes.txt"},
+    {"Missing file", "/missing.txt"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      getConn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(getConn)
+      getHeaders, getBody, _ := strings.Cut(getConn.GetWrittenData(), "\r\n\r\n")
+
+      headConn := newMockConn("HEAD " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(headConn)
+      headHeaders, headBody, _ := strings.Cut(headConn.GetWrittenData(), "\r\n\r\n")
+
+      if headHeaders != getHeaders {
+        t.Errorf("Expected the GET headers:\n%s\ngot:\n%s", getHeaders, headHeaders)
+      }
+      if headBody != "" {
+        t.Errorf("Expected no body, got: %q", headBody)
+      }
+      if !strings.Contains(headHeaders+"\r\n", fmt.Sprintf("\r\nContent-Length: %d\r\n", len(getBody))) {
+        t.Errorf("Expected Content-Length %d, got:\n%s", len(getBody), headHeaders)
+      }
+    })
+  }
+}
+
+func TestRawPaths(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"100%.txt": "decoded", "100%25.txt": "literal"})
+  useRoots(t, tempDir)
+
+  testCases := []struct {
+    name         string
+    rawPaths     bool
+    expectedBody string
+  }{
+    {"Unescaped", false, "decoded"},
+    {"Raw", true, "literal"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      original := rawPaths
+      rawPaths = tc.rawPaths
+      defer func() { rawPaths = original }()
+
+      conn := newMockConn("GET /100%25.txt HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+      if _, body, _ := strings.Cut(conn.GetWrittenData(), "\r\n\r\n"); body != tc.expectedBody {
+        t.Errorf("Expected %q, got %q", tc.expectedBody, body)
+      }
+    })
+  }
+}
+
+// chunkedConn delivers its input in the given pieces, one per Read, like a client whose request
+// arrives in several TCP segments.
+type chunkedConn struct {
+  *mockConn
+  chunks []string
+}
+
+func (c *chunkedConn) Read(b []byte) (int, error) {
+  if len(c.chunks) == 0 {
+    return 0, io.EOF
+  }
+  n := copy(b, c.chunks[0])
+  if c.chunks[0] = c.chunks[0][n:]; c.chunks[0] == "" {
+    c.chunks = c.chunks[1:]
+  }
+  return n, nil
+}
+
+func TestRequestLineAcrossReads(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"a.txt": "content"})
+  useRoots(t, tempDir)
+
+  testCases := []struct {
+    name         string
+    chunks       []string
+    expectedCode string
+  }{
+    {"Request line in two chunks", []string{"GET /a.t", "xt HTTP/1.1\r\n\r\n"}, "HTTP/1.1 200 OK"},
+    {"CRLF split", []string{"GET /a.txt HTTP/1.1\r", "\n", "Host: x\r\n", "\r\n"}, "HTTP/1.1 200 OK"},
+    {"Byte by byte", strings.Split("GET /a.txt HTTP/1.1\r\nHost: localhost\r\n\r\n", ""), "HTTP/1.1 200 OK"},
+    {"Incomplete line", []string{"GET /a.t"}, "HTTP/1.1 400 Bad Request"},
+    {"Oversized header", []string{"GET /a.txt HTTP/1.1\r\n", "X-Big: " + strings.Repeat("a", int(maxHeaderBytes)), "\r\n\r\n"}, "HTTP/1.1 431 Request Header Fields Too Large"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := &chunkedConn{mockConn: newMockConn(""), chunks: append([]string(nil), tc.chunks...)}
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+      if tc.expectedCode == "HTTP/1.1 200 OK" && !strings.HasSuffix(response, "content") {
+        t.Errorf("Expected the file content, got: %s", response)
+      }
+    })
+  }
+}
+
+func TestLargeHeaderLimit(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"a.txt": "content"})
+  useRoots(t, tempDir)
+
+  originalMax, originalBuffer := maxHeaderBytes, readBufferSize
+  defer func() { maxHeaderBytes, readBufferSize = originalMax, originalBuffer }()
+
+  // A single cookie line many times the default 4KB read buffer.
+  request := "GET /a.txt HTTP/1.1\r\nCookie: session=" + strings.Repeat("c", 100<<10) + "\r\n\r\n"
+
+  conn := newMockConn(request)
+  handleConnection(conn)
+  if response := conn.GetWrittenData(); !strings.HasPrefix(response, "HTTP/1.1 431 Request Header Fields Too Large") {
+    t.Errorf("Expected 431 under the default limit, got: %.200s", response)
+  }
+
+  maxHeaderBytes, readBufferSize = 256<<10, 128<<10
+  if err := validateReadBuffer(); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  conn = newMockConn(request)
+  handleConnection(conn)
+  if response := conn.GetWrittenData(); !strings.HasPrefix(response, "HTTP/1.1 200 OK") {
+    t.Errorf("Expected the request to be served under a raised limit, got: %.200s", response)
+  }
+
+  req, err := parseRequest(bufio.NewReaderSize(strings.NewReader(request), int(readBufferSize)))
+  if err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  if cookie := req.header("Cookie"); len(cookie) != len("session=")+100<<10 {
+    t.Errorf("Expected the whole cookie, got %d bytes", len(cookie))
+  }
+
+  for _, size := range []byteSize{8, 512 << 10} {
+    readBufferSize = size
+    if err := validateReadBuffer(); err == nil {
+      t.Errorf("Expected error for a %s read buffer", size.String())
+    }
+  }
+}
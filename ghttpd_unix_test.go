@@ -0,0 +1,32 @@
+//go:build unix
+
+package main
+
+import (
+  "path/filepath"
+  "strings"
+  "syscall"
+  "testing"
+)
+
+func TestNonRegularFilesRefused(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"notes.txt": "notes"})
+  if err := syscall.Mkfifo(filepath.Join(tempDir, "pipe"), 0644); err != nil {
+    t.Skipf("Cannot create a FIFO: %v", err)
+  }
+  useRoots(t, tempDir)
+
+  // A FIFO without a writer blocks on open, so serving it would hang this test.
+  conn := newMockConn("GET /pipe HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+  if response := conn.GetWrittenData(); !strings.HasPrefix(response, "HTTP/1.1 403 Forbidden") {
+    t.Errorf("Expected 403 for a FIFO, got: %s", response)
+  }
+
+  conn = newMockConn("GET /notes.txt HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+  if response := conn.GetWrittenData(); !strings.HasPrefix(response, "HTTP/1.1 200 OK") {
+    t.Errorf("Expected regular files to be served, got: %s", response)
+  }
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+  "fmt"
+  "strings"
+)
+
+// headerList is the repeatable -header flag: extra "Name: value" fields added to every response.
+type headerList []headerField
+
+var (
+  customHeaders headerList
+  secureHeaders bool
+)
+
+// secureHeaderPreset holds the fields added to every response by -secure-headers.
+var secureHeaderPreset = responseHeader{
+  {name: "X-Content-Type-Options", value: "nosniff"},
+  {name: "X-Frame-Options", value: "DENY"},
+  {name: "Referrer-Policy", value: "no-referrer"},
+}
+
+// listingCSP is the Content-Security-Policy of the generated listing pages under -secure-headers.
+// Listings are plain markup, so they need nothing but inline styles.
+const listingCSP = "default-src 'none'; style-src 'unsafe-inline'"
+
+func (l *headerList) String() string {
+  fields := make([]string, len(*l))
+  for i, field := range *l {
+    fields[i] = field.name + ": " + field.value
+  }
+  return strings.Join(fields, ", ")
+}
+
+func (l *headerList) Set(value string) error {
+  name, fieldValue, found := strings.Cut(value, ":")
+  name, fieldValue = strings.TrimSpace(name), strings.TrimSpace(fieldValue)
+  if !found || name == "" || strings.ContainsAny(name, " \t") {
+    return fmt.Errorf("invalid header %q: expected \"Name: value\"", value)
+  }
+  if strings.ContainsAny(name+fieldValue, "\r\n") {
+    return fmt.Errorf("invalid header %q: line breaks are not allowed", value)
+  }
+  *l = append(*l, headerField{name: name, value: fieldValue})
+  return nil
+}
+
+// reset drops the fields set so far, so a config reload replaces the list instead of extending it.
+func (l *headerList) reset() {
+  *l = nil
+}
+
+// applyExtraHeaders adds the -secure-headers preset where the handler did not set the field itself,
+// then the -header fields of config, which override both.
+func applyExtraHeaders(header *responseHeader, config *settings) {
+  if secureHeaders {
+    for _, field := range secureHeaderPreset {
+      if header.get(field.name) == "" {
+        header.set(field.name, field.value)
+      }
+    }
+  }
+  for _, field := range config.headers {
+    header.set(field.name, field.value)
+  }
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+  "strings"
+  "testing"
+)
+
+// useExtraHeaders enables -secure-headers as given and loads the -header values into the settings for the
+// duration of the test.
+func useExtraHeaders(t *testing.T, secure bool, fields ...string) {
+  t.Helper()
+  originalSecure, originalCustom, originalSettings := secureHeaders, customHeaders, currentSettings.Load()
+  secureHeaders, customHeaders = secure, nil
+  for _, field := range fields {
+    if err := customHeaders.Set(field); err != nil {
+      t.Fatalf("Unexpected error: %v", err)
+    }
+  }
+  if err := reloadSettings(); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  t.Cleanup(func() {
+    secureHeaders, customHeaders = originalSecure, originalCustom
+    currentSettings.Store(originalSettings)
+  })
+}
+
+func TestHeaderListSet(t *testing.T) {
+  for _, value := range []string{"NoColon", ": value", "Bad Name: x", "X-Test: a\r\nInjected: b"} {
+    var headers headerList
+    if err := headers.Set(value); err == nil {
+      t.Errorf("Expected error for %q", value)
+    }
+  }
+}
+
+func TestSecureHeaders(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"file.txt": "hello", "sub/nested.txt": "nested"})
+  useRoots(t, tempDir)
+
+  testCases := []struct {
+    name     string
+    path     string
+    fields   []string
+    expected []string
+  }{
+    {
+      name: "File",
+      path: "/file.txt",
+      expected: []string{
+        "X-Content-Type-Options: nosniff",
+        "X-Frame-Options: DENY",
+        "Referrer-Policy: no-referrer",
+      },
+    },
+    {
+      name: "Listing",
+      path: "/sub/",
+      expected: []string{
+        "X-Content-Type-Options: nosniff",
+        "X-Frame-Options: DENY",
+        "Referrer-Policy: no-referrer",
+        "Content-Security-Policy: " + listingCSP,
+      },
+    },
+    {
+      name: "Error",
+      path: "/missing",
+      expected: []string{
+        "X-Content-Type-Options: nosniff",
+        "X-Frame-Options: DENY",
+        "Referrer-Policy: no-referrer",
+      },
+    },
+    {
+      name:   "Overridden by -header",
+      path:   "/file.txt",
+      fields: []string{"X-Frame-Options: SAMEORIGIN", "Cache-Control: no-store"},
+      expected: []string{
+        "X-Content-Type-Options: nosniff",
+        "X-Frame-Options: SAMEORIGIN",
+        "Referrer-Policy: no-referrer",
+        "Cache-Control: no-store",
+      },
+    },
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      useExtraHeaders(t, true, tc.fields...)
+
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+
+      headers, _, _ := strings.Cut(conn.GetWrittenData(), "\r\n\r\n")
+      for _, field := range tc.expected {
+        if !strings.Contains(headers+"\r\n", "\r\n"+field+"\r\n") {
+          t.Errorf("Expected %q, got: %s", field, headers)
+        }
+      }
+      if strings.Count(headers, "X-Frame-Options") != 1 {
+        t.Errorf("Expected a single X-Frame-Options field, got: %s", headers)
+      }
+    })
+  }
+}
+
+func TestSecureHeadersDisabled(t *testing.T) {
+  useExtraHeaders(t, false)
+
+  conn := newMockConn("GET /missing HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+
+  if response := conn.GetWrittenData(); strings.Contains(response, "X-Frame-Options") {
+    t.Errorf("Expected no security headers by default, got: %s", response)
+  }
+}
+
+func TestHeaderValuesCannotSplit(t *testing.T) {
+  conn := newMockConn("")
+  header := responseHeader{}
+  header.set("Content-Disposition", "attachment; filename=\"a\r\nX-Injected: 1\"")
+  writeResponseHeader(conn, 200, "OK", header)
+
+  if response := conn.GetWrittenData(); strings.Contains(response, "\r\nX-Injected") {
+    t.Errorf("Expected line breaks to be stripped from header values, got: %q", response)
+  }
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+  "net"
+  "sync/atomic"
+)
+
+var healthChecks bool
+
+// ready is set once the server accepts connections and cleared when it starts shutting down.
+var ready atomic.Bool
+
+// sendLiveness answers /healthz: the process is up and handling requests.
+func sendLiveness(conn net.Conn, req *request) {
+  sendText(conn, 200, "OK", "text/plain", "ok\n")
+}
+
+// sendReadiness answers /readyz: 200 while the server is ready for traffic, 503 during startup and shutdown.
+func sendReadiness(conn net.Conn, req *request) {
+  if !ready.Load() {
+    sendError(conn, 503, "Service Unavailable")
+    return
+  }
+  sendText(conn, 200, "OK", "text/plain", "ready\n")
+}
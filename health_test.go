@@ -0,0 +1,36 @@
+package main
+
+import (
+  "strings"
+  "testing"
+  "time"
+)
+
+func TestReadiness(t *testing.T) {
+  healthChecks = true
+  defer func() { healthChecks = false }()
+
+  fetch := func(path string) string {
+    conn := newMockConn("GET " + path + " HTTP/1.1\r\n\r\n")
+    handleConnection(conn)
+    return conn.GetWrittenData()
+  }
+
+  if response := fetch("/readyz"); !strings.HasPrefix(response, "HTTP/1.1 503") {
+    t.Errorf("Expected 503 before the server runs, got: %s", response)
+  }
+  if response := fetch("/healthz"); !strings.HasPrefix(response, "HTTP/1.1 200 OK") {
+    t.Errorf("Expected liveness to succeed during startup, got: %s", response)
+  }
+
+  server, _, _ := startTestServer(t, 1)
+  waitFor(t, "the server to become ready", ready.Load)
+  if response := fetch("/readyz"); !strings.HasPrefix(response, "HTTP/1.1 200 OK") {
+    t.Errorf("Expected 200 once running, got: %s", response)
+  }
+
+  server.Shutdown(time.Second)
+  if response := fetch("/readyz"); !strings.HasPrefix(response, "HTTP/1.1 503") {
+    t.Errorf("Expected 503 after shutdown, got: %s", response)
+  }
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+  "bufio"
+  "os"
+  "path"
+  "path/filepath"
+  "strings"
+)
+
+// ignoreFileName names the per-directory file listing glob patterns of entries to hide.
+const ignoreFileName = ".ghttpdignore"
+
+// ignorePatterns returns the patterns of dir's ignore file, skipping blank lines and # comments.
+// A missing or unreadable ignore file hides nothing.
+func ignorePatterns(dir string) []string {
+  file, err := os.Open(filepath.Join(dir, ignoreFileName))
+  if err != nil {
+    return nil
+  }
+  defer file.Close()
+
+  var patterns []string
+  scanner := bufio.NewScanner(file)
+  for scanner.Scan() {
+    line := strings.TrimSpace(scanner.Text())
+    if line != "" && !strings.HasPrefix(line, "#") {
+      patterns = append(patterns, strings.Trim(line, "/"))
+    }
+  }
+  return patterns
+}
+
+// matchesIgnore reports whether the slash separated path rel, relative to the directory holding
+// the patterns, is hidden. The ignore file itself and auth files are always hidden, in any case
+// since case-insensitive file systems open them under any spelling.
+func matchesIgnore(patterns []string, rel string) bool {
+  if strings.EqualFold(rel, ignoreFileName) || strings.EqualFold(rel, authFileName) {
+    return true
+  }
+  for _, pattern := range patterns {
+    if matched, _ := path.Match(pattern, rel); matched {
+      return true
+    }
+  }
+  return false
+}
+
+// ignoreCache memoizes ignore patterns per directory while a single request is served.
+type ignoreCache map[string][]string
+
+func (c ignoreCache) patterns(dir string) []string {
+  patterns, ok := c[dir]
+  if !ok {
+    patterns = ignorePatterns(dir)
+    c[dir] = patterns
+  }
+  return patterns
+}
+
+// pathIgnored reports whether urlPath, resolved under root, is hidden by the ignore file of
+// any directory on the way down. Patterns are evaluated relative to the directory they are in.
+func pathIgnored(root, urlPath string) bool {
+  return ignoreCache{}.pathIgnored(root, urlPath)
+}
+
+func (c ignoreCache) pathIgnored(root, urlPath string) bool {
+  components := strings.Split(strings.Trim(urlPath, "/"), "/")
+  if len(components) == 1 && components[0] == "" {
+    return false
+  }
+
+  dir := root
+  for i := range components {
+    patterns := c.patterns(dir)
+    for j := i; j < len(components); j++ {
+      if matchesIgnore(patterns, strings.Join(components[i:j+1], "/")) {
+        return true
+      }
+    }
+    dir = filepath.Join(dir, components[i])
+  }
+  return false
+}
+
+// entryIgnored reports whether the entry name of the directory dir is hidden, taking the ignore
+// files of dir and of its parents up to the document root containing it into account.
+func (c ignoreCache) entryIgnored(dir, name string) bool {
+  for _, root := range roots {
+    rel, err := filepath.Rel(root, dir)
+    if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+      return c.pathIgnored(root, urlPathOf(filepath.Join(rel, name)))
+    }
+  }
+  return matchesIgnore(c.patterns(dir), name)
+}
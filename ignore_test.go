@@ -0,0 +1,61 @@
+package main
+
+import (
+  "fmt"
+  "strings"
+  "testing"
+)
+
+func TestGhttpdIgnore(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    ".ghttpdignore":        "# hide drafts and logs\n*.draft\nprivate\nsub/*.log\n",
+    "index.html":           "index",
+    "post.draft":           "draft",
+    "private/secret.txt":   "secret",
+    "sub/app.log":          "log",
+    "sub/page.html":        "page",
+    "sub/.ghttpdignore":    "local.txt\n",
+    "sub/local.txt":        "local",
+    "other/local.txt":      "visible",
+  })
+  useRoots(t, tempDir)
+
+  testCases := []struct {
+    path         string
+    expectedCode string
+  }{
+    {path: "/index.html", expectedCode: "HTTP/1.1 200 OK"},
+    {path: "/post.draft", expectedCode: "HTTP/1.1 404 Not Found"},
+    {path: "/private", expectedCode: "HTTP/1.1 404 Not Found"},
+    {path: "/private/secret.txt", expectedCode: "HTTP/1.1 404 Not Found"},
+    {path: "/sub/app.log", expectedCode: "HTTP/1.1 404 Not Found"},
+    {path: "/sub/page.html", expectedCode: "HTTP/1.1 200 OK"},
+    {path: "/sub/local.txt", expectedCode: "HTTP/1.1 404 Not Found"},
+    {path: "/other/local.txt", expectedCode: "HTTP/1.1 200 OK"},
+    {path: "/.ghttpdignore", expectedCode: "HTTP/1.1 404 Not Found"},
+  }
+
+  for _, tc := range testCases {
+    conn := newMockConn(fmt.Sprintf("GET %s HTTP/1.1\r\n\r\n", tc.path))
+    handleConnection(conn)
+    if response := conn.GetWrittenData(); !strings.HasPrefix(response, tc.expectedCode) {
+      t.Errorf("Expected %s for %s, got: %s", tc.expectedCode, tc.path, response)
+    }
+  }
+
+  listings := map[string][]string{
+    "/":    {"post.draft", "private", ".ghttpdignore"},
+    "/sub": {"app.log", "local.txt", ".ghttpdignore"},
+  }
+  for path, hidden := range listings {
+    conn := newMockConn(fmt.Sprintf("GET %s HTTP/1.1\r\n\r\n", path))
+    handleConnection(conn)
+    response := conn.GetWrittenData()
+    for _, name := range hidden {
+      if strings.Contains(response, ">"+name+"<") {
+        t.Errorf("Expected %s to be hidden from the listing of %s, got: %s", name, path, response)
+      }
+    }
+  }
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+  "fmt"
+  "net"
+  "strings"
+)
+
+// indexFile is the file served for a directory by the "index" step of -directory-strategy.
+var indexFile = "index.html"
+
+// listingMaxDepth stops the "listing" step for directories more than this many path segments
+// deep, so huge trees cannot be browsed all the way down; 0 means no limit. Files and index
+// pages at any depth are still served.
+var listingMaxDepth int
+
+// pathDepth counts the segments of a URL path: "/" is 0 deep, "/a/b/" is 2.
+func pathDepth(urlPath string) int {
+  trimmed := strings.Trim(cleanURLPath(urlPath), "/")
+  if trimmed == "" {
+    return 0
+  }
+  return strings.Count(trimmed, "/") + 1
+}
+
+// directoryStep is one way of answering a request for a directory.
+type directoryStep string
+
+const (
+  // stepIndex serves the directory's own index file.
+  stepIndex directoryStep = "index"
+  // stepSPA serves the index file at the root, for single-page applications routing on the client.
+  stepSPA directoryStep = "spa"
+  // stepListing generates the directory listing.
+  stepListing directoryStep = "listing"
+)
+
+// directoryStrategy is the -directory-strategy flag: the steps tried in order for a directory
+// request. The first applicable step answers; when none does the request gets 403.
+type directoryStrategy []directoryStep
+
+var directorySteps = directoryStrategy{stepListing}
+
+func (s *directoryStrategy) String() string {
+  var names []string
+  for _, step := range *s {
+    names = append(names, string(step))
+  }
+  return strings.Join(names, ",")
+}
+
+// Set replaces the strategy; unlike repeatable flags, the last value given wins.
+func (s *directoryStrategy) Set(value string) error {
+  var steps directoryStrategy
+  for _, item := range strings.Split(value, ",") {
+    step := directoryStep(strings.ToLower(strings.TrimSpace(item)))
+    switch step {
+    case "":
+      continue
+    case stepIndex, stepSPA, stepListing:
+      steps = append(steps, step)
+    default:
+      return fmt.Errorf("unknown directory step %q (expected index, spa or listing)", item)
+    }
+  }
+  *s = steps
+  return nil
+}
+
+// serveDirectory answers a request for the directory backed by dirs with the first applicable
+// step of -directory-strategy, or of the strategy of the -mount it is in.
+func serveDirectory(conn net.Conn, req *request, dirs []string) {
+  steps, index, spaRoot := directoryPolicy(req.path)
+  for _, step := range steps {
+    switch step {
+    case stepIndex:
+      if file, ok := locateIndex(req, req.path, index); ok {
+        sendFile(conn, req, file)
+        return
+      }
+    case stepSPA:
+      if file, ok := locateIndex(req, spaRoot, index); ok {
+        sendFile(conn, req, file)
+        return
+      }
+    case stepListing:
+      if listingMaxDepth > 0 && pathDepth(req.path) > listingMaxDepth {
+        continue
+      }
+      files, err := readListing(dirs)
+      if err != nil {
+        sendFSError(conn, err)
+        return
+      }
+      writeListing(conn, req, files)
+      return
+    }
+  }
+  sendError(conn, 403, "Forbidden")
+}
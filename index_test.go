@@ -0,0 +1,172 @@
+package main
+
+import (
+  "strings"
+  "testing"
+)
+
+func useDirectoryStrategy(t *testing.T, value string) {
+  t.Helper()
+  original := directorySteps
+  if err := directorySteps.Set(value); err != nil {
+    t.Fatalf("Invalid directory strategy %q: %v", value, err)
+  }
+  t.Cleanup(func() { directorySteps = original })
+}
+
+func TestDirectoryStrategy(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "index.html":      "root index",
+    "docs/index.html": "docs index",
+    "assets/app.js":   "app",
+  })
+  useRoots(t, tempDir)
+
+  testCases := []struct {
+    name         string
+    strategy     string
+    path         string
+    expectedCode string
+    expectedBody string
+  }{
+    {"Index file", "index,spa,listing", "/docs/", "HTTP/1.1 200 OK", "docs index"},
+    {"SPA fallback", "index,spa,listing", "/assets/", "HTTP/1.1 200 OK", "root index"},
+    {"Listing after missing index", "index,listing", "/assets/", "HTTP/1.1 200 OK", `<a href="/assets/app.js">app.js</a>`},
+    {"Listing before index", "listing,index", "/docs/", "HTTP/1.1 200 OK", `<a href="/docs/index.html">index.html</a>`},
+    {"No step applies", "index", "/assets/", "HTTP/1.1 403 Forbidden", "Forbidden"},
+    {"Empty strategy", "", "/docs/", "HTTP/1.1 403 Forbidden", "Forbidden"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      useDirectoryStrategy(t, tc.strategy)
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+      response := conn.GetWrittenData()
+
+      if !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+      if !strings.Contains(response, tc.expectedBody) {
+        t.Errorf("Expected the body to contain %q, got: %s", tc.expectedBody, response)
+      }
+    })
+  }
+}
+
+func TestDirectoryStrategyInvalid(t *testing.T) {
+  var steps directoryStrategy
+  if err := steps.Set("index,gallery"); err == nil {
+    t.Errorf("Expected an error for an unknown step")
+  }
+}
+
+func TestListingMaxDepth(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "a/b/c/deep.txt":   "deep",
+    "a/b/c/index.html": "deep index",
+    "a/shallow.txt":    "shallow",
+  })
+  useRoots(t, tempDir)
+
+  original := listingMaxDepth
+  listingMaxDepth = 2
+  defer func() { listingMaxDepth = original }()
+
+  testCases := []struct {
+    name         string
+    strategy     string
+    path         string
+    expectedCode string
+    expectedBody string
+  }{
+    {"Root", "listing", "/", "HTTP/1.1 200 OK", `<a href="/a">a</a>`},
+    {"At the limit", "listing", "/a/b/", "HTTP/1.1 200 OK", `<a href="/a/b/c">c</a>`},
+    {"Beyond the limit", "listing", "/a/b/c/", "HTTP/1.1 403 Forbidden", "Forbidden"},
+    {"Beyond the limit with dot segments", "listing", "/a/./b/c", "HTTP/1.1 403 Forbidden", "Forbidden"},
+    {"Index beyond the limit", "listing,index", "/a/b/c/", "HTTP/1.1 200 OK", "deep index"},
+    {"File beyond the limit", "listing", "/a/b/c/deep.txt", "HTTP/1.1 200 OK", "deep"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      useDirectoryStrategy(t, tc.strategy)
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+      response := conn.GetWrittenData()
+
+      if !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+      if !strings.Contains(response, tc.expectedBody) {
+        t.Errorf("Expected the body to contain %q, got: %s", tc.expectedBody, response)
+      }
+    })
+  }
+}
+
+func TestMobileIndex(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "index.html":        "desktop home",
+    "index.mobile.html": "mobile home",
+    "docs/index.html":   "desktop docs",
+  })
+  useRoots(t, tempDir)
+  useDirectoryStrategy(t, "index,listing")
+
+  originalIndex, originalPatterns := mobileIndex, mobilePatterns
+  mobileIndex = "index.mobile.html"
+  defer func() { mobileIndex, mobilePatterns = originalIndex, originalPatterns }()
+
+  const (
+    iPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148 Safari/604.1"
+    android = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/126.0 Mobile Safari/537.36"
+    desktop = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/126.0 Safari/537.36"
+  )
+
+  testCases := []struct {
+    name         string
+    patterns     []string
+    agent        string
+    path         string
+    expectedBody string
+    expectVary   bool
+  }{
+    {"iPhone", nil, iPhone, "/", "mobile home", true},
+    {"Android", nil, android, "/", "mobile home", true},
+    {"Desktop", nil, desktop, "/", "desktop home", true},
+    {"No User-Agent", nil, "", "/", "desktop home", true},
+    {"No mobile variant", nil, iPhone, "/docs/", "desktop docs", false},
+    {"Custom pattern", []string{`Windows NT`}, desktop, "/", "mobile home", true},
+    {"Custom pattern replaces built-in", []string{`Windows NT`}, iPhone, "/", "desktop home", true},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      mobilePatterns = nil
+      for _, pattern := range tc.patterns {
+        if err := mobilePatterns.Set(pattern); err != nil {
+          t.Fatalf("Unexpected error: %v", err)
+        }
+      }
+
+      request := "GET " + tc.path + " HTTP/1.1\r\n"
+      if tc.agent != "" {
+        request += "User-Agent: " + tc.agent + "\r\n"
+      }
+      conn := newMockConn(request + "\r\n")
+      handleConnection(conn)
+      response := conn.GetWrittenData()
+
+      if !strings.HasPrefix(response, "HTTP/1.1 200 OK") || !strings.HasSuffix(response, tc.expectedBody) {
+        t.Errorf("Expected %q, got: %s", tc.expectedBody, response)
+      }
+      if varies := strings.Contains(response, "Vary: User-Agent\r\n"); varies != tc.expectVary {
+        t.Errorf("Expected Vary: User-Agent %v, got: %s", tc.expectVary, response)
+      }
+    })
+  }
+}
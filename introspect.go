@@ -0,0 +1,93 @@
+package main
+
+import (
+  "encoding/json"
+  "net"
+  "sort"
+)
+
+// configEndpointPath answers with the effective routing configuration, for debugging.
+const configEndpointPath = "/__config"
+
+// configEndpointAuth names the htpasswd file whose users may read /__config. The endpoint reveals
+// directories and rules, so it is only served when this is set.
+var configEndpointAuth string
+
+type routingConfig struct {
+  Roots             []string         `json:"roots"`
+  StripPrefix       string           `json:"strip_prefix,omitempty"`
+  DirectoryStrategy []directoryStep  `json:"directory_strategy"`
+  Index             string           `json:"index"`
+  Mounts            []mountConfig    `json:"mounts"`
+  Redirects         []redirectConfig `json:"redirects"`
+  ExtensionAliases  []aliasConfig    `json:"extension_aliases"`
+  TryExtensions     []string         `json:"try_extensions"`
+  AllowedExtensions []string         `json:"allowed_extensions"`
+}
+
+type mountConfig struct {
+  Prefix            string          `json:"prefix"`
+  Dir               string          `json:"dir"`
+  DirectoryStrategy []directoryStep `json:"directory_strategy"`
+  Index             string          `json:"index"`
+  ReadOnly          bool            `json:"read_only"`
+}
+
+type redirectConfig struct {
+  From   string `json:"from"`
+  To     string `json:"to"`
+  Status int    `json:"status"`
+}
+
+type aliasConfig struct {
+  Extension   string `json:"extension"`
+  Target      string `json:"target"`
+  ContentType string `json:"content_type"`
+}
+
+// effectiveConfig collects the routing settings in effect, with mount policies resolved against
+// the global flags they fall back to.
+func effectiveConfig() routingConfig {
+  config := routingConfig{
+    Roots:             append([]string{}, roots...),
+    StripPrefix:       stripPrefix,
+    DirectoryStrategy: append([]directoryStep{}, directorySteps...),
+    Index:             indexFile,
+    Mounts:            []mountConfig{},
+    Redirects:         []redirectConfig{},
+    ExtensionAliases:  []aliasConfig{},
+    TryExtensions:     append([]string{}, tryExtensions...),
+    AllowedExtensions: append([]string{}, allowedExtensions...),
+  }
+
+  for _, m := range mounts {
+    steps, index, _ := directoryPolicy(m.prefix + "/")
+    config.Mounts = append(config.Mounts, mountConfig{Prefix: m.prefix, Dir: m.dir, DirectoryStrategy: steps, Index: index, ReadOnly: m.readOnly})
+  }
+  for _, rule := range redirects {
+    config.Redirects = append(config.Redirects, redirectConfig{From: rule.from, To: rule.target, Status: rule.code})
+  }
+  for ext, alias := range extensionAliases {
+    config.ExtensionAliases = append(config.ExtensionAliases, aliasConfig{Extension: ext, Target: alias.target, ContentType: alias.contentType})
+  }
+  sort.Slice(config.ExtensionAliases, func(i, j int) bool {
+    return config.ExtensionAliases[i].Extension < config.ExtensionAliases[j].Extension
+  })
+  return config
+}
+
+// sendConfig answers /__config with the effective routing configuration as JSON, to users of the
+// -config-endpoint-auth file only.
+func sendConfig(conn net.Conn, req *request) {
+  if !credentialsMatch(req, configEndpointAuth) {
+    sendUnauthorized(conn)
+    return
+  }
+
+  body, err := json.MarshalIndent(effectiveConfig(), "", "  ")
+  if err != nil {
+    sendError(conn, 500, "Internal Server Error")
+    return
+  }
+  sendText(conn, 200, "OK", "application/json", string(body)+"\n")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+  "encoding/base64"
+  "encoding/json"
+  "path/filepath"
+  "slices"
+  "strings"
+  "testing"
+)
+
+func TestConfigEndpoint(t *testing.T) {
+  tempDir, filesDir := t.TempDir(), t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"admins": "alice:$apr1$saltsalt$LrttParrLPdxvgutaSXWJ0\n"})
+  useRoots(t, tempDir)
+
+  originalAuth, originalMounts, originalRedirects := configEndpointAuth, mounts, redirects
+  defer func() { configEndpointAuth, mounts, redirects = originalAuth, originalMounts, originalRedirects }()
+  mounts, redirects = nil, nil
+  for _, value := range []string{"/downloads=" + filesDir + ";strategy=listing", "/app=" + filesDir + ";strategy=index,spa;index=app.html;read-only"} {
+    if err := mounts.Set(value); err != nil {
+      t.Fatalf("Unexpected error: %v", err)
+    }
+  }
+  if err := redirects.Set("/old=/new 302"); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+
+  get := func(credentials string) string {
+    request := "GET /__config HTTP/1.1\r\n"
+    if credentials != "" {
+      request += "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(credentials)) + "\r\n"
+    }
+    conn := newMockConn(request + "\r\n")
+    handleConnection(conn)
+    return conn.GetWrittenData()
+  }
+
+  if response := get("alice:secret"); !strings.HasPrefix(response, "HTTP/1.1 404 Not Found") {
+    t.Errorf("Expected 404 without -config-endpoint-auth, got: %s", response)
+  }
+
+  configEndpointAuth = filepath.Join(tempDir, "admins")
+  for _, credentials := range []string{"", "alice:wrong", "mallory:secret"} {
+    if response := get(credentials); !strings.HasPrefix(response, "HTTP/1.1 401 Unauthorized") {
+      t.Errorf("Expected 401 for credentials %q, got: %s", credentials, response)
+    }
+  }
+
+  response := get("alice:secret")
+  if !strings.HasPrefix(response, "HTTP/1.1 200 OK") || !strings.Contains(response, "Content-Type: application/json\r\n") {
+    t.Fatalf("Expected JSON for valid credentials, got: %s", response)
+  }
+  _, body, _ := strings.Cut(response, "\r\n\r\n")
+  var config routingConfig
+  if err := json.Unmarshal([]byte(body), &config); err != nil {
+    t.Fatalf("Expected valid JSON, got %v: %s", err, body)
+  }
+
+  expectedMounts := []mountConfig{
+    {Prefix: "/downloads", Dir: filesDir, DirectoryStrategy: []directoryStep{stepListing}, Index: "index.html"},
+    {Prefix: "/app", Dir: filesDir, DirectoryStrategy: []directoryStep{stepIndex, stepSPA}, Index: "app.html", ReadOnly: true},
+  }
+  if len(config.Mounts) != len(expectedMounts) {
+    t.Fatalf("Expected %d mounts, got: %+v", len(expectedMounts), config.Mounts)
+  }
+  for i, expected := range expectedMounts {
+    got := config.Mounts[i]
+    if got.Prefix != expected.Prefix || got.Dir != expected.Dir || got.Index != expected.Index || got.ReadOnly != expected.ReadOnly ||
+      !slices.Equal(got.DirectoryStrategy, expected.DirectoryStrategy) {
+      t.Errorf("Expected mount %+v, got %+v", expected, got)
+    }
+  }
+  if len(config.Redirects) != 1 || config.Redirects[0] != (redirectConfig{From: "/old", To: "/new", Status: 302}) {
+    t.Errorf("Expected the redirect, got: %+v", config.Redirects)
+  }
+  if len(config.Roots) != 1 || config.Roots[0] != tempDir {
+    t.Errorf("Expected the roots, got: %+v", config.Roots)
+  }
+}
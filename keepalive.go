@@ -0,0 +1,48 @@
+package main
+
+import (
+  "bufio"
+  "net"
+  "strings"
+  "time"
+)
+
+// requestTimeout bounds reading a request and writing its response.
+const requestTimeout = 5 * time.Second
+
+// keepAliveTimeout is how long a persistent connection may sit idle between requests.
+// Zero disables persistent connections: every connection serves a single request.
+var keepAliveTimeout time.Duration
+
+// maxKeepAliveRequests caps the requests served on one persistent connection; the response to the
+// last one carries Connection: close. Zero leaves connections unlimited.
+var maxKeepAliveRequests = 100
+
+// wantsKeepAlive reports whether the connection may serve another request after req.
+// Only HTTP/1.1 clients that did not ask to close are kept, and requests with a body are not,
+// as the body is never read and would be taken for the next request.
+func wantsKeepAlive(req *request) bool {
+  if keepAliveTimeout <= 0 || strings.TrimSpace(req.version) != "HTTP/1.1" {
+    return false
+  }
+  for _, token := range strings.Split(req.header("Connection"), ",") {
+    if strings.EqualFold(strings.TrimSpace(token), "close") {
+      return false
+    }
+  }
+  contentLength := strings.TrimSpace(req.header("Content-Length"))
+  return req.header("Transfer-Encoding") == "" && (contentLength == "" || contentLength == "0")
+}
+
+// awaitNextRequest waits up to the keep-alive timeout for the next request to start arriving.
+// It reports false when the client closed the connection or stayed idle for too long. Once a
+// request starts, the usual request timeout applies to it.
+func awaitNextRequest(conn net.Conn, reader *bufio.Reader) bool {
+  conn.SetReadDeadline(time.Now().Add(keepAliveTimeout))
+  if _, err := reader.Peek(1); err != nil {
+    debugf("Closing idle connection: %v", err)
+    return false
+  }
+  conn.SetDeadline(time.Now().Add(requestTimeout))
+  return true
+}
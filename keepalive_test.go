@@ -0,0 +1,241 @@
+package main
+
+import (
+  "bufio"
+  "compress/gzip"
+  "io"
+  "net"
+  "strconv"
+  "strings"
+  "testing"
+  "time"
+)
+
+// useKeepAlive enables persistent connections with the given idle timeout for the duration of the test.
+func useKeepAlive(t *testing.T, timeout time.Duration) {
+  t.Helper()
+  original := keepAliveTimeout
+  keepAliveTimeout = timeout
+  t.Cleanup(func() { keepAliveTimeout = original })
+}
+
+// readResponse reads one response with a Content-Length delimited body from reader.
+func readResponse(t *testing.T, reader *bufio.Reader) (string, string) {
+  t.Helper()
+
+  var headers strings.Builder
+  contentLength := 0
+  for {
+    line, err := reader.ReadString('\n')
+    if err != nil {
+      t.Fatalf("Failed to read response header: %v", err)
+    }
+    if line == "\r\n" {
+      break
+    }
+    headers.WriteString(line)
+    if value, found := strings.CutPrefix(line, "Content-Length: "); found {
+      contentLength, _ = strconv.Atoi(strings.TrimSpace(value))
+    }
+  }
+
+  body := make([]byte, contentLength)
+  if _, err := io.ReadFull(reader, body); err != nil {
+    t.Fatalf("Failed to read response body: %v", err)
+  }
+  return headers.String(), string(body)
+}
+
+func TestKeepAlive(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"a.txt": "first", "b.txt": "second"})
+  useRoots(t, tempDir)
+  useKeepAlive(t, 100*time.Millisecond)
+
+  _, addr, _ := startTestServer(t, 1)
+  conn, err := net.Dial("tcp", addr)
+  if err != nil {
+    t.Fatalf("Failed to connect: %v", err)
+  }
+  defer conn.Close()
+  reader := bufio.NewReader(conn)
+
+  // Two pipelined requests and a third after a short pause share the connection.
+  conn.Write([]byte("GET /a.txt HTTP/1.1\r\n\r\nGET /b.txt HTTP/1.1\r\n\r\n"))
+  for _, expected := range []string{"first", "second"} {
+    if headers, body := readResponse(t, reader); body != expected || strings.Contains(headers, "Connection: close") {
+      t.Errorf("Expected a persistent response with %q, got %q and headers %s", expected, body, headers)
+    }
+  }
+
+  time.Sleep(20 * time.Millisecond)
+  conn.Write([]byte("GET /a.txt HTTP/1.1\r\n\r\n"))
+  if _, body := readResponse(t, reader); body != "first" {
+    t.Errorf("Expected the connection to serve a request after a pause, got %q", body)
+  }
+
+  // Idle past the timeout, the server closes the connection.
+  start := time.Now()
+  conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+  if _, err := reader.ReadByte(); err != io.EOF {
+    t.Errorf("Expected the idle connection to be closed, got: %v", err)
+  }
+  if elapsed := time.Since(start); elapsed > time.Second {
+    t.Errorf("Expected the idle connection to be closed after about 100ms, took %v", elapsed)
+  }
+}
+
+func TestKeepAliveGzip(t *testing.T) {
+  tempDir := t.TempDir()
+  text := compressibleText()
+  writeTestFiles(t, tempDir, map[string]string{"page.txt": text, "a.txt": "first"})
+  useRoots(t, tempDir)
+  useKeepAlive(t, time.Second)
+  useGzip(t, 6)
+
+  _, addr, _ := startTestServer(t, 1)
+  conn, err := net.Dial("tcp", addr)
+  if err != nil {
+    t.Fatalf("Failed to connect: %v", err)
+  }
+  defer conn.Close()
+  reader := bufio.NewReader(conn)
+
+  // A compressed response is chunked, so the connection stays open for the requests after it.
+  request := "GET /page.txt HTTP/1.1\r\nAccept-Encoding: gzip\r\n\r\n"
+  conn.Write([]byte(request + request + "GET /a.txt HTTP/1.1\r\n\r\n"))
+  for i := 0; i < 2; i++ {
+    headers, _ := readResponse(t, reader)
+    if !strings.Contains(headers, "Transfer-Encoding: chunked") || strings.Contains(headers, "Connection: close") {
+      t.Fatalf("Expected a persistent chunked response, got headers %s", headers)
+    }
+    gz, err := gzip.NewReader(strings.NewReader(readChunked(t, reader)))
+    if err != nil {
+      t.Fatalf("Expected a gzip body: %v", err)
+    }
+    if decoded, err := io.ReadAll(gz); err != nil || string(decoded) != text {
+      t.Errorf("Expected response %d to decompress to the file (%v)", i+1, err)
+    }
+  }
+
+  if _, body := readResponse(t, reader); body != "first" {
+    t.Errorf("Expected the connection to serve a request after the compressed ones, got %q", body)
+  }
+}
+
+func TestKeepAliveClose(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"a.txt": "first"})
+  useRoots(t, tempDir)
+  useKeepAlive(t, time.Second)
+
+  testCases := []struct {
+    name    string
+    request string
+  }{
+    {name: "Connection close", request: "GET /a.txt HTTP/1.1\r\nConnection: close\r\n\r\n"},
+    {name: "HTTP/1.0", request: "GET /a.txt HTTP/1.0\r\n\r\n"},
+    {name: "Error response", request: "GET /missing HTTP/1.1\r\n\r\n"},
+    {name: "Request body", request: "GET /a.txt HTTP/1.1\r\nContent-Length: 3\r\n\r\nabc"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn(tc.request + "GET /a.txt HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if strings.Count(response, "HTTP/1.1 ") != 1 {
+        t.Errorf("Expected a single response before closing, got: %s", response)
+      }
+      if !strings.Contains(response, "Connection: close\r\n") {
+        t.Errorf("Expected Connection: close to be announced, got: %s", response)
+      }
+    })
+  }
+}
+
+func TestKeepAliveHalfClose(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"a.txt": "first"})
+  useRoots(t, tempDir)
+  useKeepAlive(t, time.Second)
+  logs := captureLog(t)
+
+  testCases := []struct {
+    name          string
+    input         string
+    expectedCodes []string
+    expectError   bool
+  }{
+    {"At a request boundary", "GET /a.txt HTTP/1.1\r\n\r\nGET /a.txt HTTP/1.1\r\n\r\n", []string{"200 OK", "200 OK"}, false},
+    {"Before any request", "", nil, false},
+    {"Mid request", "GET /a.txt HTTP/1.1\r\n\r\nGET /a.t", []string{"200 OK", "400 Bad Request"}, true},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      logs.Reset()
+      // The mock connection returns io.EOF once the input is consumed, like a client that
+      // shut down its sending side.
+      conn := newMockConn(tc.input)
+      handleConnection(conn)
+      response := conn.GetWrittenData()
+
+      if count := strings.Count(response, "HTTP/1.1 "); count != len(tc.expectedCodes) {
+        t.Errorf("Expected %d responses, got: %s", len(tc.expectedCodes), response)
+      }
+      for _, code := range tc.expectedCodes {
+        if !strings.Contains(response, "HTTP/1.1 "+code) {
+          t.Errorf("Expected a %s response, got: %s", code, response)
+        }
+      }
+      if logged := strings.Contains(logs.String(), "Error"); logged != tc.expectError {
+        t.Errorf("Expected error logged=%v, got: %s", tc.expectError, logs)
+      }
+    })
+  }
+}
+
+func TestMaxKeepAliveRequests(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"a.txt": "first"})
+  useRoots(t, tempDir)
+  useKeepAlive(t, time.Second)
+
+  original := maxKeepAliveRequests
+  defer func() { maxKeepAliveRequests = original }()
+
+  testCases := []struct {
+    name              string
+    limit             int
+    expectedResponses int
+  }{
+    {"Limit of one", 1, 1},
+    {"Limit of three", 3, 3},
+    {"No limit", 0, 5},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      maxKeepAliveRequests = tc.limit
+
+      conn := newMockConn(strings.Repeat("GET /a.txt HTTP/1.1\r\n\r\n", 5))
+      handleConnection(conn)
+      response := conn.GetWrittenData()
+
+      if count := strings.Count(response, "HTTP/1.1 200 OK"); count != tc.expectedResponses {
+        t.Errorf("Expected %d responses, got %d: %s", tc.expectedResponses, count, response)
+      }
+      // Only the response to the last allowed request announces the close.
+      last := response[strings.LastIndex(response, "HTTP/1.1 "):]
+      closes := strings.Count(response, "Connection: close\r\n")
+      if tc.limit > 0 && (closes != 1 || !strings.Contains(last, "Connection: close\r\n")) {
+        t.Errorf("Expected Connection: close on the last response only, got: %s", response)
+      }
+      if tc.limit == 0 && closes != 0 {
+        t.Errorf("Expected no Connection: close without a limit, got: %s", response)
+      }
+    })
+  }
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "html"
+  "io/fs"
+  "net"
+  "net/url"
+  "os"
+  "sort"
+  "strconv"
+  "strings"
+  "time"
+  "unicode/utf8"
+)
+
+// listingEntry is the JSON representation of a directory listing entry.
+type listingEntry struct {
+  Name    string    `json:"name"`
+  Path    string    `json:"path"`
+  IsDir   bool      `json:"is_dir"`
+  Size    int64     `json:"size"`
+  ModTime time.Time `json:"mod_time"`
+}
+
+// listingNameMax is the number of characters of a name shown in HTML listings; 0 disables truncation.
+var listingNameMax int
+
+// truncateName shortens name to max characters, the last one being an ellipsis.
+func truncateName(name string, max int) string {
+  if max <= 0 || utf8.RuneCountInString(name) <= max {
+    return name
+  }
+  runes := []rune(name)
+  return string(runes[:max-1]) + "…"
+}
+
+// listingSummary adds a line counting the files and subdirectories of HTML listings, with the
+// total size of the files.
+var listingSummary bool
+
+// summarizeListing describes files as e.g. "3 files, 1 directory, 1.5 KB". Sizes come from the
+// entries already read; subdirectories count as entries but add nothing to the total.
+func summarizeListing(files []fs.DirEntry) string {
+  var fileCount, dirCount int
+  var total int64
+  for _, file := range files {
+    if file.IsDir() {
+      dirCount++
+      continue
+    }
+    fileCount++
+    if info, err := file.Info(); err == nil {
+      total += info.Size()
+    }
+  }
+  return fmt.Sprintf("%s, %s, %s", plural(fileCount, "file", "files"), plural(dirCount, "directory", "directories"), formatSize(total))
+}
+
+func plural(n int, singular, pluralForm string) string {
+  if n == 1 {
+    return "1 " + singular
+  }
+  return strconv.Itoa(n) + " " + pluralForm
+}
+
+// formatSize renders a byte count with the largest unit of byteUnits it reaches.
+func formatSize(n int64) string {
+  for _, unit := range byteUnits {
+    if n >= unit.multiplier && unit.multiplier > 1 {
+      return fmt.Sprintf("%.1f %s", float64(n)/float64(unit.multiplier), unit.suffix)
+    }
+  }
+  return fmt.Sprintf("%d B", n)
+}
+
+// listingDetails adds the modification time, and the size of files, after each HTML listing entry.
+// Times are rendered with the Go layout listingDateFormat in listingLocation.
+var (
+  listingDetails    bool
+  listingDateFormat = "2006-01-02 15:04"
+  listingTimezone   = "Local"
+  listingLocation   = time.Local
+)
+
+// loadListingTimezone resolves -listing-timezone, "Local", "UTC" or an IANA name like "Europe/Rome".
+func loadListingTimezone() error {
+  location, err := time.LoadLocation(listingTimezone)
+  if err != nil {
+    return fmt.Errorf("listing timezone: %v", err)
+  }
+  listingLocation = location
+  return nil
+}
+
+// entryDetails renders the details shown after an entry's link, e.g. " 2024-05-01 09:30 1.5 KB".
+// Entries whose metadata cannot be read get none.
+func entryDetails(file fs.DirEntry) string {
+  info, err := file.Info()
+  if err != nil {
+    return ""
+  }
+  details := " " + info.ModTime().In(listingLocation).Format(listingDateFormat)
+  if !file.IsDir() {
+    details += " " + formatSize(info.Size())
+  }
+  return details
+}
+
+// listingFooter is operator-provided HTML inserted as-is after the entries of HTML listings, set
+// with -listing-footer or read from the -listing-footer-file file at startup.
+var (
+  listingFooter     string
+  listingFooterFile string
+)
+
+// loadListingFooter reads the -listing-footer-file file, if any, into listingFooter.
+func loadListingFooter() error {
+  if listingFooterFile == "" {
+    return nil
+  }
+  if listingFooter != "" {
+    return fmt.Errorf("-listing-footer and -listing-footer-file cannot be combined")
+  }
+  data, err := os.ReadFile(listingFooterFile)
+  if err != nil {
+    return fmt.Errorf("reading listing footer: %v", err)
+  }
+  listingFooter = string(data)
+  return nil
+}
+
+// listingFormat is the -listing-format value: "auto" negotiates HTML or JSON from the Accept
+// header, while "html", "json" and "text" force that representation.
+var listingFormat = "auto"
+
+func validateListingFormat(format string) error {
+  switch format {
+  case "auto", "html", "json", "text":
+    return nil
+  }
+  return fmt.Errorf("unknown listing format %q (expected auto, html, json or text)", format)
+}
+
+// writeListing sends files, already filtered and sorted, as the listing of the request path in
+// the representation chosen by -listing-format.
+func writeListing(conn net.Conn, req *request, files []fs.DirEntry) {
+  format := listingFormat
+  if format == "auto" {
+    format = "html"
+    if negotiate(req.header("Accept"), []string{"text/html", "application/json"}) == "application/json" {
+      format = "json"
+    }
+  }
+
+  switch format {
+  case "json":
+    writeJSONListing(conn, req.prefix+req.path, files)
+  case "text":
+    writeTextListing(conn, files)
+  default:
+    writeHTMLListing(conn, req.prefix, req.prefix+req.path, files)
+  }
+}
+
+// writeTextListing sends one entry name per line, directories marked with a trailing slash.
+func writeTextListing(conn net.Conn, files []fs.DirEntry) {
+  var builder strings.Builder
+  for _, file := range files {
+    builder.WriteString(file.Name())
+    if file.IsDir() {
+      builder.WriteString("/")
+    }
+    builder.WriteString("\n")
+  }
+  sendText(conn, 200, "OK", "text/plain; charset=utf-8", builder.String())
+}
+
+// breadcrumbs renders the trail of links from the root of the served tree, at prefix, down to
+// urlPath. Every segment links to its directory.
+func breadcrumbs(prefix, urlPath string) string {
+  var builder strings.Builder
+  current := strings.TrimSuffix(prefix, "/") + "/"
+  link := func(target, text string) {
+    href := html.EscapeString((&url.URL{Path: target}).EscapedPath())
+    fmt.Fprintf(&builder, "<a href=\"%s\">%s</a>", href, html.EscapeString(text))
+  }
+
+  builder.WriteString("<nav>")
+  link(current, "Home")
+  for _, segment := range strings.Split(strings.Trim(cleanURLPath(urlPath), "/"), "/") {
+    if segment == "" {
+      continue
+    }
+    current += segment + "/"
+    builder.WriteString(" / ")
+    link(current, segment)
+  }
+  builder.WriteString("</nav>")
+  return builder.String()
+}
+
+// readListing reads the entries of one or more directories backing the same request path.
+// When several directories are given their entries are merged, the first occurrence of a name winning.
+// Entries hidden by a .ghttpdignore file are left out. Entries are returned in the configured listing order.
+func readListing(fullPaths []string) ([]os.DirEntry, error) {
+
+  var files []os.DirEntry
+  seen := make(map[string]bool)
+  ignored := ignoreCache{}
+
+  for _, fullPath := range fullPaths {
+    entries, err := os.ReadDir(fullPath)
+    if err != nil {
+      return nil, err
+    }
+
+    for _, entry := range entries {
+      if ignored.entryIgnored(fullPath, entry.Name()) {
+        continue
+      }
+      if !seen[entry.Name()] {
+        seen[entry.Name()] = true
+        files = append(files, entry)
+      }
+    }
+  }
+
+  sortEntries(files, listingSort)
+  return files, nil
+}
+
+// writeJSONListing sends files, already filtered and sorted, as the JSON listing of urlPath.
+func writeJSONListing(conn net.Conn, urlPath string, files []fs.DirEntry) {
+
+  entries := make([]listingEntry, 0, len(files))
+  for _, file := range files {
+    entry := listingEntry{Name: file.Name(), Path: joinURLPath(urlPath, file.Name()), IsDir: file.IsDir()}
+    if info, err := file.Info(); err == nil {
+      entry.Size, entry.ModTime = info.Size(), info.ModTime()
+    }
+    entries = append(entries, entry)
+  }
+
+  body, err := json.Marshal(entries)
+  if err != nil {
+    sendError(conn, 500, "Internal Server Error")
+    return
+  }
+
+  header := responseHeader{}
+  header.set("Content-Type", "application/json")
+  header.set("Content-Length", strconv.Itoa(len(body)))
+  writeResponseHeader(conn, 200, "OK", header)
+  conn.Write(body)
+}
+
+// listingOrder controls how directory listing entries are ordered by default.
+type listingOrder struct {
+  dirsFirst       bool
+  caseInsensitive bool
+  natural         bool
+}
+
+// parseListingOrder parses the -listing-sort value, a comma separated list of
+// "dirs-first", "case-insensitive" and "natural". An empty value keeps plain lexical order.
+func parseListingOrder(value string) (listingOrder, error) {
+  var order listingOrder
+
+  for _, option := range strings.Split(value, ",") {
+    switch strings.TrimSpace(option) {
+    case "":
+    case "dirs-first":
+      order.dirsFirst = true
+    case "case-insensitive":
+      order.caseInsensitive = true
+    case "natural":
+      order.natural = true
+    default:
+      return listingOrder{}, fmt.Errorf("unknown listing sort option %q", option)
+    }
+  }
+
+  return order, nil
+}
+
+func (o *listingOrder) String() string {
+  var options []string
+  if o.dirsFirst {
+    options = append(options, "dirs-first")
+  }
+  if o.caseInsensitive {
+    options = append(options, "case-insensitive")
+  }
+  if o.natural {
+    options = append(options, "natural")
+  }
+  return strings.Join(options, ",")
+}
+
+func (o *listingOrder) Set(value string) error {
+  order, err := parseListingOrder(value)
+  if err != nil {
+    return err
+  }
+  *o = order
+  return nil
+}
+
+func sortEntries(entries []os.DirEntry, order listingOrder) {
+  sort.SliceStable(entries, func(i, j int) bool {
+    if order.dirsFirst && entries[i].IsDir() != entries[j].IsDir() {
+      return entries[i].IsDir()
+    }
+
+    a, b := entries[i].Name(), entries[j].Name()
+    if order.caseInsensitive {
+      a, b = strings.ToLower(a), strings.ToLower(b)
+    }
+    if order.natural {
+      return naturalLess(a, b)
+    }
+    return a < b
+  })
+}
+
+// naturalLess compares strings treating runs of digits as numbers, so "file2" sorts before "file10".
+func naturalLess(a, b string) bool {
+  for a != "" && b != "" {
+    chunkA, restA := nextChunk(a)
+    chunkB, restB := nextChunk(b)
+
+    if isDigit(chunkA[0]) && isDigit(chunkB[0]) {
+      numA, numB := strings.TrimLeft(chunkA, "0"), strings.TrimLeft(chunkB, "0")
+      if len(numA) != len(numB) {
+        return len(numA) < len(numB)
+      }
+      if numA != numB {
+        return numA < numB
+      }
+    } else if chunkA != chunkB {
+      return chunkA < chunkB
+    }
+
+    a, b = restA, restB
+  }
+
+  return len(a) < len(b)
+}
+
+// nextChunk splits s into its leading run of digits or non-digits and the remainder.
+func nextChunk(s string) (string, string) {
+  digits := isDigit(s[0])
+  i := 1
+  for i < len(s) && isDigit(s[i]) == digits {
+    i++
+  }
+  return s[:i], s[i:]
+}
+
+func isDigit(c byte) bool {
+  return c >= '0' && c <= '9'
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+  "os"
+  "path/filepath"
+  "reflect"
+  "strings"
+  "testing"
+  "time"
+)
+
+func TestSortEntries(t *testing.T) {
+  tempDir := t.TempDir()
+  for _, name := range []string{"file10.txt", "file2.txt", "File1.txt", "b.txt"} {
+    if err := os.WriteFile(filepath.Join(tempDir, name), nil, 0644); err != nil {
+      t.Fatalf("Failed to create test file: %v", err)
+    }
+  }
+  for _, name := range []string{"zeta", "Alpha"} {
+    if err := os.Mkdir(filepath.Join(tempDir, name), 0755); err != nil {
+      t.Fatalf("Failed to create subdirectory: %v", err)
+    }
+  }
+
+  testCases := []struct {
+    name     string
+    sort     string
+    expected []string
+  }{
+    {
+      name:     "Default lexical",
+      sort:     "",
+      expected: []string{"Alpha", "File1.txt", "b.txt", "file10.txt", "file2.txt", "zeta"},
+    },
+    {
+      name:     "Case insensitive",
+      sort:     "case-insensitive",
+      expected: []string{"Alpha", "b.txt", "File1.txt", "file10.txt", "file2.txt", "zeta"},
+    },
+    {
+      name:     "Natural",
+      sort:     "natural,case-insensitive",
+      expected: []string{"Alpha", "b.txt", "File1.txt", "file2.txt", "file10.txt", "zeta"},
+    },
+    {
+      name:     "Directories first",
+      sort:     "dirs-first",
+      expected: []string{"Alpha", "zeta", "File1.txt", "b.txt", "file10.txt", "file2.txt"},
+    },
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      var order listingOrder
+      if err := order.Set(tc.sort); err != nil {
+        t.Fatalf("Unexpected error: %v", err)
+      }
+
+      entries, err := os.ReadDir(tempDir)
+      if err != nil {
+        t.Fatalf("Failed to read directory: %v", err)
+      }
+      sortEntries(entries, order)
+
+      var names []string
+      for _, entry := range entries {
+        names = append(names, entry.Name())
+      }
+      if !reflect.DeepEqual(names, tc.expected) {
+        t.Errorf("Expected order %v, got %v", tc.expected, names)
+      }
+    })
+  }
+}
+
+func TestListingOrderInvalid(t *testing.T) {
+  var order listingOrder
+  if err := order.Set("dirs-first,bogus"); err == nil {
+    t.Errorf("Expected error for unknown sort option")
+  }
+}
+
+func TestNaturalLess(t *testing.T) {
+  testCases := []struct {
+    a, b     string
+    expected bool
+  }{
+    {a: "file2", b: "file10", expected: true},
+    {a: "file10", b: "file2", expected: false},
+    {a: "file02", b: "file10", expected: true},
+    {a: "a", b: "a1", expected: true},
+    {a: "img12b", b: "img12a", expected: false},
+  }
+
+  for _, tc := range testCases {
+    if got := naturalLess(tc.a, tc.b); got != tc.expected {
+      t.Errorf("naturalLess(%q, %q) = %v, expected %v", tc.a, tc.b, got, tc.expected)
+    }
+  }
+}
+
+func TestListingNameTruncation(t *testing.T) {
+  tempDir := t.TempDir()
+  longName := strings.Repeat("a", 200) + " & " + strings.Repeat("b", 48) + ".txt"
+  writeTestFiles(t, tempDir, map[string]string{longName: "x", "short.txt": "y"})
+  useRoots(t, tempDir)
+
+  original := listingNameMax
+  listingNameMax = 20
+  defer func() { listingNameMax = original }()
+
+  conn := newMockConn("GET / HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+  response := conn.GetWrittenData()
+
+  escapedName := strings.ReplaceAll(longName, "&", "&amp;")
+  expectedLink := `<a href="/` + strings.Repeat("a", 200) + `%20&amp;%20` + strings.Repeat("b", 48) + `.txt" title="` + escapedName + `">` + strings.Repeat("a", 19) + "…</a>"
+  if !strings.Contains(response, expectedLink) {
+    t.Errorf("Expected truncated entry %s, got: %s", expectedLink, response)
+  }
+  if !strings.Contains(response, `<a href="/short.txt">short.txt</a>`) {
+    t.Errorf("Expected short names to be shown in full, got: %s", response)
+  }
+}
+
+func TestTruncateName(t *testing.T) {
+  testCases := []struct {
+    name     string
+    max      int
+    expected string
+  }{
+    {name: "abcdef", max: 0, expected: "abcdef"},
+    {name: "abcdef", max: 6, expected: "abcdef"},
+    {name: "abcdef", max: 4, expected: "abc…"},
+    {name: "ääääää", max: 3, expected: "ää…"},
+  }
+
+  for _, tc := range testCases {
+    if got := truncateName(tc.name, tc.max); got != tc.expected {
+      t.Errorf("Expected truncateName(%q, %d) = %q, got %q", tc.name, tc.max, tc.expected, got)
+    }
+  }
+}
+
+func TestListingBreadcrumbs(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"docs/my notes/2024/file.txt": "x"})
+  useRoots(t, tempDir)
+
+  originalPrefix := stripPrefix
+  defer func() { stripPrefix = originalPrefix }()
+
+  testCases := []struct {
+    name     string
+    prefix   string
+    path     string
+    expected string
+  }{
+    {
+      name:     "Root",
+      path:     "/",
+      expected: `<nav><a href="/">Home</a></nav>`,
+    },
+    {
+      name:     "Deep path",
+      path:     "/docs/my%20notes/2024/",
+      expected: `<nav><a href="/">Home</a> / <a href="/docs/">docs</a> / ` +
+        `<a href="/docs/my%20notes/">my notes</a> / <a href="/docs/my%20notes/2024/">2024</a></nav>`,
+    },
+    {
+      name:     "Under a stripped prefix",
+      prefix:   "/app",
+      path:     "/app/docs/my%20notes",
+      expected: `<nav><a href="/app/">Home</a> / <a href="/app/docs/">docs</a> / ` +
+        `<a href="/app/docs/my%20notes/">my notes</a></nav>`,
+    },
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      stripPrefix = tc.prefix
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+
+      if response := conn.GetWrittenData(); !strings.Contains(response, tc.expected) {
+        t.Errorf("Expected breadcrumbs %s, got: %s", tc.expected, response)
+      }
+    })
+  }
+}
+
+func TestListingFormat(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+  useRoots(t, tempDir)
+
+  original := listingFormat
+  defer func() { listingFormat = original }()
+
+  testCases := []struct {
+    name            string
+    format          string
+    accept          string
+    expectedType    string
+    expectedContent string
+  }{
+    {name: "Auto negotiates JSON", format: "auto", accept: "application/json", expectedType: "application/json", expectedContent: `"name":"a.txt"`},
+    {name: "Auto defaults to HTML", format: "auto", accept: "*/*", expectedType: "text/html", expectedContent: `<a href="/a.txt">a.txt</a>`},
+    {name: "Forced HTML", format: "html", accept: "application/json", expectedType: "text/html", expectedContent: `<a href="/sub">sub</a>`},
+    {name: "Forced JSON", format: "json", accept: "text/html", expectedType: "application/json", expectedContent: `"name":"sub","path":"/sub","is_dir":true`},
+    {name: "Forced text", format: "text", accept: "application/json", expectedType: "text/plain; charset=utf-8", expectedContent: "\r\n\r\na.txt\nsub/\n"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      listingFormat = tc.format
+      conn := newMockConn("GET / HTTP/1.1\r\nAccept: " + tc.accept + "\r\n\r\n")
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.Contains(response, "Content-Type: "+tc.expectedType+"\r\n") {
+        t.Errorf("Expected Content-Type %s, got: %s", tc.expectedType, response)
+      }
+      if !strings.Contains(response, tc.expectedContent) {
+        t.Errorf("Expected %q in response, got: %s", tc.expectedContent, response)
+      }
+    })
+  }
+
+  if err := validateListingFormat("xml"); err == nil {
+    t.Errorf("Expected error for an unknown listing format")
+  }
+}
+
+func TestListingSummary(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "a.txt":          strings.Repeat("a", 1000),
+    "b.txt":          strings.Repeat("b", 1048),
+    "c.txt":          "",
+    "sub/nested.txt": "not counted",
+  })
+  useRoots(t, tempDir)
+
+  original := listingSummary
+  listingSummary = true
+  defer func() { listingSummary = original }()
+
+  conn := newMockConn("GET / HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+  if response := conn.GetWrittenData(); !strings.Contains(response, "<p>3 files, 1 directory, 2.0 KB</p>") {
+    t.Errorf("Expected the listing summary, got: %s", response)
+  }
+}
+
+func TestFormatSize(t *testing.T) {
+  testCases := []struct {
+    size     int64
+    expected string
+  }{
+    {0, "0 B"},
+    {1023, "1023 B"},
+    {1536, "1.5 KB"},
+    {5 << 30, "5.0 GB"},
+  }
+
+  for _, tc := range testCases {
+    if got := formatSize(tc.size); got != tc.expected {
+      t.Errorf("formatSize(%d): expected %s, got %s", tc.size, tc.expected, got)
+    }
+  }
+}
+
+func TestListingFooter(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"a.txt": "a"})
+  useRoots(t, tempDir)
+
+  footerFile := filepath.Join(t.TempDir(), "footer.html")
+  footer := `<footer><a href="https://example.com/">Example & Co</a></footer>`
+  if err := os.WriteFile(footerFile, []byte(footer), 0644); err != nil {
+    t.Fatalf("Failed to write footer: %v", err)
+  }
+
+  originalFooter, originalFile := listingFooter, listingFooterFile
+  defer func() { listingFooter, listingFooterFile = originalFooter, originalFile }()
+  listingFooter, listingFooterFile = "", footerFile
+  if err := loadListingFooter(); err != nil {
+    t.Fatalf("Failed to load footer: %v", err)
+  }
+
+  conn := newMockConn("GET / HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+  if response := conn.GetWrittenData(); !strings.Contains(response, "</ul>"+footer+"</body>") {
+    t.Errorf("Expected the footer after the entries, got: %s", response)
+  }
+
+  listingFooter = "<p>inline</p>"
+  if err := loadListingFooter(); err == nil {
+    t.Errorf("Expected an error when both footer flags are set")
+  }
+}
+
+func TestListingDetails(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"report.txt": strings.Repeat("r", 2048), "sub/x.txt": "x"})
+  stamp := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+  for _, name := range []string{"report.txt", "sub"} {
+    if err := os.Chtimes(filepath.Join(tempDir, name), stamp, stamp); err != nil {
+      t.Fatalf("Failed to set modification time: %v", err)
+    }
+  }
+  useRoots(t, tempDir)
+
+  originalDetails, originalFormat, originalTimezone, originalLocation := listingDetails, listingDateFormat, listingTimezone, listingLocation
+  defer func() {
+    listingDetails, listingDateFormat, listingTimezone, listingLocation = originalDetails, originalFormat, originalTimezone, originalLocation
+  }()
+
+  testCases := []struct {
+    name     string
+    format   string
+    timezone string
+    expected []string
+  }{
+    {
+      name:     "RFC 3339 in UTC",
+      format:   time.RFC3339,
+      timezone: "UTC",
+      expected: []string{`report.txt</a> 2024-05-01T09:30:00Z 2.0 KB</li>`, `sub</a> 2024-05-01T09:30:00Z</li>`},
+    },
+    {
+      name:     "Custom layout in another zone",
+      format:   "02 Jan 2006 15:04 MST",
+      timezone: "Asia/Tokyo",
+      expected: []string{`report.txt</a> 01 May 2024 18:30 JST 2.0 KB</li>`},
+    },
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      listingDetails, listingDateFormat, listingTimezone = true, tc.format, tc.timezone
+      if err := loadListingTimezone(); err != nil {
+        t.Skipf("Timezone data unavailable: %v", err)
+      }
+
+      conn := newMockConn("GET / HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+      response := conn.GetWrittenData()
+      for _, expected := range tc.expected {
+        if !strings.Contains(response, expected) {
+          t.Errorf("Expected %q in the listing, got: %s", expected, response)
+        }
+      }
+    })
+  }
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+  "fmt"
+  "log"
+)
+
+// logLevel controls which diagnostic messages are written.
+type logLevel int
+
+const (
+  levelError logLevel = iota
+  levelInfo
+  levelDebug
+)
+
+var levelNames = map[logLevel]string{levelError: "error", levelInfo: "info", levelDebug: "debug"}
+
+var currentLogLevel = levelInfo
+
+func (l *logLevel) String() string {
+  return levelNames[*l]
+}
+
+func (l *logLevel) Set(value string) error {
+  for level, name := range levelNames {
+    if name == value {
+      *l = level
+      return nil
+    }
+  }
+  return fmt.Errorf("unknown log level %q (expected error, info or debug)", value)
+}
+
+// debugf logs only when the log level is debug.
+func debugf(format string, args ...any) {
+  if currentLogLevel >= levelDebug {
+    log.Printf(format, args...)
+  }
+}
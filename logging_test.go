@@ -0,0 +1,115 @@
+package main
+
+import (
+  "bufio"
+  "io"
+  "net"
+  "strings"
+  "testing"
+)
+
+// useLogLevel sets the log level for the duration of the test.
+func useLogLevel(t *testing.T, level logLevel) {
+  t.Helper()
+  original := currentLogLevel
+  currentLogLevel = level
+  t.Cleanup(func() { currentLogLevel = original })
+}
+
+func TestWorkerLogLevel(t *testing.T) {
+  useRoots(t, t.TempDir())
+
+  testCases := []struct {
+    name           string
+    level          logLevel
+    expectWorkerID bool
+    expectRequest  bool
+  }{
+    {name: "Info hides worker line", level: levelInfo, expectWorkerID: false, expectRequest: true},
+    {name: "Debug shows worker line", level: levelDebug, expectWorkerID: true, expectRequest: true},
+    {name: "Error hides request log", level: levelError, expectWorkerID: false, expectRequest: false},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      useLogLevel(t, tc.level)
+      buf := captureLog(t)
+
+      server, addr, _ := startTestServer(t, 1)
+      conn, err := net.Dial("tcp", addr)
+      if err != nil {
+        t.Fatalf("Failed to connect: %v", err)
+      }
+      conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+      io.ReadAll(conn)
+      conn.Close()
+      waitFor(t, "the connection to finish", func() bool { return server.connCount() == 0 })
+
+      output := buf.String()
+      if strings.Contains(output, "Worker 0: handling connection") != tc.expectWorkerID {
+        t.Errorf("Expected worker line present=%v, got: %s", tc.expectWorkerID, output)
+      }
+      if strings.Contains(output, "New Request") != tc.expectRequest {
+        t.Errorf("Expected request line present=%v, got: %s", tc.expectRequest, output)
+      }
+    })
+  }
+}
+
+func TestLogLevelFlag(t *testing.T) {
+  var level logLevel
+  if err := level.Set("debug"); err != nil || level != levelDebug {
+    t.Errorf("Expected debug level, got %v (%v)", level, err)
+  }
+  if err := level.Set("verbose"); err == nil {
+    t.Errorf("Expected error for unknown level")
+  }
+}
+
+func TestRejectedBodySize(t *testing.T) {
+  useRoots(t, t.TempDir())
+
+  testCases := []struct {
+    name        string
+    level       logLevel
+    request     string
+    expectedLog string
+  }{
+    {"Debug logs the size", levelDebug, "POST /form HTTP/1.1\r\nContent-Length: 11\r\n\r\nhello world", "Rejected POST /form declared a 11 byte body"},
+    {"Info hides the size", levelInfo, "POST /form HTTP/1.1\r\nContent-Length: 11\r\n\r\nhello world", ""},
+    {"No body", levelDebug, "DELETE /form HTTP/1.1\r\n\r\n", ""},
+    {"Invalid length", levelDebug, "POST /form HTTP/1.1\r\nContent-Length: eleven\r\n\r\n", ""},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      useLogLevel(t, tc.level)
+      logs := captureLog(t)
+
+      conn := newMockConn(tc.request)
+      handleConnection(conn)
+
+      if response := conn.GetWrittenData(); !strings.HasPrefix(response, "HTTP/1.1 400 ") {
+        t.Errorf("Expected the request to be rejected, got: %s", response)
+      }
+      logged := strings.Contains(logs.String(), "byte body")
+      if tc.expectedLog == "" && logged {
+        t.Errorf("Expected no body size logged, got: %s", logs)
+      }
+      if tc.expectedLog != "" && !strings.Contains(logs.String(), tc.expectedLog) {
+        t.Errorf("Expected %q in the log, got: %s", tc.expectedLog, logs)
+      }
+    })
+  }
+
+  // The body is consumed, so nothing is left unread when the connection closes.
+  reader := bufio.NewReader(strings.NewReader("POST /form HTTP/1.1\r\nContent-Length: 11\r\n\r\nhello worldrest"))
+  req, err := parseRequest(reader)
+  if err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  drainRejectedBody(req)
+  if rest, _ := io.ReadAll(reader); string(rest) != "rest" {
+    t.Errorf("Expected the body to be drained, got remaining %q", rest)
+  }
+}
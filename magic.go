@@ -0,0 +1,148 @@
+package main
+
+import (
+  "bufio"
+  "bytes"
+  "encoding/hex"
+  "fmt"
+  "io"
+  "strconv"
+  "strings"
+  "unicode/utf8"
+)
+
+// magicSignature identifies a file format by the bytes found at offset.
+type magicSignature struct {
+  offset      int
+  signature   []byte
+  contentType string
+}
+
+// magicList is the repeatable -magic flag: signatures consulted before the built-in ones.
+type magicList []magicSignature
+
+var magicSignatures magicList
+
+// builtinMagic covers formats commonly served without a recognized extension.
+var builtinMagic = magicList{
+  {signature: []byte("%PDF-"), contentType: "application/pdf"},
+  {signature: []byte("\x89PNG\r\n\x1a\n"), contentType: "image/png"},
+  {signature: []byte("\xff\xd8\xff"), contentType: "image/jpeg"},
+  {signature: []byte("GIF8"), contentType: "image/gif"},
+  {signature: []byte("\x00asm"), contentType: "application/wasm"},
+  {signature: []byte("7z\xbc\xaf\x27\x1c"), contentType: "application/x-7z-compressed"},
+  {signature: []byte("\x28\xb5\x2f\xfd"), contentType: "application/zstd"},
+  {signature: []byte("SQLite format 3\x00"), contentType: "application/vnd.sqlite3"},
+  {offset: 4, signature: []byte("ftypheic"), contentType: "image/heic"},
+  {offset: 4, signature: []byte("ftypavif"), contentType: "image/avif"},
+}
+
+// sniffLen is the number of leading bytes read when matching signatures.
+const sniffLen = 512
+
+func (l *magicList) String() string {
+  items := make([]string, len(*l))
+  for i, m := range *l {
+    items[i] = fmt.Sprintf("%d:%x=%s", m.offset, m.signature, m.contentType)
+  }
+  return strings.Join(items, ",")
+}
+
+// Set appends the comma separated "[offset:]hex=content/type" signatures of value.
+func (l *magicList) Set(value string) error {
+  for _, item := range strings.Split(value, ",") {
+    item = strings.TrimSpace(item)
+    if item == "" {
+      continue
+    }
+
+    pattern, contentType, found := strings.Cut(item, "=")
+    contentType = strings.TrimSpace(contentType)
+    if !found || !strings.Contains(contentType, "/") {
+      return fmt.Errorf("invalid magic %q: expected [offset:]hex=content/type", item)
+    }
+
+    m := magicSignature{contentType: contentType}
+    if offset, rest, hasOffset := strings.Cut(pattern, ":"); hasOffset {
+      n, err := strconv.Atoi(strings.TrimSpace(offset))
+      if err != nil || n < 0 {
+        return fmt.Errorf("invalid magic offset %q", offset)
+      }
+      m.offset, pattern = n, rest
+    }
+
+    signature, err := hex.DecodeString(strings.TrimSpace(pattern))
+    if err != nil || len(signature) == 0 {
+      return fmt.Errorf("invalid magic signature %q: expected hex bytes", pattern)
+    }
+    if m.offset+len(signature) > sniffLen {
+      return fmt.Errorf("magic signature %q reaches past the first %d bytes", pattern, sniffLen)
+    }
+    m.signature = signature
+
+    *l = append(*l, m)
+  }
+  return nil
+}
+
+// match returns the content type of the first signature found in head, or "".
+func (l magicList) match(head []byte) string {
+  for _, m := range l {
+    end := m.offset + len(m.signature)
+    if end <= len(head) && bytes.Equal(head[m.offset:end], m.signature) {
+      return m.contentType
+    }
+  }
+  return ""
+}
+
+// peekHead returns up to sniffLen leading bytes of content and a reader that still yields all of
+// it: content itself, rewound, when it can seek, or a buffered reader otherwise.
+func peekHead(content io.Reader) ([]byte, io.Reader, error) {
+  if seeker, ok := content.(io.ReadSeeker); ok {
+    head := make([]byte, sniffLen)
+    n, err := io.ReadFull(seeker, head)
+    if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+      return nil, nil, err
+    }
+    if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+      return nil, nil, err
+    }
+    return head[:n], seeker, nil
+  }
+
+  buffered := bufio.NewReaderSize(content, sniffLen)
+  head, err := buffered.Peek(sniffLen)
+  if err != nil && err != io.EOF {
+    return nil, nil, err
+  }
+  return head, buffered, nil
+}
+
+// sniffContentType matches head against the -magic signatures and then the built-in table,
+// returning "" when none matches.
+func sniffContentType(head []byte) string {
+  if contentType := magicSignatures.match(head); contentType != "" {
+    return contentType
+  }
+  return builtinMagic.match(head)
+}
+
+// looksLikeText reports whether head reads as UTF-8 text: valid UTF-8, apart from a character
+// cut off at the end of the peek, and free of control characters other than whitespace and escape.
+func looksLikeText(head []byte, complete bool) bool {
+  if len(head) == 0 {
+    return false
+  }
+  for len(head) > 0 {
+    r, size := utf8.DecodeRune(head)
+    if r == utf8.RuneError && size <= 1 {
+      return !complete && !utf8.FullRune(head)
+    }
+    if (r < ' ' && !strings.ContainsRune("\t\n\f\r\x1b", r)) || r == 0x7f {
+      return false
+    }
+    head = head[size:]
+  }
+  return true
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+  "strings"
+  "testing"
+)
+
+// useMagic sets -magic to value for the duration of the test.
+func useMagic(t *testing.T, value string) {
+  t.Helper()
+  original := magicSignatures
+  magicSignatures = nil
+  if err := magicSignatures.Set(value); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  t.Cleanup(func() { magicSignatures = original })
+}
+
+func TestMagicListSet(t *testing.T) {
+  for _, value := range []string{"cafe", "zz=text/plain", "cafe=plain", "x:cafe=a/b", "600:cafe=a/b"} {
+    var list magicList
+    if err := list.Set(value); err == nil {
+      t.Errorf("Expected error for %q", value)
+    }
+  }
+}
+
+func TestSniffContentType(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "custom.ghtd": "\x00\x00GHTD rest of the file",
+    "document":    "%PDF-1.7 ...",
+    "unknown.dat": "nothing recognizable",
+    "labeled.txt": "%PDF-1.7 but named as text",
+  })
+  useRoots(t, tempDir)
+  useMagic(t, "2:47485444=application/x-ghttpd-test")
+
+  testCases := []struct {
+    path     string
+    expected string
+  }{
+    {path: "/custom.ghtd", expected: "application/x-ghttpd-test"},
+    {path: "/document", expected: "application/pdf"},
+    {path: "/unknown.dat", expected: "application/octet-stream"},
+    {path: "/labeled.txt", expected: "text/plain; charset=utf-8"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.path, func(t *testing.T) {
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.Contains(response, "Content-Type: "+tc.expected+"\r\n") {
+        t.Errorf("Expected Content-Type %s, got: %s", tc.expected, response)
+      }
+    })
+  }
+}
+
+func TestSniffedFileBodyIntact(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"document": "%PDF-1.7 body"})
+  useRoots(t, tempDir)
+
+  conn := newMockConn("GET /document HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+
+  if response := conn.GetWrittenData(); !strings.HasSuffix(response, "\r\n\r\n%PDF-1.7 body") {
+    t.Errorf("Expected the full body after sniffing, got: %s", response)
+  }
+}
+
+func TestExtensionlessText(t *testing.T) {
+  // The multi-byte character straddles the end of the sniffed head, which must not count as invalid.
+  long := strings.Repeat("a", sniffLen-1) + "é and more text"
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "README":       "Grüße, ghttpd!\nPlain UTF-8 text.\n",
+    "LONGTEXT":     long,
+    "binary":       "text\x00with a NUL byte",
+    "latin1":       "caf\xe9",
+    "empty":        "",
+    "notes.nottxt": "text with an unknown extension",
+  })
+  useRoots(t, tempDir)
+
+  testCases := []struct {
+    path     string
+    expected string
+    body     string
+  }{
+    {path: "/README", expected: "text/plain; charset=utf-8", body: "Grüße, ghttpd!\nPlain UTF-8 text.\n"},
+    {path: "/LONGTEXT", expected: "text/plain; charset=utf-8", body: long},
+    {path: "/binary", expected: "application/octet-stream", body: "text\x00with a NUL byte"},
+    {path: "/latin1", expected: "application/octet-stream", body: "caf\xe9"},
+    {path: "/empty", expected: "application/octet-stream", body: ""},
+    {path: "/notes.nottxt", expected: "application/octet-stream", body: "text with an unknown extension"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.path, func(t *testing.T) {
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.Contains(response, "Content-Type: "+tc.expected+"\r\n") {
+        t.Errorf("Expected Content-Type %s, got: %s", tc.expected, response)
+      }
+      if !strings.HasSuffix(response, "\r\n\r\n"+tc.body) {
+        t.Errorf("Expected the full body after peeking, got: %s", response)
+      }
+    })
+  }
+}
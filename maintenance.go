@@ -0,0 +1,73 @@
+package main
+
+import (
+  "fmt"
+  "net"
+  "os"
+  "strconv"
+  "sync"
+  "time"
+)
+
+// maintenanceFile switches the server into maintenance mode while it exists: content requests are
+// answered with 503 and maintenancePage, or a plain message when no page is configured.
+var (
+  maintenanceFile     string
+  maintenancePageFile string
+  maintenancePage     []byte
+)
+
+// maintenanceInterval is how long the result of checking maintenanceFile is reused, so busy
+// servers stat it at most once per interval.
+var maintenanceInterval = time.Second
+
+var maintenanceState struct {
+  sync.Mutex
+  checked time.Time
+  active  bool
+}
+
+// loadMaintenancePage reads the -maintenance-page file once at startup.
+func loadMaintenancePage() error {
+  if maintenancePageFile == "" {
+    return nil
+  }
+  data, err := os.ReadFile(maintenancePageFile)
+  if err != nil {
+    return fmt.Errorf("reading maintenance page: %v", err)
+  }
+  maintenancePage = data
+  return nil
+}
+
+// inMaintenance reports whether the maintenance file currently exists.
+func inMaintenance() bool {
+  if maintenanceFile == "" {
+    return false
+  }
+
+  maintenanceState.Lock()
+  defer maintenanceState.Unlock()
+  if time.Since(maintenanceState.checked) >= maintenanceInterval {
+    _, err := os.Stat(maintenanceFile)
+    maintenanceState.active = err == nil
+    maintenanceState.checked = time.Now()
+  }
+  return maintenanceState.active
+}
+
+// sendMaintenance answers with 503 and the maintenance page. Caches are told not to keep it, so
+// visitors see the site again as soon as maintenance ends.
+func sendMaintenance(conn net.Conn) {
+  body, contentType := maintenancePage, "text/html; charset=utf-8"
+  if body == nil {
+    body, contentType = []byte("Service Unavailable"), "text/plain"
+  }
+
+  header := responseHeader{}
+  header.set("Content-Type", contentType)
+  header.set("Content-Length", strconv.Itoa(len(body)))
+  header.set("Cache-Control", "no-store")
+  writeResponseHeader(conn, 503, "Service Unavailable", header)
+  conn.Write(body)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"index.html": "home"})
+  useRoots(t, tempDir)
+
+  flagFile := filepath.Join(t.TempDir(), "maintenance.flag")
+  originalFile, originalPage, originalInterval := maintenanceFile, maintenancePage, maintenanceInterval
+  maintenanceFile, maintenanceInterval = flagFile, 0
+  defer func() { maintenanceFile, maintenancePage, maintenanceInterval = originalFile, originalPage, originalInterval }()
+  healthChecks = true
+  defer func() { healthChecks = false }()
+
+  testCases := []struct {
+    name         string
+    present      bool
+    page         []byte
+    path         string
+    expectedCode string
+    expectedBody string
+  }{
+    {"No flag file", false, nil, "/index.html", "HTTP/1.1 200 OK", "home"},
+    {"Flag file", true, nil, "/index.html", "HTTP/1.1 503 Service Unavailable", "Service Unavailable"},
+    {"Maintenance page", true, []byte("<h1>Back soon</h1>"), "/index.html", "HTTP/1.1 503 Service Unavailable", "<h1>Back soon</h1>"},
+    {"Health check", true, nil, "/healthz", "HTTP/1.1 200 OK", ""},
+    {"Flag file removed", false, nil, "/index.html", "HTTP/1.1 200 OK", "home"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      if tc.present {
+        if err := os.WriteFile(flagFile, nil, 0644); err != nil {
+          t.Fatalf("Failed to create flag file: %v", err)
+        }
+      } else {
+        os.Remove(flagFile)
+      }
+      maintenancePage = tc.page
+
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+      if !strings.HasSuffix(response, tc.expectedBody) {
+        t.Errorf("Expected body %q, got: %s", tc.expectedBody, response)
+      }
+      if tc.present && tc.path != "/healthz" && !strings.Contains(response, "Cache-Control: no-store\r\n") {
+        t.Errorf("Expected maintenance responses not to be cached, got: %s", response)
+      }
+    })
+  }
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+  "fmt"
+  "log"
+  "net"
+  "strconv"
+  "strings"
+  "sync/atomic"
+  "time"
+)
+
+var (
+  metricsEnabled bool
+  statsInterval  time.Duration
+)
+
+// activeConnections counts the connections currently inside handleConnection;
+// totalConnections counts every connection handled since startup; overflowConnections counts those
+// turned away with 503 because the -max-queue was full; limitedConnections those turned away with
+// 429 by -max-conns-per-ip.
+var activeConnections, totalConnections, overflowConnections, limitedConnections atomic.Int64
+
+// internalEndpoint returns the handler for a path answered by the server itself rather than
+// from the document roots, or nil. Internal paths are matched before -strip-prefix applies.
+func internalEndpoint(urlPath string) func(net.Conn, *request) {
+  switch {
+  case urlPath == "/metrics" && metricsEnabled:
+    return sendMetrics
+  case urlPath == "/healthz" && healthChecks:
+    return sendLiveness
+  case urlPath == "/readyz" && healthChecks:
+    return sendReadiness
+  case urlPath == "/stats" && pathHits != nil:
+    return sendStats
+  case urlPath == speedtestPath && speedtestMax > 0:
+    return sendSpeedtest
+  case urlPath == configEndpointPath && configEndpointAuth != "":
+    return sendConfig
+  }
+  return nil
+}
+
+// sendMetrics writes the server metrics in the Prometheus text exposition format.
+func sendMetrics(conn net.Conn, req *request) {
+  var builder strings.Builder
+  writeMetric(&builder, "ghttpd_active_connections", "gauge", "Connections currently being handled.", activeConnections.Load())
+  writeMetric(&builder, "ghttpd_connections_total", "counter", "Connections handled since startup.", totalConnections.Load())
+  writeMetric(&builder, "ghttpd_overflow_connections_total", "counter", "Connections refused with 503 because all workers were busy.", overflowConnections.Load())
+  writeMetric(&builder, "ghttpd_limited_connections_total", "counter", "Connections refused with 429 because their address had -max-conns-per-ip open.", limitedConnections.Load())
+
+  sendText(conn, 200, "OK", "text/plain; version=0.0.4", builder.String())
+}
+
+func writeMetric(builder *strings.Builder, name, kind, help string, value int64) {
+  fmt.Fprintf(builder, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+}
+
+// sendText sends body as a complete response with the given status and content type.
+func sendText(conn net.Conn, code int, reason, contentType, body string) {
+  header := responseHeader{}
+  header.set("Content-Type", contentType)
+  header.set("Content-Length", strconv.Itoa(len(body)))
+  writeResponseHeader(conn, code, reason, header)
+  conn.Write([]byte(body))
+}
+
+// logStats logs the connection gauge every interval until stop is closed.
+func logStats(interval time.Duration, stop <-chan struct{}) {
+  ticker := time.NewTicker(interval)
+  defer ticker.Stop()
+
+  for {
+    select {
+    case <-ticker.C:
+      log.Printf("Active connections: %d (total %d)", activeConnections.Load(), totalConnections.Load())
+    case <-stop:
+      return
+    }
+  }
+}
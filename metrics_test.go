@@ -0,0 +1,59 @@
+package main
+
+import (
+  "io"
+  "net"
+  "strconv"
+  "strings"
+  "testing"
+)
+
+func TestActiveConnectionsGauge(t *testing.T) {
+  metricsEnabled = true
+  defer func() { metricsEnabled = false }()
+
+  server, addr, _ := startTestServer(t, 4)
+  baseline := activeConnections.Load()
+
+  // Clients that never finish their request keep their connections active.
+  var held []net.Conn
+  for range 3 {
+    conn, err := net.Dial("tcp", addr)
+    if err != nil {
+      t.Fatalf("Failed to connect: %v", err)
+    }
+    conn.Write([]byte("GET / HTTP/1.1\r\n"))
+    held = append(held, conn)
+  }
+  waitFor(t, "the held connections to be handled", func() bool { return activeConnections.Load() == baseline+3 })
+
+  conn, err := net.Dial("tcp", addr)
+  if err != nil {
+    t.Fatalf("Failed to connect: %v", err)
+  }
+  conn.Write([]byte("GET /metrics HTTP/1.1\r\n\r\n"))
+  response, _ := io.ReadAll(conn)
+  conn.Close()
+
+  // The metrics request itself is active while it is answered.
+  expected := "\nghttpd_active_connections " + strconv.FormatInt(baseline+4, 10) + "\n"
+  if !strings.HasPrefix(string(response), "HTTP/1.1 200 OK") || !strings.Contains(string(response), expected) {
+    t.Errorf("Expected metrics containing %q, got: %s", expected, response)
+  }
+
+  for _, c := range held {
+    c.Close()
+  }
+  waitFor(t, "the gauge to drop", func() bool { return activeConnections.Load() == baseline && server.connCount() == 0 })
+}
+
+func TestMetricsDisabled(t *testing.T) {
+  useRoots(t, t.TempDir())
+
+  conn := newMockConn("GET /metrics HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+
+  if response := conn.GetWrittenData(); !strings.HasPrefix(response, "HTTP/1.1 404") {
+    t.Errorf("Expected /metrics to be served from the roots when disabled, got: %s", response)
+  }
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+  "regexp"
+)
+
+// mobileIndex names a variant of the index file served instead to mobile clients, such as
+// index.mobile.html. Empty disables the variant. Only directory index selection is affected.
+var mobileIndex string
+
+// mobilePatterns are the -mobile-pattern expressions a User-Agent must match to count as mobile;
+// without any, defaultMobilePattern is used.
+var mobilePatterns regexpList
+
+var defaultMobilePattern = regexp.MustCompile(`(?i)mobi|android|iphone|ipod|blackberry|opera mini`)
+
+// isMobile reports whether the User-Agent of req identifies a mobile browser.
+func isMobile(req *request) bool {
+  agent := req.header("User-Agent")
+  if len(mobilePatterns) == 0 {
+    return defaultMobilePattern.MatchString(agent)
+  }
+  return mobilePatterns.matches(agent)
+}
+
+// locateIndex finds the index file named index in the directory at dirPath for req, preferring
+// the mobile variant for mobile clients. When a variant exists the response depends on the
+// User-Agent, which is recorded in req.vary for caches.
+func locateIndex(req *request, dirPath, index string) (string, bool) {
+  if mobileIndex != "" {
+    if file, _, err := locateResource(joinURLPath(dirPath, mobileIndex)); err == nil && file != "" {
+      req.vary = append(req.vary, "User-Agent")
+      if isMobile(req) {
+        return file, true
+      }
+    }
+  }
+  file, _, err := locateResource(joinURLPath(dirPath, index))
+  return file, err == nil && file != ""
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+  "fmt"
+  "os"
+  "strings"
+)
+
+// mount serves the URL paths under prefix from its own directory instead of the document roots,
+// with its own directory policy. Unset policy fields fall back to the global flags.
+type mount struct {
+  // prefix is the cleaned URL path the mount answers, such as "/downloads".
+  prefix string
+  dir    string
+  // steps replaces -directory-strategy for directories in the mount when not nil.
+  steps directoryStrategy
+  // index replaces -index when not empty.
+  index string
+  // readOnly refuses uploads into the mount even with -upload.
+  readOnly bool
+}
+
+// mountList is the repeatable -mount flag. The longest matching prefix wins.
+type mountList []*mount
+
+var mounts mountList
+
+func (l *mountList) String() string {
+  var items []string
+  for _, m := range *l {
+    items = append(items, m.prefix+"="+m.dir)
+  }
+  return strings.Join(items, " ")
+}
+
+// Set adds a "/prefix=directory" mount, optionally followed by ";" separated settings:
+// "strategy=index,spa" for its directory steps, "index=app.html" for its index file and
+// "read-only" to refuse uploads, e.g. "/app=./dist;strategy=index,spa;read-only".
+func (l *mountList) Set(value string) error {
+  settings := strings.Split(value, ";")
+  prefix, dir, found := strings.Cut(settings[0], "=")
+  prefix, dir = strings.TrimSpace(prefix), strings.TrimSpace(dir)
+  if !found || !strings.HasPrefix(prefix, "/") || dir == "" {
+    return fmt.Errorf("invalid mount %q: expected /prefix=directory[;setting...]", value)
+  }
+
+  m := &mount{prefix: cleanURLPath(prefix), dir: dir}
+  if m.prefix == "/" {
+    return fmt.Errorf("invalid mount %q: use -d to serve the root", value)
+  }
+  for _, setting := range settings[1:] {
+    name, arg, _ := strings.Cut(strings.TrimSpace(setting), "=")
+    switch name {
+    case "":
+    case "strategy":
+      if err := m.steps.Set(arg); err != nil {
+        return fmt.Errorf("invalid mount %q: %v", value, err)
+      }
+      if m.steps == nil {
+        m.steps = directoryStrategy{}
+      }
+    case "index":
+      if arg == "" || strings.Contains(arg, "/") {
+        return fmt.Errorf("invalid mount %q: index must be a file name", value)
+      }
+      m.index = arg
+    case "read-only":
+      m.readOnly = true
+    default:
+      return fmt.Errorf("invalid mount %q: unknown setting %q (expected strategy, index or read-only)", value, name)
+    }
+  }
+
+  *l = append(*l, m)
+  return nil
+}
+
+// match returns the mount serving urlPath and the path within it, or nil when no mount does.
+func (l mountList) match(urlPath string) (*mount, string) {
+  cleaned := cleanURLPath(urlPath)
+  var best *mount
+  for _, m := range l {
+    if (cleaned == m.prefix || strings.HasPrefix(cleaned, m.prefix+"/")) && (best == nil || len(m.prefix) > len(best.prefix)) {
+      best = m
+    }
+  }
+  if best == nil {
+    return nil, urlPath
+  }
+  rest := strings.TrimPrefix(cleaned, best.prefix)
+  if rest == "" || strings.HasSuffix(urlPath, "/") {
+    rest += "/"
+  }
+  return best, rest
+}
+
+// validateMounts checks that every mount directory exists. Mounts cannot be combined with
+// -archive, which serves every request from the archive.
+func validateMounts() error {
+  if len(mounts) > 0 && archivePath != "" {
+    return fmt.Errorf("-mount cannot be used with -archive")
+  }
+  for _, m := range mounts {
+    if info, err := os.Stat(m.dir); err != nil || !info.IsDir() {
+      return fmt.Errorf("directory %s for mount %s does not exist", m.dir, m.prefix)
+    }
+  }
+  return nil
+}
+
+// rootsFor returns the directories searched for urlPath, and the path to look up in them: the
+// mount's directory when urlPath is under a -mount, the document roots otherwise.
+func rootsFor(urlPath string) ([]string, string) {
+  if m, rest := mounts.match(urlPath); m != nil {
+    return []string{m.dir}, rest
+  }
+  return roots, urlPath
+}
+
+// directoryPolicy returns the directory steps, index file and SPA entry point that apply to the
+// directory at urlPath.
+func directoryPolicy(urlPath string) (directoryStrategy, string, string) {
+  m, _ := mounts.match(urlPath)
+  if m == nil {
+    return directorySteps, indexFile, "/"
+  }
+
+  steps, index := directorySteps, indexFile
+  if m.steps != nil {
+    steps = m.steps
+  }
+  if m.index != "" {
+    index = m.index
+  }
+  return steps, index, m.prefix + "/"
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+  "encoding/base64"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+func TestMounts(t *testing.T) {
+  siteDir, downloadsDir, appDir := t.TempDir(), t.TempDir(), t.TempDir()
+  writeTestFiles(t, siteDir, map[string]string{"index.html": "site home", "downloads/shadowed.txt": "from the roots"})
+  writeTestFiles(t, downloadsDir, map[string]string{
+    "report.pdf":       "pdf",
+    "old/notes.txt":    "notes",
+    "secure/.htpasswd": "alice:$apr1$saltsalt$LrttParrLPdxvgutaSXWJ0\n",
+    "secure/plan.txt":  "plan",
+  })
+  writeTestFiles(t, appDir, map[string]string{"app.html": "app shell", "assets/app.js": "js"})
+  useRoots(t, siteDir)
+  useUploads(t, 1<<20)
+
+  original := mounts
+  mounts = nil
+  defer func() { mounts = original }()
+  for _, value := range []string{
+    "/downloads=" + downloadsDir + ";strategy=listing",
+    "/app=" + appDir + ";strategy=index,spa;index=app.html;read-only",
+  } {
+    if err := mounts.Set(value); err != nil {
+      t.Fatalf("Unexpected error: %v", err)
+    }
+  }
+
+  authHeader := "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte("alice:secret")) + "\r\n"
+
+  testCases := []struct {
+    name         string
+    request      string
+    expectedCode string
+    expectedBody string
+  }{
+    {"Listing allowed", "GET /downloads/ HTTP/1.1\r\n\r\n", "HTTP/1.1 200 OK", "report.pdf"},
+    {"Nested listing", "GET /downloads/old/ HTTP/1.1\r\n\r\n", "HTTP/1.1 200 OK", "notes.txt"},
+    {"Mount file", "GET /downloads/report.pdf HTTP/1.1\r\n\r\n", "HTTP/1.1 200 OK", "pdf"},
+    {"Mount hides the roots", "GET /downloads/shadowed.txt HTTP/1.1\r\n\r\n", "HTTP/1.1 404 Not Found", ""},
+    {"Mount index", "GET /app/ HTTP/1.1\r\n\r\n", "HTTP/1.1 200 OK", "app shell"},
+    {"Mount SPA fallback instead of listing", "GET /app/assets/ HTTP/1.1\r\n\r\n", "HTTP/1.1 200 OK", "app shell"},
+    {"Roots keep the global policy", "GET / HTTP/1.1\r\n\r\n", "HTTP/1.1 200 OK", "downloads"},
+    {"Read-only mount", putRequest("/app/new.js", 2, []byte("js")), "HTTP/1.1 403 Forbidden", ""},
+    {"Writable mount", putRequest("/downloads/new.txt", 3, []byte("new")), "HTTP/1.1 201 Created", ""},
+    {"Mount auth file", "GET /downloads/secure/plan.txt HTTP/1.1\r\n\r\n", "HTTP/1.1 401 Unauthorized", ""},
+    {"Mount auth listing", "GET /downloads/secure/ HTTP/1.1\r\n\r\n", "HTTP/1.1 401 Unauthorized", ""},
+    {"Mount auth credentials", "GET /downloads/secure/plan.txt HTTP/1.1\r\n" + authHeader + "\r\n", "HTTP/1.1 200 OK", "plan"},
+    {"Mount auth upload", putRequest("/downloads/secure/new.txt", 3, []byte("new")), "HTTP/1.1 401 Unauthorized", ""},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn(tc.request)
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+      if tc.expectedBody != "" && !strings.Contains(response, tc.expectedBody) {
+        t.Errorf("Expected %q in response, got: %s", tc.expectedBody, response)
+      }
+    })
+  }
+
+  if data, err := os.ReadFile(filepath.Join(downloadsDir, "new.txt")); err != nil || string(data) != "new" {
+    t.Errorf("Expected the upload in the mount directory, got %q, %v", data, err)
+  }
+  if _, err := os.Stat(filepath.Join(appDir, "new.js")); err == nil {
+    t.Errorf("Expected nothing written to the read-only mount")
+  }
+
+  var list mountList
+  for _, invalid := range []string{"/downloads", "downloads=./files", "/=./files", "/app=./dist;strategy=everything", "/app=./dist;index=a/b.html", "/app=./dist;cache"} {
+    if err := list.Set(invalid); err == nil {
+      t.Errorf("Expected error for mount %q", invalid)
+    }
+  }
+}
+
+func TestValidateMounts(t *testing.T) {
+  dir := t.TempDir()
+  originalMounts, originalArchive := mounts, archivePath
+  defer func() { mounts, archivePath = originalMounts, originalArchive }()
+
+  mounts, archivePath = nil, ""
+  if err := mounts.Set("/files=" + dir); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  if err := validateMounts(); err != nil {
+    t.Errorf("Unexpected error: %v", err)
+  }
+
+  archivePath = filepath.Join(dir, "site.zip")
+  if err := validateMounts(); err == nil || !strings.Contains(err.Error(), "-archive") {
+    t.Errorf("Expected an error for -mount with -archive, got: %v", err)
+  }
+
+  mounts, archivePath = nil, ""
+  if err := mounts.Set("/files=" + filepath.Join(dir, "missing")); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  if err := validateMounts(); err == nil {
+    t.Errorf("Expected an error for a missing mount directory")
+  }
+}
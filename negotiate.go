@@ -0,0 +1,86 @@
+package main
+
+import (
+  "strconv"
+  "strings"
+)
+
+// acceptRange is one element of an Accept-style header with its quality value.
+type acceptRange struct {
+  value string
+  q     float64
+}
+
+// parseAccept parses an Accept, Accept-Encoding or Accept-Language header into its ranges.
+// Parameters other than q are ignored and malformed q values count as 1.
+func parseAccept(header string) []acceptRange {
+  var ranges []acceptRange
+
+  for _, element := range strings.Split(header, ",") {
+    value, params, _ := strings.Cut(element, ";")
+    value = strings.ToLower(strings.TrimSpace(value))
+    if value == "" {
+      continue
+    }
+
+    q := 1.0
+    for _, param := range strings.Split(params, ";") {
+      name, raw, _ := strings.Cut(param, "=")
+      if strings.TrimSpace(name) != "q" {
+        continue
+      }
+      if parsed, err := strconv.ParseFloat(strings.TrimSpace(raw), 64); err == nil && parsed >= 0 && parsed <= 1 {
+        q = parsed
+      }
+    }
+
+    ranges = append(ranges, acceptRange{value: value, q: q})
+  }
+
+  return ranges
+}
+
+// negotiate picks the offer the client prefers according to header.
+// Each offer takes the q value of the most specific range matching it; ties keep the order of offers,
+// so the first offer is the server preference. An empty header accepts the first offer.
+// It returns "" when no offer is acceptable.
+func negotiate(header string, offers []string) string {
+  if len(offers) == 0 {
+    return ""
+  }
+  if strings.TrimSpace(header) == "" {
+    return offers[0]
+  }
+
+  ranges := parseAccept(header)
+  best, bestQ := "", 0.0
+
+  for _, offer := range offers {
+    q, specificity := 0.0, 0
+    for _, r := range ranges {
+      if s := matchSpecificity(r.value, strings.ToLower(offer)); s > specificity {
+        q, specificity = r.q, s
+      }
+    }
+
+    if q > bestQ {
+      best, bestQ = offer, q
+    }
+  }
+
+  return best
+}
+
+// matchSpecificity reports how specifically pattern matches offer: 3 for an exact match,
+// 2 for a "type/*" match, 1 for "*/*" or "*", and 0 when it does not match.
+func matchSpecificity(pattern, offer string) int {
+  switch {
+  case pattern == offer:
+    return 3
+  case pattern == "*/*" || pattern == "*":
+    return 1
+  case strings.HasSuffix(pattern, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(pattern, "*")):
+    return 2
+  }
+  return 0
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+  "encoding/json"
+  "strings"
+  "testing"
+)
+
+func TestNegotiate(t *testing.T) {
+  offers := []string{"text/html", "application/json"}
+
+  testCases := []struct {
+    name     string
+    accept   string
+    expected string
+  }{
+    {name: "No Accept header", accept: "", expected: "text/html"},
+    {name: "Wildcard", accept: "*/*", expected: "text/html"},
+    {name: "JSON only", accept: "application/json", expected: "application/json"},
+    {name: "Higher q wins", accept: "text/html;q=0.9, application/json;q=1.0", expected: "application/json"},
+    {name: "Lower q loses", accept: "text/html, application/json;q=0.5", expected: "text/html"},
+    {name: "Type wildcard", accept: "application/*, text/html;q=0.1", expected: "application/json"},
+    {name: "Specific range beats wildcard", accept: "*/*;q=0.8, text/html;q=0.2", expected: "application/json"},
+    {name: "Excluded with q=0", accept: "text/html;q=0, */*", expected: "application/json"},
+    {name: "Nothing acceptable", accept: "image/png", expected: ""},
+    {name: "Case insensitive", accept: "Application/JSON", expected: "application/json"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      if got := negotiate(tc.accept, offers); got != tc.expected {
+        t.Errorf("negotiate(%q) = %q, expected %q", tc.accept, got, tc.expected)
+      }
+    })
+  }
+}
+
+func TestNegotiateEncodings(t *testing.T) {
+  offers := []string{"gzip", "identity"}
+
+  if got := negotiate("deflate, gzip;q=0.8", offers); got != "gzip" {
+    t.Errorf("Expected gzip, got %q", got)
+  }
+  if got := negotiate("gzip;q=0, *", offers); got != "identity" {
+    t.Errorf("Expected identity, got %q", got)
+  }
+}
+
+func TestJSONListingNegotiation(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"a.txt": "hello", "sub/b.txt": ""})
+  useRoots(t, tempDir)
+
+  conn := newMockConn("GET / HTTP/1.1\r\nAccept: text/html;q=0.9, application/json;q=1.0\r\n\r\n")
+  handleConnection(conn)
+  response := conn.GetWrittenData()
+
+  if !strings.Contains(response, "Content-Type: application/json") {
+    t.Fatalf("Expected a JSON listing, got: %s", response)
+  }
+
+  _, body, _ := strings.Cut(response, "\r\n\r\n")
+  var entries []listingEntry
+  if err := json.Unmarshal([]byte(body), &entries); err != nil {
+    t.Fatalf("Failed to decode listing %q: %v", body, err)
+  }
+  if len(entries) != 2 || entries[0].Name != "a.txt" || entries[0].Size != 5 || entries[0].Path != "/a.txt" || !entries[1].IsDir {
+    t.Errorf("Unexpected listing entries: %+v", entries)
+  }
+}
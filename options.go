@@ -0,0 +1,45 @@
+package main
+
+import (
+  "net"
+  "strings"
+)
+
+// serverOptions answers "OPTIONS *", which asks about the server as a whole rather than any
+// resource (RFC 9110, section 9.3.7), with the methods and features it supports.
+var serverOptions = true
+
+// isAsteriskForm reports whether the request target is "*", which names no file and must never
+// reach the roots.
+func isAsteriskForm(req *request) bool {
+  return req.path == "*"
+}
+
+// handleAsterisk answers a request whose target is "*". Only OPTIONS may use that form; anything
+// else is malformed.
+func handleAsterisk(conn net.Conn, req *request) {
+  discardBody(req)
+
+  if !strings.HasPrefix(req.version, "HTTP") || req.method != "OPTIONS" {
+    sendError(conn, 400, "Bad Request")
+    return
+  }
+  if !serverOptions {
+    sendErrorWithHeader(conn, 405, "Method Not Allowed", responseHeader{{name: "Allow", value: allowedMethods()}})
+    return
+  }
+
+  methods := allowedMethods()
+  if !webdavEnabled {
+    methods += ", OPTIONS"
+  }
+
+  header := responseHeader{}
+  header.set("Allow", methods)
+  header.set("Accept-Ranges", "bytes")
+  if webdavEnabled {
+    header.set("DAV", "1")
+  }
+  header.set("Content-Length", "0")
+  writeResponseHeader(conn, 200, "OK", header)
+}
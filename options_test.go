@@ -0,0 +1,53 @@
+package main
+
+import (
+  "strings"
+  "testing"
+)
+
+func TestServerOptions(t *testing.T) {
+  // A file named "*" would be served if the target reached the roots.
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"*": "from disk"})
+  useRoots(t, tempDir)
+
+  originalOptions, originalWebDAV := serverOptions, webdavEnabled
+  defer func() { serverOptions, webdavEnabled = originalOptions, originalWebDAV }()
+
+  testCases := []struct {
+    name            string
+    request         string
+    enabled         bool
+    webdav          bool
+    expectedCode    string
+    expectedHeaders []string
+  }{
+    {"Server-wide OPTIONS", "OPTIONS * HTTP/1.1\r\n\r\n", true, false, "HTTP/1.1 200 OK", []string{"Allow: GET, HEAD, OPTIONS\r\n", "Accept-Ranges: bytes\r\n", "Content-Length: 0\r\n"}},
+    {"With WebDAV", "OPTIONS * HTTP/1.1\r\n\r\n", true, true, "HTTP/1.1 200 OK", []string{"Allow: GET, HEAD, OPTIONS, PROPFIND\r\n", "DAV: 1\r\n"}},
+    {"Disabled", "OPTIONS * HTTP/1.1\r\n\r\n", false, false, "HTTP/1.1 405 Method Not Allowed", []string{"Allow: GET, HEAD\r\n"}},
+    {"GET asterisk", "GET * HTTP/1.1\r\n\r\n", true, false, "HTTP/1.1 400 Bad Request", nil},
+    {"Invalid version", "OPTIONS * FTP/1.0\r\n\r\n", true, false, "HTTP/1.1 400 Bad Request", nil},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      serverOptions, webdavEnabled = tc.enabled, tc.webdav
+
+      conn := newMockConn(tc.request)
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+      for _, header := range tc.expectedHeaders {
+        if !strings.Contains(response, header) {
+          t.Errorf("Expected header %q, got: %s", header, response)
+        }
+      }
+      if strings.Contains(response, "from disk") {
+        t.Errorf("Expected the roots to be left alone, got: %s", response)
+      }
+    })
+  }
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+  "fmt"
+  "path"
+  "path/filepath"
+  "runtime"
+  "strings"
+)
+
+// URL paths always use forward slashes while file system paths use the OS separator. The helpers
+// below are the only places converting between the two, so each conversion happens exactly once.
+
+// cleanURLPath returns urlPath rooted at "/" with "." and ".." segments resolved.
+func cleanURLPath(urlPath string) string {
+  return path.Clean("/" + urlPath)
+}
+
+// joinURLPath appends the entry name to the URL path of its directory.
+func joinURLPath(dirPath, name string) string {
+  return path.Join("/", dirPath, name)
+}
+
+// resolvePath maps a request path onto root. The path is cleaned as an absolute
+// URL path first, so ".." segments can never climb above root. Request paths must have passed
+// portablePath, as cleaning only knows about forward slashes.
+func resolvePath(root, urlPath string) string {
+  return filepath.Join(root, filepath.FromSlash(cleanURLPath(urlPath)))
+}
+
+// portablePath reports whether urlPath is safe to resolve on every OS. Windows also splits paths
+// at backslashes and reads segments like "C:" as volume names, so "/..\..\secret" would survive
+// cleaning and climb out of the root there; such paths are refused everywhere.
+func portablePath(urlPath string) bool {
+  if strings.Contains(urlPath, `\`) {
+    return false
+  }
+  for _, segment := range strings.Split(urlPath, "/") {
+    if filepath.VolumeName(segment) != "" {
+      return false
+    }
+  }
+  return true
+}
+
+// urlPathOf converts a file system path relative to a document root into the URL path serving it.
+func urlPathOf(relPath string) string {
+  return cleanURLPath(filepath.ToSlash(relPath))
+}
+
+// trailingDots is the -trailing-dots policy for path segments ending in dots or spaces, which
+// Windows drops from file names: "secret.txt." opens secret.txt while escaping patterns written for
+// that name. "reject" refuses such paths, "strip" removes the characters like Windows does before
+// any rule sees the path, and "allow" leaves them alone. Windows defaults to "reject".
+var trailingDots = defaultTrailingDots()
+
+func defaultTrailingDots() string {
+  if runtime.GOOS == "windows" {
+    return "reject"
+  }
+  return "allow"
+}
+
+func validateTrailingDots(policy string) error {
+  if policy != "reject" && policy != "strip" && policy != "allow" {
+    return fmt.Errorf("unknown trailing dots policy %q (expected reject, strip or allow)", policy)
+  }
+  return nil
+}
+
+// applyTrailingDots applies the -trailing-dots policy to urlPath. It returns the path to serve, and
+// false when the path must be refused. The "." and ".." segments are left for path cleaning.
+func applyTrailingDots(urlPath string) (string, bool) {
+  if trailingDots == "allow" {
+    return urlPath, true
+  }
+
+  segments := strings.Split(urlPath, "/")
+  for i, segment := range segments {
+    if segment == "." || segment == ".." || strings.TrimRight(segment, ". ") == segment {
+      continue
+    }
+    if trailingDots == "reject" {
+      return "", false
+    }
+    segments[i] = strings.TrimRight(segment, ". ")
+  }
+  return strings.Join(segments, "/"), true
+}
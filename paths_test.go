@@ -0,0 +1,132 @@
+package main
+
+import (
+  "path/filepath"
+  "runtime"
+  "strings"
+  "testing"
+)
+
+func TestResolvePath(t *testing.T) {
+  testCases := []struct {
+    path     string
+    expected string
+  }{
+    {path: "/", expected: filepath.Join("root")},
+    {path: "/a/b.txt", expected: filepath.Join("root", "a", "b.txt")},
+    {path: "/../../etc/passwd", expected: filepath.Join("root", "etc", "passwd")},
+    {path: "/a/../../b", expected: filepath.Join("root", "b")},
+  }
+
+  for _, tc := range testCases {
+    if got := resolvePath("root", tc.path); got != tc.expected {
+      t.Errorf("resolvePath(%q) = %q, expected %q", tc.path, got, tc.expected)
+    }
+  }
+}
+
+func TestURLPathHelpers(t *testing.T) {
+  testCases := []struct {
+    name     string
+    got      string
+    expected string
+  }{
+    {name: "Clean root", got: cleanURLPath(""), expected: "/"},
+    {name: "Clean dot segments", got: cleanURLPath("a/./b/../c/"), expected: "/a/c"},
+    {name: "Join", got: joinURLPath("/docs", "a b.txt"), expected: "/docs/a b.txt"},
+    {name: "Join at root", got: joinURLPath("", "file.txt"), expected: "/file.txt"},
+    {name: "Relative OS path", got: urlPathOf(filepath.Join("docs", "sub", "file.txt")), expected: "/docs/sub/file.txt"},
+    {name: "Root itself", got: urlPathOf("."), expected: "/"},
+  }
+
+  for _, tc := range testCases {
+    if tc.got != tc.expected {
+      t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, tc.got)
+    }
+  }
+}
+
+func TestResolvePathUsesOSSeparator(t *testing.T) {
+  root := filepath.Join("srv", "www")
+  got := resolvePath(root, "/docs/sub/file.txt")
+
+  if expected := root + string(filepath.Separator) + "docs" + string(filepath.Separator) + "sub" + string(filepath.Separator) + "file.txt"; got != expected {
+    t.Errorf("Expected %q, got %q", expected, got)
+  }
+  if rel, err := filepath.Rel(root, got); err != nil || urlPathOf(rel) != "/docs/sub/file.txt" {
+    t.Errorf("Expected the conversion to round-trip, got %q (%v)", rel, err)
+  }
+}
+
+func TestPortablePath(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"docs/a.txt": "a"})
+  useRoots(t, tempDir)
+
+  testCases := []struct {
+    name         string
+    path         string
+    expectedCode string
+  }{
+    {"Plain path", "/docs/a.txt", "HTTP/1.1 200 OK"},
+    {"Backslash traversal", `/..\..\secret`, "HTTP/1.1 400 Bad Request"},
+    {"Encoded backslash", "/docs%5Ca.txt", "HTTP/1.1 400 Bad Request"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+
+      if response := conn.GetWrittenData(); !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+    })
+  }
+
+  if runtime.GOOS == "windows" && portablePath("/C:/Windows/win.ini") {
+    t.Errorf("Expected a path with a volume name to be refused")
+  }
+}
+
+func TestTrailingDots(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"secret.txt": "secret", "docs/a.txt": "a"})
+  useRoots(t, tempDir)
+  useAccessRules(t, nil, []string{`^/secret\.txt$`})
+
+  original := trailingDots
+  defer func() { trailingDots = original }()
+
+  testCases := []struct {
+    name         string
+    policy       string
+    path         string
+    expectedCode string
+  }{
+    {"Reject trailing dot", "reject", "/secret.txt.", "HTTP/1.1 400 Bad Request"},
+    {"Reject trailing space", "reject", "/secret.txt%20", "HTTP/1.1 400 Bad Request"},
+    {"Reject dotted directory", "reject", "/docs./a.txt", "HTTP/1.1 400 Bad Request"},
+    {"Reject dots only", "reject", "/docs/.../a.txt", "HTTP/1.1 400 Bad Request"},
+    {"Reject keeps clean paths", "reject", "/docs/./a.txt", "HTTP/1.1 200 OK"},
+    {"Strip applies deny rules", "strip", "/secret.txt.%20.", "HTTP/1.1 403 Forbidden"},
+    {"Strip dotted directory", "strip", "/docs. /a.txt", "HTTP/1.1 200 OK"},
+    {"Allow", "allow", "/docs./a.txt", "HTTP/1.1 404 Not Found"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      trailingDots = tc.policy
+      conn := newMockConn("GET " + strings.ReplaceAll(tc.path, " ", "%20") + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+
+      if response := conn.GetWrittenData(); !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+    })
+  }
+
+  if err := validateTrailingDots("ignore"); err == nil {
+    t.Errorf("Expected an error for an unknown policy")
+  }
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+  "fmt"
+  "path"
+  "strings"
+)
+
+// preloadMap is the repeatable -preload flag: for an HTML page's URL path, the assets announced
+// with Link: rel=preload when the page is served.
+type preloadMap map[string][]string
+
+var preloads = preloadMap{}
+
+func (m *preloadMap) String() string {
+  var items []string
+  for page, assets := range *m {
+    items = append(items, page+"="+strings.Join(assets, ","))
+  }
+  return strings.Join(items, " ")
+}
+
+// Set adds a "/page.html=/asset.css,/asset.js" mapping.
+func (m *preloadMap) Set(value string) error {
+  page, assets, found := strings.Cut(value, "=")
+  page = strings.TrimSpace(page)
+  if !found || !strings.HasPrefix(page, "/") {
+    return fmt.Errorf("invalid preload %q: expected /page=/asset[,/asset...]", value)
+  }
+  if *m == nil {
+    *m = preloadMap{}
+  }
+  for _, asset := range strings.Split(assets, ",") {
+    if asset = strings.TrimSpace(asset); asset != "" {
+      (*m)[cleanURLPath(page)] = append((*m)[cleanURLPath(page)], asset)
+    }
+  }
+  return nil
+}
+
+// preloadDestinations maps asset extensions to the "as" value browsers need to preload them.
+var preloadDestinations = map[string]string{
+  ".css":   "style",
+  ".js":    "script",
+  ".mjs":   "script",
+  ".woff":  "font",
+  ".woff2": "font",
+  ".ttf":   "font",
+  ".otf":   "font",
+  ".png":   "image",
+  ".jpg":   "image",
+  ".jpeg":  "image",
+  ".gif":   "image",
+  ".svg":   "image",
+  ".webp":  "image",
+  ".avif":  "image",
+}
+
+// preloadLinks returns the Link header value announcing the assets configured for urlPath, or "".
+// Fonts are always fetched in CORS mode, so their links carry crossorigin to be reused.
+func preloadLinks(urlPath string) string {
+  var links []string
+  for _, asset := range preloads[cleanURLPath(urlPath)] {
+    link := "<" + asset + ">; rel=preload"
+    if as, ok := preloadDestinations[strings.ToLower(path.Ext(asset))]; ok {
+      link += "; as=" + as
+      if as == "font" {
+        link += "; crossorigin"
+      }
+    }
+    links = append(links, link)
+  }
+  return strings.Join(links, ", ")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+  "strings"
+  "testing"
+)
+
+func usePreloads(t *testing.T, values ...string) {
+  t.Helper()
+  original := preloads
+  preloads = preloadMap{}
+  for _, value := range values {
+    if err := preloads.Set(value); err != nil {
+      t.Fatalf("Invalid preload %q: %v", value, err)
+    }
+  }
+  t.Cleanup(func() { preloads = original })
+}
+
+func TestPreloadLinks(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"index.html": "<p>home</p>", "about.html": "<p>about</p>", "app.css": "body {}"})
+  useRoots(t, tempDir)
+  usePreloads(t, "/index.html=/app.css,/app.js", "/index.html=/fonts/body.woff2", "/app.css=/never.js")
+
+  testCases := []struct {
+    name         string
+    path         string
+    expectedLink string
+  }{
+    {"Configured page", "/index.html", "Link: </app.css>; rel=preload; as=style, </app.js>; rel=preload; as=script, </fonts/body.woff2>; rel=preload; as=font; crossorigin\r\n"},
+    {"Other page", "/about.html", ""},
+    {"Non-HTML file", "/app.css", ""},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+      headers, _, _ := strings.Cut(conn.GetWrittenData(), "\r\n\r\n")
+
+      if tc.expectedLink == "" {
+        if strings.Contains(headers, "Link:") {
+          t.Errorf("Expected no Link header, got: %s", headers)
+        }
+      } else if !strings.Contains(headers+"\r\n", tc.expectedLink) {
+        t.Errorf("Expected %q, got: %s", tc.expectedLink, headers)
+      }
+    })
+  }
+}
+
+func TestPreloadInvalid(t *testing.T) {
+  var m preloadMap
+  for _, value := range []string{"index.html=/app.css", "/index.html"} {
+    if err := m.Set(value); err == nil {
+      t.Errorf("Expected an error for %q", value)
+    }
+  }
+}
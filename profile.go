@@ -0,0 +1,62 @@
+package main
+
+import (
+  "fmt"
+  "log"
+  "os"
+  "runtime"
+  "runtime/pprof"
+)
+
+// cpuProfile and memProfile name the files receiving CPU and heap profiles for `go tool pprof`.
+// The CPU profile covers the whole run; the heap profile is taken at shutdown.
+var (
+  cpuProfile string
+  memProfile string
+)
+
+// startProfiling starts the CPU profile when requested. The returned function stops it and writes
+// the heap profile; it must run on shutdown for the profiles to be complete.
+func startProfiling() (func(), error) {
+  var cpuFile *os.File
+  if cpuProfile != "" {
+    file, err := os.Create(cpuProfile)
+    if err != nil {
+      return nil, fmt.Errorf("creating CPU profile: %v", err)
+    }
+    if err := pprof.StartCPUProfile(file); err != nil {
+      file.Close()
+      return nil, fmt.Errorf("starting CPU profile: %v", err)
+    }
+    cpuFile = file
+  }
+
+  return func() {
+    if cpuFile != nil {
+      pprof.StopCPUProfile()
+      if err := cpuFile.Close(); err != nil {
+        log.Printf("Error: writing CPU profile: %v", err)
+      }
+    }
+    if memProfile != "" {
+      if err := writeHeapProfile(memProfile); err != nil {
+        log.Printf("Error: %v", err)
+      }
+    }
+  }, nil
+}
+
+// writeHeapProfile writes a heap profile to path, after a GC so it reflects live memory.
+func writeHeapProfile(path string) error {
+  file, err := os.Create(path)
+  if err != nil {
+    return fmt.Errorf("creating memory profile: %v", err)
+  }
+  defer file.Close()
+
+  runtime.GC()
+  if err := pprof.WriteHeapProfile(file); err != nil {
+    return fmt.Errorf("writing memory profile: %v", err)
+  }
+  return file.Close()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+  "os"
+  "path/filepath"
+  "testing"
+)
+
+func TestProfiling(t *testing.T) {
+  dir := t.TempDir()
+  originalCPU, originalMem := cpuProfile, memProfile
+  cpuProfile, memProfile = filepath.Join(dir, "cpu.pprof"), filepath.Join(dir, "mem.pprof")
+  defer func() { cpuProfile, memProfile = originalCPU, originalMem }()
+
+  stop, err := startProfiling()
+  if err != nil {
+    t.Fatalf("Failed to start profiling: %v", err)
+  }
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"a.txt": "content"})
+  useRoots(t, tempDir)
+  for range 100 {
+    handleConnection(newMockConn("GET /a.txt HTTP/1.1\r\n\r\n"))
+  }
+  stop()
+
+  for _, path := range []string{cpuProfile, memProfile} {
+    info, err := os.Stat(path)
+    if err != nil {
+      t.Errorf("Expected profile %s to be written: %v", path, err)
+    } else if info.Size() == 0 {
+      t.Errorf("Expected profile %s not to be empty", path)
+    }
+  }
+
+  cpuProfile = filepath.Join(dir, "missing", "cpu.pprof")
+  if _, err := startProfiling(); err == nil {
+    t.Errorf("Expected an error for an unwritable profile path")
+  }
+}
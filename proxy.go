@@ -0,0 +1,146 @@
+package main
+
+import (
+  "fmt"
+  "net"
+  "net/netip"
+  "strings"
+)
+
+// prefixList is a repeatable flag holding comma separated CIDR prefixes or single addresses.
+type prefixList []netip.Prefix
+
+func (p *prefixList) String() string {
+  var prefixes []string
+  for _, prefix := range *p {
+    prefixes = append(prefixes, prefix.String())
+  }
+  return strings.Join(prefixes, ",")
+}
+
+func (p *prefixList) Set(value string) error {
+  for _, item := range strings.Split(value, ",") {
+    item = strings.TrimSpace(item)
+    if item == "" {
+      continue
+    }
+
+    if !strings.Contains(item, "/") {
+      addr, err := netip.ParseAddr(item)
+      if err != nil {
+        return fmt.Errorf("invalid address %q", item)
+      }
+      *p = append(*p, netip.PrefixFrom(addr, addr.BitLen()))
+      continue
+    }
+
+    prefix, err := netip.ParsePrefix(item)
+    if err != nil {
+      return fmt.Errorf("invalid CIDR %q", item)
+    }
+    *p = append(*p, prefix.Masked())
+  }
+  return nil
+}
+
+func (p prefixList) contains(addr netip.Addr) bool {
+  addr = addr.Unmap()
+  for _, prefix := range p {
+    if prefix.Contains(addr) {
+      return true
+    }
+  }
+  return false
+}
+
+var trustedProxies prefixList
+
+// trustedProxyHeader names the header, typically X-Forwarded-Proto, from which requests relayed by
+// a trusted proxy take their original scheme. Empty trusts no scheme header.
+var trustedProxyHeader string
+
+// remoteIP returns the peer address of conn, or an invalid Addr if it is not an IP connection.
+func remoteIP(conn net.Conn) netip.Addr {
+  if conn.RemoteAddr() == nil {
+    return netip.Addr{}
+  }
+  addrPort, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+  if err != nil {
+    return netip.Addr{}
+  }
+  return addrPort.Addr().Unmap()
+}
+
+// clientIP returns the address of the client that originated req. Forwarded and X-Forwarded-For
+// are only honoured when the peer is a trusted proxy; the chain is then walked from the nearest hop
+// backwards and the first address that is not itself a trusted proxy is the client.
+func clientIP(conn net.Conn, req *request) netip.Addr {
+  peer := remoteIP(conn)
+  if !peer.IsValid() || !trustedProxies.contains(peer) {
+    return peer
+  }
+
+  chain := forwardedFor(req.header("Forwarded"))
+  if chain == nil {
+    chain = strings.Split(req.header("X-Forwarded-For"), ",")
+  }
+
+  client := peer
+  for i := len(chain) - 1; i >= 0; i-- {
+    addr, err := netip.ParseAddr(strings.TrimSpace(chain[i]))
+    if err != nil {
+      break
+    }
+    client = addr.Unmap()
+    if !trustedProxies.contains(client) {
+      break
+    }
+  }
+  return client
+}
+
+// forwardedFor extracts the for= node of every element of an RFC 7239 Forwarded header,
+// without quotes, brackets or ports. It returns nil if the header is empty.
+func forwardedFor(header string) []string {
+  if strings.TrimSpace(header) == "" {
+    return nil
+  }
+
+  var nodes []string
+  for _, element := range strings.Split(header, ",") {
+    node := ""
+    for _, pair := range strings.Split(element, ";") {
+      name, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+      if strings.EqualFold(name, "for") {
+        node = strings.Trim(value, "\"")
+      }
+    }
+
+    if host, _, err := net.SplitHostPort(node); err == nil {
+      node = host
+    }
+    nodes = append(nodes, strings.Trim(node, "[]"))
+  }
+  return nodes
+}
+
+// requestScheme returns "https" or "http" for the scheme the client used: TLS connections are
+// https, and requests relayed by a trusted proxy report theirs in -trusted-proxy-header.
+func requestScheme(conn net.Conn, req *request) string {
+  if _, _, ok := tlsParams(conn); ok {
+    return "https"
+  }
+  if trustedProxyHeader == "" {
+    return "http"
+  }
+  if peer := remoteIP(conn); !peer.IsValid() || !trustedProxies.contains(peer) {
+    return "http"
+  }
+
+  // A chain of proxies may append values; the first one comes from the proxy facing the client.
+  scheme, _, _ := strings.Cut(req.header(trustedProxyHeader), ",")
+  if strings.EqualFold(strings.TrimSpace(scheme), "https") {
+    return "https"
+  }
+  return "http"
+}
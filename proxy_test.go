@@ -0,0 +1,173 @@
+package main
+
+import (
+  "net"
+  "strings"
+  "testing"
+)
+
+// useTrustedProxies sets -trusted-proxies for the duration of the test.
+func useTrustedProxies(t *testing.T, value string) {
+  t.Helper()
+  original := trustedProxies
+  trustedProxies = nil
+  if err := trustedProxies.Set(value); err != nil {
+    t.Fatalf("Invalid trusted proxies %q: %v", value, err)
+  }
+  t.Cleanup(func() { trustedProxies = original })
+}
+
+func newMockConnFrom(remote string, input string) *mockConn {
+  conn := newMockConn(input)
+  addr, _ := net.ResolveTCPAddr("tcp", remote)
+  conn.remoteAddr = addr
+  return conn
+}
+
+func TestClientIP(t *testing.T) {
+  useTrustedProxies(t, "10.0.0.0/8,192.168.1.1")
+
+  testCases := []struct {
+    name     string
+    remote   string
+    headers  map[string]string
+    expected string
+  }{
+    {
+      name:     "Direct client",
+      remote:   "203.0.113.7:5000",
+      expected: "203.0.113.7",
+    },
+    {
+      name:     "Untrusted peer spoofing X-Forwarded-For",
+      remote:   "203.0.113.7:5000",
+      headers:  map[string]string{"x-forwarded-for": "1.2.3.4"},
+      expected: "203.0.113.7",
+    },
+    {
+      name:     "Trusted proxy",
+      remote:   "10.1.2.3:5000",
+      headers:  map[string]string{"x-forwarded-for": "198.51.100.9"},
+      expected: "198.51.100.9",
+    },
+    {
+      name:     "Chain of trusted proxies",
+      remote:   "10.1.2.3:5000",
+      headers:  map[string]string{"x-forwarded-for": "6.6.6.6, 198.51.100.9, 192.168.1.1"},
+      expected: "198.51.100.9",
+    },
+    {
+      name:     "Forwarded header",
+      remote:   "192.168.1.1:5000",
+      headers:  map[string]string{"forwarded": `for="[2001:db8::17]:4711";proto=https, for=10.9.9.9`},
+      expected: "2001:db8::17",
+    },
+    {
+      name:     "Trusted proxy without header",
+      remote:   "10.1.2.3:5000",
+      expected: "10.1.2.3",
+    },
+    {
+      name:     "Garbage in header stops the walk",
+      remote:   "10.1.2.3:5000",
+      headers:  map[string]string{"x-forwarded-for": "198.51.100.9, bogus"},
+      expected: "10.1.2.3",
+    },
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConnFrom(tc.remote, "")
+      got := clientIP(conn, &request{headers: tc.headers})
+      if got.String() != tc.expected {
+        t.Errorf("Expected client %s, got %s", tc.expected, got)
+      }
+    })
+  }
+}
+
+func TestAccessLogUsesForwardedClient(t *testing.T) {
+  useTrustedProxies(t, "127.0.0.1")
+  buf := captureLog(t)
+
+  conn := newMockConnFrom("127.0.0.1:4000", "")
+  logRequest(conn, &request{method: "GET", path: "/", version: "HTTP/1.1", headers: map[string]string{"x-forwarded-for": "198.51.100.9"}})
+
+  if !strings.Contains(buf.String(), "Client: 198.51.100.9") {
+    t.Errorf("Expected forwarded client in access log, got: %s", buf.String())
+  }
+}
+
+func TestPrefixListInvalid(t *testing.T) {
+  var list prefixList
+  if err := list.Set("10.0.0.0/33"); err == nil {
+    t.Errorf("Expected error for invalid CIDR")
+  }
+  if err := list.Set("not-an-ip"); err == nil {
+    t.Errorf("Expected error for invalid address")
+  }
+}
+
+func TestRequestScheme(t *testing.T) {
+  useTrustedProxies(t, "10.0.0.0/8")
+  original := trustedProxyHeader
+  trustedProxyHeader = "X-Forwarded-Proto"
+  defer func() { trustedProxyHeader = original }()
+
+  testCases := []struct {
+    name     string
+    remote   string
+    header   string
+    expected string
+  }{
+    {"Trusted proxy over HTTPS", "10.0.0.5:4000", "https", "https"},
+    {"Trusted proxy, first value wins", "10.0.0.5:4000", "HTTPS, http", "https"},
+    {"Trusted proxy over HTTP", "10.0.0.5:4000", "http", "http"},
+    {"Trusted proxy without header", "10.0.0.5:4000", "", "http"},
+    {"Untrusted peer", "203.0.113.7:4000", "https", "http"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      req := &request{headers: map[string]string{}}
+      if tc.header != "" {
+        req.headers["x-forwarded-proto"] = tc.header
+      }
+      if scheme := requestScheme(newMockConnFrom(tc.remote, ""), req); scheme != tc.expected {
+        t.Errorf("Expected %s, got %s", tc.expected, scheme)
+      }
+    })
+  }
+}
+
+func TestRedirectHTTPSBehindProxy(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"page.html": "page"})
+  useRoots(t, tempDir)
+  useTrustedProxies(t, "10.0.0.0/8")
+
+  originalHeader, originalRedirect := trustedProxyHeader, redirectHTTPS
+  trustedProxyHeader, redirectHTTPS = "X-Forwarded-Proto", true
+  defer func() { trustedProxyHeader, redirectHTTPS = originalHeader, originalRedirect }()
+
+  testCases := []struct {
+    name         string
+    remote       string
+    proto        string
+    expectedCode string
+  }{
+    {"Trusted HTTPS is served", "10.0.0.5:4000", "https", "HTTP/1.1 200 OK"},
+    {"Trusted HTTP is redirected", "10.0.0.5:4000", "http", "HTTP/1.1 301 Moved Permanently\r\nLocation: https://example.com/page.html\r\n"},
+    {"Untrusted HTTPS claim is redirected", "203.0.113.7:4000", "https", "HTTP/1.1 301 Moved Permanently\r\nLocation: https://example.com/page.html\r\n"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConnFrom(tc.remote, "GET /page.html HTTP/1.1\r\nHost: example.com\r\nX-Forwarded-Proto: "+tc.proto+"\r\n\r\n")
+      handleConnection(conn)
+      if response := conn.GetWrittenData(); !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %q, got: %s", tc.expectedCode, response)
+      }
+    })
+  }
+}
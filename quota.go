@@ -0,0 +1,84 @@
+package main
+
+import (
+  "log"
+  "net"
+  "strconv"
+  "sync"
+  "time"
+)
+
+// byteQuota caps the bytes sent to clients, headers included; once it is used up content requests
+// get 503 until the quota resets, every quotaInterval or on SIGHUP. 0 disables the quota.
+var (
+  byteQuota     byteSize
+  quotaInterval time.Duration
+)
+
+// quotaUsage counts the bytes sent in the current quota period.
+var quotaUsage struct {
+  sync.Mutex
+  bytes  int64
+  period time.Time
+}
+
+// recordServed adds the bytes of a finished response to the quota usage.
+func recordServed(n int64) {
+  if byteQuota <= 0 {
+    return
+  }
+  quotaUsage.Lock()
+  defer quotaUsage.Unlock()
+  rollQuotaPeriod()
+  quotaUsage.bytes += n
+}
+
+// quotaExceeded reports whether the byte quota of the current period is used up, and how long
+// until it resets, 0 when it only resets by hand.
+func quotaExceeded() (bool, time.Duration) {
+  if byteQuota <= 0 {
+    return false, 0
+  }
+  quotaUsage.Lock()
+  defer quotaUsage.Unlock()
+  rollQuotaPeriod()
+  if quotaUsage.bytes < int64(byteQuota) {
+    return false, 0
+  }
+  if quotaInterval <= 0 {
+    return true, 0
+  }
+  return true, time.Until(quotaUsage.period.Add(quotaInterval))
+}
+
+// rollQuotaPeriod starts a new period once quotaInterval has passed. The caller holds the lock.
+func rollQuotaPeriod() {
+  now := time.Now()
+  if quotaUsage.period.IsZero() {
+    quotaUsage.period = now
+  }
+  if quotaInterval > 0 && now.Sub(quotaUsage.period) >= quotaInterval {
+    quotaUsage.bytes, quotaUsage.period = 0, now
+  }
+}
+
+// resetQuota clears the usage and starts a new period.
+func resetQuota() {
+  if byteQuota <= 0 {
+    return
+  }
+  quotaUsage.Lock()
+  quotaUsage.bytes, quotaUsage.period = 0, time.Now()
+  quotaUsage.Unlock()
+  log.Printf("Byte quota reset")
+}
+
+// sendQuotaExceeded refuses a request while the quota is used up, telling clients when to retry
+// if the quota resets on its own.
+func sendQuotaExceeded(conn net.Conn, retryAfter time.Duration) {
+  var header responseHeader
+  if retryAfter > 0 {
+    header.set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+  }
+  sendErrorWithHeader(conn, 503, "Service Unavailable", header)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+  "strings"
+  "testing"
+  "time"
+)
+
+// useQuota sets the byte quota and reset period for the duration of the test, starting unused.
+func useQuota(t *testing.T, quota byteSize, interval time.Duration) {
+  t.Helper()
+  originalQuota, originalInterval := byteQuota, quotaInterval
+  byteQuota, quotaInterval = quota, interval
+  resetQuota()
+  t.Cleanup(func() {
+    byteQuota, quotaInterval = originalQuota, originalInterval
+    quotaUsage.Lock()
+    quotaUsage.bytes, quotaUsage.period = 0, time.Time{}
+    quotaUsage.Unlock()
+  })
+}
+
+func TestByteQuota(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"big.bin": strings.Repeat("x", 1000)})
+  useRoots(t, tempDir)
+  healthChecks = true
+  defer func() { healthChecks = false }()
+
+  get := func(path string) string {
+    conn := newMockConn("GET " + path + " HTTP/1.1\r\n\r\n")
+    handleConnection(conn)
+    return conn.GetWrittenData()
+  }
+
+  useQuota(t, 2500, 0)
+  for i := range 3 {
+    if response := get("/big.bin"); !strings.HasPrefix(response, "HTTP/1.1 200 OK") {
+      t.Fatalf("Expected request %d to be within the quota, got: %s", i+1, response)
+    }
+  }
+
+  response := get("/big.bin")
+  if !strings.HasPrefix(response, "HTTP/1.1 503 Service Unavailable") {
+    t.Errorf("Expected 503 once the quota is used up, got: %s", response)
+  }
+  if strings.Contains(response, "Retry-After") {
+    t.Errorf("Expected no Retry-After without -quota-reset, got: %s", response)
+  }
+  if response := get("/healthz"); !strings.HasPrefix(response, "HTTP/1.1 200 OK") {
+    t.Errorf("Expected health checks to be exempt, got: %s", response)
+  }
+
+  resetQuota()
+  if response := get("/big.bin"); !strings.HasPrefix(response, "HTTP/1.1 200 OK") {
+    t.Errorf("Expected requests to be served after a manual reset, got: %s", response)
+  }
+
+  // With a reset period, refusals say when to retry and the quota starts over on its own.
+  useQuota(t, 500, 100*time.Millisecond)
+  get("/big.bin")
+  response = get("/big.bin")
+  if !strings.HasPrefix(response, "HTTP/1.1 503 Service Unavailable") || !strings.Contains(response, "Retry-After: 1\r\n") {
+    t.Errorf("Expected 503 with Retry-After, got: %s", response)
+  }
+  time.Sleep(150 * time.Millisecond)
+  if response := get("/big.bin"); !strings.HasPrefix(response, "HTTP/1.1 200 OK") {
+    t.Errorf("Expected the quota to reset after the period, got: %s", response)
+  }
+}
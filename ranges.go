@@ -0,0 +1,96 @@
+package main
+
+import (
+  "errors"
+  "math"
+  "strconv"
+  "strings"
+)
+
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// parseRange parses a single byte range from a Range header against a resource of the given size
+// and returns the inclusive offsets of the range.
+// ok is false when the header should be ignored and the whole resource served: a malformed unit,
+// multiple ranges and syntactically invalid ranges. errRangeNotSatisfiable is returned for units
+// other than bytes and when the range lies entirely outside the resource.
+func parseRange(header string, size int64) (start int64, end int64, ok bool, err error) {
+  unit, spec, found := strings.Cut(strings.TrimSpace(header), "=")
+  if !found || !isToken(unit) {
+    return 0, 0, false, nil
+  }
+  if !strings.EqualFold(unit, "bytes") {
+    return 0, 0, false, errRangeNotSatisfiable
+  }
+  if strings.Contains(spec, ",") {
+    return 0, 0, false, nil
+  }
+
+  first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+  if !found {
+    return 0, 0, false, nil
+  }
+
+  if first == "" {
+    // Suffix range: the last n bytes.
+    n, valid := parseOffset(last)
+    if !valid {
+      return 0, 0, false, nil
+    }
+    if n == 0 || size == 0 {
+      return 0, 0, false, errRangeNotSatisfiable
+    }
+    if n > size {
+      n = size
+    }
+    return size - n, size - 1, true, nil
+  }
+
+  start, valid := parseOffset(first)
+  if !valid {
+    return 0, 0, false, nil
+  }
+
+  end = size - 1
+  if last != "" {
+    end, valid = parseOffset(last)
+    if !valid || end < start {
+      return 0, 0, false, nil
+    }
+    if end > size-1 {
+      end = size - 1
+    }
+  }
+
+  if start >= size {
+    return 0, 0, false, errRangeNotSatisfiable
+  }
+  return start, end, true, nil
+}
+
+// parseOffset parses the decimal digits of a range offset or suffix length. Values beyond the int64
+// range are clamped to math.MaxInt64: they still lie past the end of any file, so they are clamped
+// or refused like other out-of-range positions instead of making the whole header invalid.
+func parseOffset(s string) (int64, bool) {
+  if s == "" || strings.TrimLeft(s, "0123456789") != "" {
+    return 0, false
+  }
+  n, err := strconv.ParseInt(s, 10, 64)
+  if errors.Is(err, strconv.ErrRange) {
+    return math.MaxInt64, true
+  }
+  return n, err == nil
+}
+
+// isToken reports whether s is an HTTP token, the syntax of range units.
+func isToken(s string) bool {
+  if s == "" {
+    return false
+  }
+  for _, c := range s {
+    if c > 0x7e || c <= ' ' || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", c) {
+      return false
+    }
+  }
+  return true
+}
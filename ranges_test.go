@@ -0,0 +1,180 @@
+package main
+
+import (
+  "math"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+func TestParseRange(t *testing.T) {
+  testCases := []struct {
+    name          string
+    header        string
+    size          int64
+    expectedStart int64
+    expectedEnd   int64
+    expectedOK    bool
+    unsatisfiable bool
+  }{
+    {name: "Closed range", header: "bytes=0-4", size: 10, expectedStart: 0, expectedEnd: 4, expectedOK: true},
+    {name: "Open ended", header: "bytes=5-", size: 10, expectedStart: 5, expectedEnd: 9, expectedOK: true},
+    {name: "Suffix", header: "bytes=-3", size: 10, expectedStart: 7, expectedEnd: 9, expectedOK: true},
+    {name: "Suffix larger than file", header: "bytes=-30", size: 10, expectedStart: 0, expectedEnd: 9, expectedOK: true},
+    {name: "End clamped", header: "bytes=8-100", size: 10, expectedStart: 8, expectedEnd: 9, expectedOK: true},
+    {name: "Start past end", header: "bytes=10-", size: 10, unsatisfiable: true},
+    {name: "Empty suffix", header: "bytes=-0", size: 10, unsatisfiable: true},
+    {name: "Empty file", header: "bytes=0-", size: 0, unsatisfiable: true},
+    {name: "Reversed range ignored", header: "bytes=5-2", size: 10},
+    {name: "Multiple ranges ignored", header: "bytes=0-1,3-4", size: 10},
+    {name: "Garbage ignored", header: "bytes=a-b", size: 10},
+    {name: "Multi-gigabyte open ended", header: "bytes=0-", size: 5 << 30, expectedStart: 0, expectedEnd: 5<<30 - 1, expectedOK: true},
+    {name: "Last byte of a huge file", header: "bytes=-1", size: math.MaxInt64, expectedStart: math.MaxInt64 - 1, expectedEnd: math.MaxInt64 - 1, expectedOK: true},
+    {name: "End beyond int64 clamped", header: "bytes=10-99999999999999999999", size: 5 << 30, expectedStart: 10, expectedEnd: 5<<30 - 1, expectedOK: true},
+    {name: "Suffix beyond int64", header: "bytes=-99999999999999999999", size: 5 << 30, expectedStart: 0, expectedEnd: 5<<30 - 1, expectedOK: true},
+    {name: "Start beyond int64", header: "bytes=99999999999999999999-", size: 5 << 30, unsatisfiable: true},
+    {name: "Signed offset ignored", header: "bytes=+1-5", size: 10},
+    {name: "Unit is case-insensitive", header: "Bytes=0-4", size: 10, expectedStart: 0, expectedEnd: 4, expectedOK: true},
+    {name: "Non-bytes unit", header: "items=0-5", size: 10, unsatisfiable: true},
+    {name: "Malformed unit ignored", header: "by tes=0-5", size: 10},
+    {name: "Missing unit ignored", header: "=0-5", size: 10},
+    {name: "Missing separator ignored", header: "bytes0-5", size: 10},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      start, end, ok, err := parseRange(tc.header, tc.size)
+
+      if tc.unsatisfiable {
+        if err != errRangeNotSatisfiable {
+          t.Errorf("Expected errRangeNotSatisfiable, got %v", err)
+        }
+        return
+      }
+      if err != nil {
+        t.Fatalf("Unexpected error: %v", err)
+      }
+      if ok != tc.expectedOK || start != tc.expectedStart || end != tc.expectedEnd {
+        t.Errorf("Expected (%d, %d, %v), got (%d, %d, %v)", tc.expectedStart, tc.expectedEnd, tc.expectedOK, start, end, ok)
+      }
+    })
+  }
+}
+
+func TestSendFileRange(t *testing.T) {
+  path := filepath.Join(t.TempDir(), "digits.txt")
+  if err := os.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+    t.Fatalf("Failed to create test file: %v", err)
+  }
+
+  testCases := []struct {
+    name            string
+    rangeHeader     string
+    expectedStatus  string
+    expectedHeaders []string
+    expectedBody    string
+  }{
+    {
+      name:            "Partial content",
+      rangeHeader:     "bytes=2-5",
+      expectedStatus:  "HTTP/1.1 206 Partial Content",
+      expectedHeaders: []string{"Content-Range: bytes 2-5/10", "Content-Length: 4"},
+      expectedBody:    "2345",
+    },
+    {
+      name:            "Unsatisfiable",
+      rangeHeader:     "bytes=20-",
+      expectedStatus:  "HTTP/1.1 416 Range Not Satisfiable",
+      expectedHeaders: []string{"Content-Range: bytes */10"},
+      expectedBody:    "",
+    },
+    {
+      name:            "Non-bytes unit",
+      rangeHeader:     "items=0-5",
+      expectedStatus:  "HTTP/1.1 416 Range Not Satisfiable",
+      expectedHeaders: []string{"Content-Range: bytes */10"},
+      expectedBody:    "",
+    },
+    {
+      name:            "Malformed unit",
+      rangeHeader:     "it(ems=0-5",
+      expectedStatus:  "HTTP/1.1 200 OK",
+      expectedHeaders: []string{"Content-Length: 10"},
+      expectedBody:    "0123456789",
+    },
+    {
+      name:            "Ignored range",
+      rangeHeader:     "bytes=0-1,4-5",
+      expectedStatus:  "HTTP/1.1 200 OK",
+      expectedHeaders: []string{"Content-Length: 10"},
+      expectedBody:    "0123456789",
+    },
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn("")
+      sendFile(conn, &request{headers: map[string]string{"range": tc.rangeHeader}}, path)
+
+      head, body, _ := strings.Cut(conn.GetWrittenData(), "\r\n\r\n")
+      if !strings.HasPrefix(head, tc.expectedStatus) {
+        t.Errorf("Expected status %s, got: %s", tc.expectedStatus, head)
+      }
+      for _, header := range tc.expectedHeaders {
+        if !strings.Contains(head, header+"\r\n") && !strings.HasSuffix(head, header) {
+          t.Errorf("Expected header %s, got: %s", header, head)
+        }
+      }
+      if body != tc.expectedBody {
+        t.Errorf("Expected body %q, got %q", tc.expectedBody, body)
+      }
+    })
+  }
+}
+
+func TestLargeFileRange(t *testing.T) {
+  tempDir := t.TempDir()
+  const size = int64(5 << 30)
+  file, err := os.Create(filepath.Join(tempDir, "large.bin"))
+  if err != nil {
+    t.Fatalf("Failed to create test file: %v", err)
+  }
+  // A sparse file takes no disk space; HEAD requests keep the body from being sent.
+  err = file.Truncate(size)
+  file.Close()
+  if err != nil {
+    t.Skipf("Cannot create a sparse file: %v", err)
+  }
+  useRoots(t, tempDir)
+
+  testCases := []struct {
+    name            string
+    rangeHeader     string
+    expectedHeaders []string
+  }{
+    {"Whole file", "", []string{"HTTP/1.1 200 OK", "Content-Length: 5368709120"}},
+    {"Open ended", "bytes=0-", []string{"HTTP/1.1 206 Partial Content", "Content-Range: bytes 0-5368709119/5368709120", "Content-Length: 5368709120"}},
+    {"Tail", "bytes=5368709000-", []string{"HTTP/1.1 206 Partial Content", "Content-Range: bytes 5368709000-5368709119/5368709120", "Content-Length: 120"}},
+    {"Suffix", "bytes=-1", []string{"HTTP/1.1 206 Partial Content", "Content-Range: bytes 5368709119-5368709119/5368709120", "Content-Length: 1"}},
+    {"Past the end", "bytes=5368709120-", []string{"HTTP/1.1 416 Range Not Satisfiable", "Content-Range: bytes */5368709120"}},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      rangeField := ""
+      if tc.rangeHeader != "" {
+        rangeField = "Range: " + tc.rangeHeader + "\r\n"
+      }
+      conn := newMockConn("HEAD /large.bin HTTP/1.1\r\n" + rangeField + "\r\n")
+      handleConnection(conn)
+      head := conn.GetWrittenData()
+
+      for _, header := range tc.expectedHeaders {
+        if !strings.Contains(head, header+"\r\n") {
+          t.Errorf("Expected %s, got: %s", header, head)
+        }
+      }
+    })
+  }
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+  "fmt"
+  "net"
+  "net/url"
+  "strings"
+)
+
+// redirectRule sends requests for a moved path to target with a 301 or 302.
+type redirectRule struct {
+  from   string
+  target string
+  code   int
+}
+
+// redirectRules is the repeatable -redirect flag, checked in order before the file system.
+type redirectRules []redirectRule
+
+var redirects redirectRules
+
+func (r *redirectRules) String() string {
+  var items []string
+  for _, rule := range *r {
+    items = append(items, fmt.Sprintf("%s=%s %d", rule.from, rule.target, rule.code))
+  }
+  return strings.Join(items, ",")
+}
+
+// Set adds a "/old=/new" rule, optionally followed by " 302" for a temporary redirect. A path
+// ending in "/" moves everything below it: "/docs/=/manual/" sends /docs/a.html to /manual/a.html.
+// Targets are URL paths or absolute http(s) URLs.
+func (r *redirectRules) Set(value string) error {
+  from, target, found := strings.Cut(value, "=")
+  from, target = strings.TrimSpace(from), strings.TrimSpace(target)
+  code := 301
+  if rest, status, hasStatus := strings.Cut(target, " "); hasStatus {
+    switch strings.TrimSpace(status) {
+    case "301":
+    case "302":
+      code = 302
+    default:
+      return fmt.Errorf("invalid redirect %q: status must be 301 or 302", value)
+    }
+    target = rest
+  }
+
+  if !found || !strings.HasPrefix(from, "/") || target == "" {
+    return fmt.Errorf("invalid redirect %q: expected /old=/new or /old=https://host/new, optionally followed by 302", value)
+  }
+  if !strings.HasPrefix(target, "/") {
+    u, err := url.Parse(target)
+    if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+      return fmt.Errorf("invalid redirect target %q: expected a path or an http(s) URL", target)
+    }
+  }
+  *r = append(*r, redirectRule{from: from, target: target, code: code})
+  return nil
+}
+
+// match returns the Location and status for urlPath, or "" when no rule applies. The first
+// matching rule wins. The part of urlPath below a directory rule is cleaned and escaped, so it
+// can neither turn the target into another host with "//" nor add a query string.
+func (r redirectRules) match(urlPath string) (string, int) {
+  for _, rule := range r {
+    if urlPath == rule.from {
+      return rule.target, rule.code
+    }
+    if rest, ok := strings.CutPrefix(urlPath, rule.from); ok && strings.HasSuffix(rule.from, "/") {
+      rest = withTrailingSlash(cleanURLPath(rest), urlPath)
+      return strings.TrimSuffix(rule.target, "/") + (&url.URL{Path: rest}).EscapedPath(), rule.code
+    }
+  }
+  return "", 0
+}
+
+// serveRedirect answers req with a redirect when a -redirect rule matches its path and reports
+// whether it did. Local targets keep any stripped prefix, and the query string is carried over
+// unless the target has its own.
+func serveRedirect(conn net.Conn, req *request) bool {
+  location, code := redirects.match(req.path)
+  if location == "" {
+    return false
+  }
+
+  if strings.HasPrefix(location, "/") {
+    location = req.prefix + location
+  }
+  if req.rawQuery != "" && !strings.Contains(location, "?") {
+    location += "?" + req.rawQuery
+  }
+
+  reason := "Moved Permanently"
+  if code == 302 {
+    reason = "Found"
+  }
+  header := responseHeader{}
+  header.set("Location", location)
+  header.set("Content-Length", "0")
+  writeResponseHeader(conn, code, reason, header)
+  return true
+}
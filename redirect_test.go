@@ -0,0 +1,63 @@
+package main
+
+import (
+  "strings"
+  "testing"
+)
+
+func TestRedirects(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "old.html":  "still on disk",
+    "keep.html": "kept",
+  })
+  useRoots(t, tempDir)
+
+  originalRedirects := redirects
+  redirects = nil
+  defer func() { redirects = originalRedirects }()
+  for _, rule := range []string{"/old.html=/new.html", "/docs/=/manual/", "/blog=https://blog.example.com/ 302", "/old/=/"} {
+    if err := redirects.Set(rule); err != nil {
+      t.Fatalf("Unexpected error: %v", err)
+    }
+  }
+
+  testCases := []struct {
+    name             string
+    path             string
+    expectedCode     string
+    expectedLocation string
+  }{
+    {"Moved file", "/old.html", "HTTP/1.1 301 Moved Permanently", "/new.html"},
+    {"Moved directory", "/docs/guide/intro.html", "HTTP/1.1 301 Moved Permanently", "/manual/guide/intro.html"},
+    {"Directory itself", "/docs/", "HTTP/1.1 301 Moved Permanently", "/manual/"},
+    {"Query kept", "/old.html?lang=en", "HTTP/1.1 301 Moved Permanently", "/new.html?lang=en"},
+    {"External temporary", "/blog", "HTTP/1.1 302 Found", "https://blog.example.com/"},
+    {"No rule", "/keep.html", "HTTP/1.1 200 OK", ""},
+    {"Escaped remainder", "/docs/a%20b%3Fc.html", "HTTP/1.1 301 Moved Permanently", "/manual/a%20b%3Fc.html"},
+    {"No protocol-relative target", "/old//evil.com/x", "HTTP/1.1 301 Moved Permanently", "/evil.com/x"},
+    {"Prefix only on segments", "/docsearch", "HTTP/1.1 404 Not Found", ""},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.HasPrefix(response, tc.expectedCode) {
+        t.Errorf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+      if tc.expectedLocation != "" && !strings.Contains(response, "Location: "+tc.expectedLocation+"\r\n") {
+        t.Errorf("Expected Location %s, got: %s", tc.expectedLocation, response)
+      }
+    })
+  }
+
+  var rules redirectRules
+  for _, invalid := range []string{"/old", "old=/new", "/old=", "/old=/new 307", "/old=ftp://host/new"} {
+    if err := rules.Set(invalid); err == nil {
+      t.Errorf("Expected error for redirect %q", invalid)
+    }
+  }
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+  "bufio"
+  "flag"
+  "fmt"
+  "io"
+  "log"
+  "mime"
+  "os"
+  "os/signal"
+  "path/filepath"
+  "slices"
+  "strings"
+  "sync/atomic"
+  "syscall"
+)
+
+// settings holds the configuration that can be reloaded at runtime with SIGHUP.
+// Handlers must treat a loaded settings value as immutable; reloads swap in a new one.
+type settings struct {
+  mimeTypes map[string]string
+  // headers are the -header fields added to every response.
+  headers headerList
+}
+
+var currentSettings atomic.Pointer[settings]
+
+// activeSettings returns the settings in effect, or empty settings if none were loaded.
+func activeSettings() *settings {
+  if s := currentSettings.Load(); s != nil {
+    return s
+  }
+  return &settings{}
+}
+
+// loadSettings reads the reloadable configuration files named by the command-line flags.
+func loadSettings() (*settings, error) {
+  s := &settings{headers: slices.Clone(customHeaders)}
+
+  if mimeTypesFile != "" {
+    file, err := os.Open(mimeTypesFile)
+    if err != nil {
+      return nil, fmt.Errorf("reading mime types: %v", err)
+    }
+    defer file.Close()
+
+    if s.mimeTypes, err = parseMimeTypes(file); err != nil {
+      return nil, fmt.Errorf("parsing %s: %v", mimeTypesFile, err)
+    }
+  }
+
+  return s, nil
+}
+
+// reloadSettings loads fresh settings and swaps them in. On failure the previous settings stay active.
+func reloadSettings() error {
+  s, err := loadSettings()
+  if err != nil {
+    return err
+  }
+  currentSettings.Store(s)
+  return nil
+}
+
+// watchReload reopens the access log and reloads the settings whenever the process receives SIGHUP.
+// The returned function stops watching.
+func watchReload() func() {
+  signals := make(chan os.Signal, 1)
+  signal.Notify(signals, syscall.SIGHUP)
+  done := make(chan struct{})
+
+  go func() {
+    for {
+      select {
+      case <-signals:
+        if accessLogFile != nil {
+          if err := accessLogFile.reopen(); err != nil {
+            log.Printf("Error: %v", err)
+          }
+        }
+        resetQuota()
+        if err := reloadConfigFile(flag.CommandLine); err != nil {
+          log.Printf("Error reloading config file, keeping previous settings: %v", err)
+          continue
+        }
+        if err := reloadSettings(); err != nil {
+          log.Printf("Error reloading configuration, keeping previous settings: %v", err)
+          continue
+        }
+        log.Printf("Configuration reloaded (port and directory changes require a restart)")
+      case <-done:
+        return
+      }
+    }
+  }()
+
+  return func() {
+    signal.Stop(signals)
+    close(done)
+  }
+}
+
+// parseMimeTypes parses a mime.types style file: each line holds a content type followed by
+// the extensions (without dot) mapped to it. Blank lines and lines starting with # are ignored.
+func parseMimeTypes(r io.Reader) (map[string]string, error) {
+  types := make(map[string]string)
+  scanner := bufio.NewScanner(r)
+
+  for line := 1; scanner.Scan(); line++ {
+    fields := strings.Fields(scanner.Text())
+    if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+      continue
+    }
+    if len(fields) < 2 || !strings.Contains(fields[0], "/") {
+      return nil, fmt.Errorf("line %d: expected a content type followed by extensions", line)
+    }
+
+    for _, ext := range fields[1:] {
+      types["."+strings.ToLower(strings.TrimPrefix(ext, "."))] = fields[0]
+    }
+  }
+
+  return types, scanner.Err()
+}
+
+// config returns the settings in effect for req. They are read once per request, so a reload
+// in the middle of it cannot leave it with a mix of old and new settings.
+func (r *request) config() *settings {
+  if r.settings == nil {
+    r.settings = activeSettings()
+  }
+  return r.settings
+}
+
+// contentTypeFor returns the content type for a file name, preferring the overrides configured
+// for req.
+func contentTypeFor(req *request, name string) string {
+  ext := strings.ToLower(filepath.Ext(name))
+  if contentType, ok := req.config().mimeTypes[ext]; ok {
+    return contentType
+  }
+  return mime.TypeByExtension(ext)
+}
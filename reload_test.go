@@ -0,0 +1,182 @@
+package main
+
+import (
+  "flag"
+  "os"
+  "path/filepath"
+  "strings"
+  "sync"
+  "testing"
+)
+
+// useMimeTypesFile points -mime-types at path and restores the flag and settings after the test.
+func useMimeTypesFile(t *testing.T, path string) {
+  t.Helper()
+  originalFile, originalSettings := mimeTypesFile, currentSettings.Load()
+  mimeTypesFile = path
+  t.Cleanup(func() {
+    mimeTypesFile = originalFile
+    currentSettings.Store(originalSettings)
+  })
+}
+
+func TestParseMimeTypes(t *testing.T) {
+  input := "# comment\n\ntext/markdown md markdown\napplication/x-custom .CUS\n"
+
+  types, err := parseMimeTypes(strings.NewReader(input))
+  if err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+
+  expected := map[string]string{".md": "text/markdown", ".markdown": "text/markdown", ".cus": "application/x-custom"}
+  for ext, contentType := range expected {
+    if types[ext] != contentType {
+      t.Errorf("Expected %s for %s, got %q", contentType, ext, types[ext])
+    }
+  }
+
+  if _, err := parseMimeTypes(strings.NewReader("md text/markdown\n")); err == nil {
+    t.Errorf("Expected error for a line not starting with a content type")
+  }
+}
+
+func TestReloadKeepsSettingsOnError(t *testing.T) {
+  mimeFile := filepath.Join(t.TempDir(), "mime.types")
+  if err := os.WriteFile(mimeFile, []byte("text/plain md\n"), 0644); err != nil {
+    t.Fatalf("Failed to write mime types: %v", err)
+  }
+  useMimeTypesFile(t, mimeFile)
+
+  if err := reloadSettings(); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  if err := os.WriteFile(mimeFile, []byte("broken\n"), 0644); err != nil {
+    t.Fatalf("Failed to rewrite mime types: %v", err)
+  }
+  if err := reloadSettings(); err == nil {
+    t.Fatalf("Expected error for an invalid mime types file")
+  }
+
+  if got := contentTypeFor(&request{}, "a.md"); got != "text/plain" {
+    t.Errorf("Expected previous settings to stay active, got %q", got)
+  }
+}
+
+func TestReloadDuringRequests(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"doc.page": "<html><head></head><body>page</body></html>"})
+  useRoots(t, tempDir)
+  useMimeTypesFile(t, "")
+
+  // The type of .page decides both the base tag rewrite and the Content-Type, looked up at
+  // different points of the request; a response mixing two reloads would disagree with itself.
+  originalBase := baseHref
+  baseHref = "/"
+  defer func() { baseHref = originalBase }()
+  asHTML := &settings{mimeTypes: map[string]string{".page": "text/html"}}
+  asText := &settings{mimeTypes: map[string]string{".page": "text/plain"}}
+  currentSettings.Store(asHTML)
+
+  stop := make(chan struct{})
+  reloaded := make(chan struct{})
+  go func() {
+    defer close(reloaded)
+    for i := 0; ; i++ {
+      select {
+      case <-stop:
+        return
+      default:
+      }
+      if i%2 == 0 {
+        currentSettings.Store(asText)
+      } else {
+        currentSettings.Store(asHTML)
+      }
+    }
+  }()
+
+  var wg sync.WaitGroup
+  errs := make(chan string, 8)
+  for range 8 {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      for range 200 {
+        conn := newMockConn("GET /doc.page HTTP/1.1\r\n\r\n")
+        handleConnection(conn)
+
+        response := conn.GetWrittenData()
+        html := strings.Contains(response, "Content-Type: text/html\r\n")
+        text := strings.Contains(response, "Content-Type: text/plain\r\n")
+        based := strings.Contains(response, `<base href="/">`)
+        if html == text || html != based {
+          select {
+          case errs <- response:
+          default:
+          }
+          return
+        }
+      }
+    }()
+  }
+  wg.Wait()
+  close(stop)
+  <-reloaded
+
+  select {
+  case response := <-errs:
+    t.Errorf("Expected every response to use one version of the settings, got: %s", response)
+  default:
+  }
+}
+
+func TestReloadHeaders(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"file.txt": "hello"})
+  useRoots(t, tempDir)
+  useExtraHeaders(t, false)
+
+  fs := flag.NewFlagSet("test", flag.ContinueOnError)
+  fs.Var(&customHeaders, "header", "")
+
+  originalPath, originalValues := configPath, configValues
+  defer func() { configPath, configValues = originalPath, originalValues }()
+  configPath = writeConfig(t, `{"header": ["X-Release: 1", "X-Team: web"]}`)
+
+  values, err := readConfigFile(configPath)
+  if err == nil {
+    err = applyConfig(fs, values, nil)
+  }
+  if err == nil {
+    err = reloadSettings()
+  }
+  if err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  configValues = values
+
+  if err := os.WriteFile(configPath, []byte(`{"header": ["X-Release: 2"]}`), 0644); err != nil {
+    t.Fatalf("Failed to rewrite config: %v", err)
+  }
+  logs := captureLog(t)
+  if err := reloadConfigFile(fs); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  if err := reloadSettings(); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  if strings.Contains(logs.String(), "requires a restart") {
+    t.Errorf("Expected -header to be reloadable, got: %s", logs)
+  }
+
+  conn := newMockConn("GET /file.txt HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+  headers, _, _ := strings.Cut(conn.GetWrittenData(), "\r\n\r\n")
+
+  if !strings.Contains(headers, "X-Release: 2") {
+    t.Errorf("Expected the reloaded header, got: %s", headers)
+  }
+  if strings.Contains(headers, "X-Release: 1") || strings.Contains(headers, "X-Team") {
+    t.Errorf("Expected the previous headers to be replaced, got: %s", headers)
+  }
+}
@@ -0,0 +1,55 @@
+//go:build unix
+
+package main
+
+import (
+  "os"
+  "path/filepath"
+  "strings"
+  "syscall"
+  "testing"
+  "time"
+)
+
+func TestReloadOnSIGHUP(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"notes.md": "# notes"})
+  useRoots(t, tempDir)
+
+  mimeFile := filepath.Join(tempDir, "mime.types")
+  if err := os.WriteFile(mimeFile, []byte("text/plain md\n"), 0644); err != nil {
+    t.Fatalf("Failed to write mime types: %v", err)
+  }
+  useMimeTypesFile(t, mimeFile)
+
+  if err := reloadSettings(); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  stop := watchReload()
+  defer stop()
+
+  request := func() string {
+    conn := newMockConn("GET /notes.md HTTP/1.1\r\n\r\n")
+    handleConnection(conn)
+    return conn.GetWrittenData()
+  }
+
+  if response := request(); !strings.Contains(response, "Content-Type: text/plain\r\n") {
+    t.Fatalf("Expected initial override, got: %s", response)
+  }
+
+  if err := os.WriteFile(mimeFile, []byte("text/markdown md\n"), 0644); err != nil {
+    t.Fatalf("Failed to rewrite mime types: %v", err)
+  }
+  if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+    t.Fatalf("Failed to send SIGHUP: %v", err)
+  }
+
+  deadline := time.Now().Add(2 * time.Second)
+  for !strings.Contains(request(), "Content-Type: text/markdown\r\n") {
+    if time.Now().After(deadline) {
+      t.Fatalf("Configuration was not reloaded after SIGHUP")
+    }
+    time.Sleep(10 * time.Millisecond)
+  }
+}
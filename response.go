@@ -0,0 +1,97 @@
+package main
+
+import (
+  "fmt"
+  "net"
+  "strings"
+  "time"
+)
+
+// responseConn wraps the client connection while a request is served and records what is
+// written back: the response status, the number of bytes and timing marks for diagnostics.
+type responseConn struct {
+  net.Conn
+
+  start   time.Time
+  status  int
+  written int64
+  timings []timing
+
+  // closeAfter is set when the connection must not be reused after this response: the client
+  // did not ask to keep it, the response announced Connection: close, or its body fell short
+  // of the declared Content-Length.
+  closeAfter bool
+
+  // head is set for HEAD requests: once the header is out, body writes are dropped so every
+  // response carries the headers, Content-Length included, of its GET counterpart.
+  head       bool
+  headerSent bool
+
+  // simple is set for HTTP/0.9 requests, whose response is the body alone: the status line and
+  // header fields are never sent, and the connection closes to end the body.
+  simple bool
+
+  // settings are the reloadable settings of the request being answered; see request.config.
+  settings *settings
+}
+
+type timing struct {
+  name     string
+  duration time.Duration
+}
+
+func newResponseConn(conn net.Conn) *responseConn {
+  return &responseConn{Conn: conn, start: time.Now()}
+}
+
+func (c *responseConn) Write(b []byte) (int, error) {
+  if c.head && c.headerSent {
+    return len(b), nil
+  }
+  n, err := c.Conn.Write(b)
+  c.written += int64(n)
+  return n, err
+}
+
+func (c *responseConn) recordTiming(name string, start time.Time) {
+  c.timings = append(c.timings, timing{name: name, duration: time.Since(start)})
+}
+
+// serverTiming formats the recorded marks as a Server-Timing header value. The total covers the
+// time up to the response header; the body is written afterwards and only shows in the access log.
+func (c *responseConn) serverTiming() string {
+  var metrics []string
+  for _, t := range append(c.timings, timing{name: "total", duration: time.Since(c.start)}) {
+    metrics = append(metrics, fmt.Sprintf("%s;dur=%.3f", t.name, float64(t.duration.Microseconds())/1000))
+  }
+  return strings.Join(metrics, ", ")
+}
+
+// recordTiming adds a timing mark when conn is tracked by a responseConn.
+func recordTiming(conn net.Conn, name string, start time.Time) {
+  if rc, ok := conn.(*responseConn); ok {
+    rc.recordTiming(name, start)
+  }
+}
+
+// abortResponse marks the response on conn as incomplete so the connection is closed after it.
+func abortResponse(conn net.Conn) {
+  if rc, ok := conn.(*responseConn); ok {
+    rc.closeAfter = true
+  }
+}
+
+// bodyOmitted reports whether the body of the response on conn is dropped, so senders can skip
+// producing it.
+func bodyOmitted(conn net.Conn) bool {
+  rc, ok := conn.(*responseConn)
+  return ok && rc.head && rc.headerSent
+}
+
+// unwrapConn returns the client connection underneath a responseConn.
+func unwrapConn(conn net.Conn) net.Conn {
+  if rc, ok := conn.(*responseConn); ok {
+    return rc.Conn
+  }
+  return conn
+}
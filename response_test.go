@@ -0,0 +1,55 @@
+package main
+
+import (
+  "encoding/json"
+  "regexp"
+  "strings"
+  "testing"
+)
+
+func TestServerTimingHeader(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"file.txt": "content"})
+  useRoots(t, tempDir)
+
+  serverTimingPattern := regexp.MustCompile(`(?m)^Server-Timing: parse;dur=\d+\.\d{3}, stat;dur=\d+\.\d{3}, read;dur=\d+\.\d{3}, total;dur=\d+\.\d{3}\r$`)
+
+  for _, enabled := range []bool{true, false} {
+    originalServerTiming := serverTiming
+    serverTiming = enabled
+
+    conn := newMockConn("GET /file.txt HTTP/1.1\r\n\r\n")
+    handleConnection(conn)
+    response := conn.GetWrittenData()
+    serverTiming = originalServerTiming
+
+    if enabled && !serverTimingPattern.MatchString(response) {
+      t.Errorf("Expected a Server-Timing header with parse, stat, read and total, got: %s", response)
+    }
+    if !enabled && strings.Contains(response, "Server-Timing") {
+      t.Errorf("Expected no Server-Timing header when disabled, got: %s", response)
+    }
+  }
+}
+
+func TestAccessLogStatusAndDuration(t *testing.T) {
+  useRoots(t, t.TempDir())
+  originalFormat := logFormat
+  logFormat = "json"
+  defer func() { logFormat = originalFormat }()
+  buf := captureLog(t)
+
+  conn := newMockConn("GET /missing.txt HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+
+  var entry accessEntry
+  if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+    t.Fatalf("Expected a JSON access log line, got %q: %v", buf.String(), err)
+  }
+  if entry.Status != 404 || entry.Bytes != int64(len(conn.GetWrittenData())) {
+    t.Errorf("Expected status 404 and %d bytes, got %+v", len(conn.GetWrittenData()), entry)
+  }
+  if entry.DurationMS <= 0 {
+    t.Errorf("Expected a positive duration, got %v", entry.DurationMS)
+  }
+}
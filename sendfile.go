@@ -0,0 +1,72 @@
+package main
+
+import (
+  "fmt"
+  "net"
+  "net/url"
+  "path/filepath"
+  "strings"
+)
+
+// sendfileHeader is the -sendfile-header value. When set, files are not streamed: the response
+// names the file in this header and an upstream proxy sends the content instead.
+var sendfileHeader string
+
+// validateSendfileHeader checks the -sendfile-header value and returns it in canonical case.
+func validateSendfileHeader(name string) (string, error) {
+  switch {
+  case name == "":
+    return "", nil
+  case strings.EqualFold(name, "X-Sendfile"):
+    return "X-Sendfile", nil
+  case strings.EqualFold(name, "X-Accel-Redirect"):
+    return "X-Accel-Redirect", nil
+  }
+  return "", fmt.Errorf("unknown sendfile header %q (expected X-Sendfile or X-Accel-Redirect)", name)
+}
+
+// sendInternalRedirect answers req with a bodyless response handing the file at path to the proxy.
+// X-Sendfile carries the absolute file system path, as Apache's mod_xsendfile expects;
+// X-Accel-Redirect carries the file's URL path, for an nginx internal location to map.
+func sendInternalRedirect(conn net.Conn, req *request, path string) {
+  target := (&url.URL{Path: internalRedirectPath(req, path)}).EscapedPath()
+  if sendfileHeader == "X-Sendfile" {
+    abs, err := filepath.Abs(path)
+    if err != nil {
+      sendError(conn, 500, "Internal Server Error")
+      return
+    }
+    target = abs
+  }
+
+  contentType := req.contentType
+  if contentType == "" {
+    contentType = contentTypeFor(req, path)
+  }
+  if contentType == "" {
+    contentType = defaultType
+  }
+
+  header := responseHeader{}
+  header.set("Content-Type", contentType)
+  header.set(sendfileHeader, target)
+  header.set("Content-Length", "0")
+  writeResponseHeader(conn, 200, "OK", header)
+}
+
+// internalRedirectPath returns the URL path of the file at path below the document root or mount
+// holding it. It differs from the request path when an index file, an extension, an alias or a
+// case-insensitive match was served.
+func internalRedirectPath(req *request, path string) string {
+  dirs, prefix := roots, ""
+  if m, _ := mounts.match(req.path); m != nil {
+    dirs, prefix = []string{m.dir}, m.prefix
+  }
+  for _, dir := range dirs {
+    rel, err := filepath.Rel(dir, path)
+    if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+      return req.prefix + prefix + urlPathOf(rel)
+    }
+  }
+  return req.prefix + req.path
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+func useSendfileHeader(t *testing.T, name string) {
+  original := sendfileHeader
+  sendfileHeader = name
+  t.Cleanup(func() { sendfileHeader = original })
+}
+
+func TestSendfileHeader(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"docs/report.txt": "report contents"})
+  useRoots(t, tempDir)
+
+  testCases := []struct {
+    name           string
+    header         string
+    expectedHeader string
+  }{
+    {"X-Sendfile", "X-Sendfile", "X-Sendfile: " + filepath.Join(tempDir, "docs", "report.txt")},
+    {"X-Accel-Redirect", "X-Accel-Redirect", "X-Accel-Redirect: /docs/report.txt"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      useSendfileHeader(t, tc.header)
+      conn := newMockConn("GET /docs/report.txt HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+      headers, body, _ := strings.Cut(conn.GetWrittenData(), "\r\n\r\n")
+
+      if !strings.HasPrefix(headers, "HTTP/1.1 200 OK") {
+        t.Errorf("Expected 200 OK, got: %s", headers)
+      }
+      if !strings.Contains(headers+"\r\n", "\r\n"+tc.expectedHeader+"\r\n") {
+        t.Errorf("Expected %q, got: %s", tc.expectedHeader, headers)
+      }
+      if !strings.Contains(headers, "Content-Type: text/plain") {
+        t.Errorf("Expected the file's content type, got: %s", headers)
+      }
+      if body != "" {
+        t.Errorf("Expected no body, got: %q", body)
+      }
+    })
+  }
+}
+
+func TestInternalRedirectTarget(t *testing.T) {
+  siteDir, mountDir := t.TempDir(), t.TempDir()
+  writeTestFiles(t, siteDir, map[string]string{
+    "about.html":      "about",
+    "docs/index.html": "docs",
+    "a b.txt":         "spaced",
+  })
+  writeTestFiles(t, mountDir, map[string]string{"report.pdf": "pdf"})
+  useRoots(t, siteDir)
+  useSendfileHeader(t, "X-Accel-Redirect")
+  useDirectoryStrategy(t, "index")
+
+  originalExtensions, originalMounts := tryExtensions, mounts
+  defer func() { tryExtensions, mounts = originalExtensions, originalMounts }()
+  tryExtensions, mounts = nil, nil
+  if err := tryExtensions.Set(".html"); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  if err := mounts.Set("/files=" + mountDir); err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+
+  testCases := []struct {
+    name           string
+    path           string
+    expectedTarget string
+  }{
+    {"Index file", "/docs/", "/docs/index.html"},
+    {"Try extensions", "/about", "/about.html"},
+    {"Escaped name", "/a%20b.txt", "/a%20b.txt"},
+    {"Mount", "/files/report.pdf", "/files/report.pdf"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn("GET " + tc.path + " HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+      headers, _, _ := strings.Cut(conn.GetWrittenData(), "\r\n\r\n")
+
+      if !strings.HasPrefix(headers, "HTTP/1.1 200 OK") {
+        t.Errorf("Expected 200 OK, got: %s", headers)
+      }
+      if !strings.Contains(headers+"\r\n", "\r\nX-Accel-Redirect: "+tc.expectedTarget+"\r\n") {
+        t.Errorf("Expected X-Accel-Redirect %s, got: %s", tc.expectedTarget, headers)
+      }
+    })
+  }
+}
+
+func TestValidateSendfileHeader(t *testing.T) {
+  if name, err := validateSendfileHeader("x-accel-redirect"); err != nil || name != "X-Accel-Redirect" {
+    t.Errorf("Expected X-Accel-Redirect, got %q, %v", name, err)
+  }
+  if _, err := validateSendfileHeader("X-Other"); err == nil {
+    t.Errorf("Expected an error for an unknown header")
+  }
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+  "context"
+  "crypto/tls"
+  "errors"
+  "fmt"
+  "log"
+  "net"
+  "strconv"
+  "sync"
+  "sync/atomic"
+  "syscall"
+  "time"
+)
+
+// Server accepts connections on one or more listeners and dispatches them to a fixed pool of workers.
+type Server struct {
+  listeners []net.Listener
+  workers   int
+
+  closing  atomic.Bool
+  accepted atomic.Int64
+  wg       sync.WaitGroup
+
+  mu    sync.Mutex
+  conns map[net.Conn]struct{}
+
+  done     chan struct{}
+  doneOnce sync.Once
+}
+
+// exitOnIdle shuts the server down once no connection has been accepted for this long; 0 disables it.
+var exitOnIdle time.Duration
+
+// maxQueue, when positive, lets this many accepted connections wait for a busy worker; further
+// connections are answered with 503 by overflow instead of stalling the accept loop. 0 keeps
+// the accept loop waiting until a worker is free.
+var maxQueue int
+
+// exitAfterConnections shuts the server down once it has accepted this many connections, after they
+// are served; 0 disables it. Together with exitOnIdle it gives tests and scripts a bounded run.
+var exitAfterConnections int
+
+func NewServer(listener net.Listener, workers int) *Server {
+  return &Server{
+    listeners: []net.Listener{listener},
+    workers:   workers,
+    conns:     make(map[net.Conn]struct{}),
+    done:      make(chan struct{}),
+  }
+}
+
+// AddListener makes the server accept connections on listener too, sharing the worker pool.
+// It must be called before Run.
+func (s *Server) AddListener(listener net.Listener) {
+  s.listeners = append(s.listeners, listener)
+}
+
+// Done is closed once a Shutdown has finished, whether it was requested or triggered by -exit-on-idle.
+func (s *Server) Done() <-chan struct{} {
+  return s.done
+}
+
+// Run starts the workers and accepts connections until a listener fails or Shutdown is called.
+// After a Shutdown it returns nil without waiting for in-flight connections; wait for Shutdown to return for that.
+func (s *Server) Run() error {
+
+  connChan := make(chan net.Conn, maxQueue)
+  defer close(connChan)
+
+  for i := range s.workers {
+    go func(workerID int) {
+      for conn := range connChan {
+        debugf("Worker %d: handling connection", workerID)
+        handleConnection(conn)
+        releaseConn(conn)
+        s.untrack(conn)
+      }
+    }(i)
+  }
+
+  // Everything the server needs was set up before Run; from here on it can take traffic.
+  ready.Store(true)
+
+  var idle *time.Timer
+  if exitOnIdle > 0 {
+    idle = time.AfterFunc(exitOnIdle, func() {
+      log.Printf("No connections for %v, shutting down", exitOnIdle)
+      s.Shutdown(shutdownTimeout)
+    })
+    defer idle.Stop()
+  }
+
+  // The first listener to stop ends Run; the others are closed so their loops finish too.
+  errs := make(chan error, len(s.listeners))
+  var accepting sync.WaitGroup
+  for _, listener := range s.listeners {
+    accepting.Add(1)
+    go func() {
+      defer accepting.Done()
+      errs <- s.accept(listener, connChan, idle)
+    }()
+  }
+
+  err := <-errs
+  for _, listener := range s.listeners {
+    listener.Close()
+  }
+  accepting.Wait()
+  return err
+}
+
+// RunContext is Run, shutting the server down with the -shutdown-timeout when ctx is cancelled.
+func (s *Server) RunContext(ctx context.Context) error {
+  go func() {
+    select {
+    case <-ctx.Done():
+      s.Shutdown(shutdownTimeout)
+    case <-s.done:
+    }
+  }()
+  return s.Run()
+}
+
+// accept hands the connections of listener to the workers until it fails or Shutdown is called.
+func (s *Server) accept(listener net.Listener, connChan chan<- net.Conn, idle *time.Timer) error {
+  for {
+
+    conn, err := listener.Accept()
+    if err != nil {
+      if s.closing.Load() {
+        return nil
+      }
+      return err
+    }
+
+    if idle != nil {
+      idle.Reset(exitOnIdle)
+    }
+
+    if err := setNoDelay(conn, tcpNoDelay); err != nil {
+      debugf("Setting TCP_NODELAY: %v", err)
+    }
+    // A connection without a deadline could hold a worker forever, so it is not served.
+    if err := conn.SetDeadline(time.Now().Add(requestTimeout)); err != nil {
+      log.Printf("Error: setting deadline for %v: %v", conn.RemoteAddr(), err)
+      conn.Close()
+      continue
+    }
+    s.track(conn)
+    if !acquireConn(conn) {
+      go s.refuse(conn)
+      continue
+    }
+    if maxQueue > 0 {
+      select {
+      case connChan <- conn:
+      default:
+        go s.overflow(conn)
+      }
+    } else {
+      connChan <- conn
+    }
+
+    if exitAfterConnections > 0 && s.accepted.Add(1) == int64(exitAfterConnections) {
+      log.Printf("Accepted %d connections, shutting down", exitAfterConnections)
+      go s.Shutdown(shutdownTimeout)
+      return nil
+    }
+  }
+}
+
+// overflow answers a connection no worker can take with a minimal 503 and closes it. It runs apart
+// from the accept loop, so a slow client or TLS handshake cannot stall accepting.
+func (s *Server) overflow(conn net.Conn) {
+  defer s.untrack(conn)
+  defer releaseConn(conn)
+  defer conn.Close()
+
+  overflowConnections.Add(1)
+  debugf("All workers busy, refusing connection from %v", conn.RemoteAddr())
+  sendErrorWithHeader(conn, 503, "Service Unavailable", responseHeader{{name: "Retry-After", value: "1"}})
+}
+
+// refuse answers a connection over -max-conns-per-ip with a minimal 429 and closes it, apart from
+// the accept loop like overflow.
+func (s *Server) refuse(conn net.Conn) {
+  defer s.untrack(conn)
+  defer conn.Close()
+
+  limitedConnections.Add(1)
+  debugf("Too many connections from %v, refusing", conn.RemoteAddr())
+  sendErrorWithHeader(conn, 429, "Too Many Requests", responseHeader{{name: "Retry-After", value: "1"}})
+}
+
+// Shutdown stops accepting connections and waits up to timeout for in-flight connections to finish.
+// Connections still open after the timeout are closed forcibly and an error reporting them is returned.
+func (s *Server) Shutdown(timeout time.Duration) error {
+
+  ready.Store(false)
+  s.closing.Store(true)
+  for _, listener := range s.listeners {
+    listener.Close()
+  }
+  defer s.doneOnce.Do(func() { close(s.done) })
+
+  drained := make(chan struct{})
+  go func() {
+    s.wg.Wait()
+    close(drained)
+  }()
+
+  select {
+  case <-drained:
+    return nil
+  case <-time.After(timeout):
+  }
+
+  s.mu.Lock()
+  forced := len(s.conns)
+  for conn := range s.conns {
+    conn.Close()
+  }
+  s.mu.Unlock()
+
+  log.Printf("Shutdown timeout of %v exceeded: forcibly closed %d connections", timeout, forced)
+  return fmt.Errorf("shutdown timed out with %d connections still open", forced)
+}
+
+// setNoDelay enables or disables Nagle's algorithm on a TCP connection, looking through TLS.
+// Other connection types, such as Unix sockets, are left untouched.
+func setNoDelay(conn net.Conn, enabled bool) error {
+  if tlsConn, ok := conn.(*tls.Conn); ok {
+    conn = tlsConn.NetConn()
+  }
+  tcpConn, ok := conn.(*net.TCPConn)
+  if !ok {
+    return nil
+  }
+  return tcpConn.SetNoDelay(enabled)
+}
+
+// connCount returns the number of accepted connections that have not finished yet.
+func (s *Server) connCount() int {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  return len(s.conns)
+}
+
+func (s *Server) track(conn net.Conn) {
+  s.wg.Add(1)
+  s.mu.Lock()
+  s.conns[conn] = struct{}{}
+  s.mu.Unlock()
+}
+
+func (s *Server) untrack(conn net.Conn) {
+  s.mu.Lock()
+  delete(s.conns, conn)
+  s.mu.Unlock()
+  s.wg.Done()
+}
+
+// bindError explains a failure to listen on port, set with the named flag, suggesting a fix for the
+// common causes.
+func bindError(port, flagName string, err error) error {
+  switch {
+  case errors.Is(err, syscall.EADDRINUSE):
+    return fmt.Errorf("port %s is already in use; stop the process using it or pick another port with -%s: %v", port, flagName, err)
+  case errors.Is(err, syscall.EACCES) && privilegedPort(port):
+    return fmt.Errorf("port %s requires root or CAP_NET_BIND_SERVICE; try -%s 8080: %v", port, flagName, err)
+  case errors.Is(err, syscall.EACCES):
+    return fmt.Errorf("not permitted to listen on port %s; check firewall or security policies: %v", port, err)
+  case errors.Is(err, syscall.EADDRNOTAVAIL):
+    return fmt.Errorf("address for port %s is not available on this host: %v", port, err)
+  }
+  return fmt.Errorf("starting server on port %s: %v", port, err)
+}
+
+// privilegedPort reports whether port is below 1024, which only privileged processes may bind on Unix.
+func privilegedPort(port string) bool {
+  n, err := strconv.Atoi(port)
+  return err == nil && n > 0 && n < 1024
+}
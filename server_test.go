@@ -0,0 +1,442 @@
+package main
+
+import (
+  "context"
+  "errors"
+  "io"
+  "net"
+  "net/netip"
+  "os"
+  "strings"
+  "sync"
+  "sync/atomic"
+  "syscall"
+  "testing"
+  "time"
+)
+
+// startTestServer runs a Server on a loopback port. The returned channel receives Run's result.
+func startTestServer(t *testing.T, workers int) (*Server, string, chan error) {
+  t.Helper()
+
+  listener, err := net.Listen("tcp", "127.0.0.1:0")
+  if err != nil {
+    t.Fatalf("Failed to listen: %v", err)
+  }
+
+  server := NewServer(listener, workers)
+  runErr := make(chan error, 1)
+  go func() { runErr <- server.Run() }()
+
+  t.Cleanup(func() { server.Shutdown(time.Second) })
+  return server, listener.Addr().String(), runErr
+}
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, description string, cond func() bool) {
+  t.Helper()
+  deadline := time.Now().Add(time.Second)
+  for !cond() {
+    if time.Now().After(deadline) {
+      t.Fatalf("Timed out waiting for %s", description)
+    }
+    time.Sleep(5 * time.Millisecond)
+  }
+}
+
+func TestServerServesRequests(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"hello.txt": "hello"})
+  useRoots(t, tempDir)
+
+  server, addr, runErr := startTestServer(t, 2)
+
+  conn, err := net.Dial("tcp", addr)
+  if err != nil {
+    t.Fatalf("Failed to connect: %v", err)
+  }
+  defer conn.Close()
+
+  conn.Write([]byte("GET /hello.txt HTTP/1.1\r\n\r\n"))
+  response, _ := io.ReadAll(conn)
+  if !strings.HasPrefix(string(response), "HTTP/1.1 200 OK") || !strings.HasSuffix(string(response), "hello") {
+    t.Errorf("Unexpected response: %s", response)
+  }
+
+  if err := server.Shutdown(time.Second); err != nil {
+    t.Errorf("Expected a clean shutdown, got: %v", err)
+  }
+  if err := <-runErr; err != nil {
+    t.Errorf("Expected Run to return nil after Shutdown, got: %v", err)
+  }
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+  server, addr, runErr := startTestServer(t, 1)
+
+  // A client that never finishes its request keeps the worker busy until its deadline.
+  conn, err := net.Dial("tcp", addr)
+  if err != nil {
+    t.Fatalf("Failed to connect: %v", err)
+  }
+  defer conn.Close()
+  conn.Write([]byte("GET / HTTP/1.1\r\n"))
+
+  waitFor(t, "the connection to be accepted", func() bool { return server.connCount() == 1 })
+
+  start := time.Now()
+  err = server.Shutdown(50 * time.Millisecond)
+  if err == nil || !strings.Contains(err.Error(), "1 connections") {
+    t.Errorf("Expected a timeout error reporting one connection, got: %v", err)
+  }
+  if elapsed := time.Since(start); elapsed > time.Second {
+    t.Errorf("Shutdown took %v, expected it to be bounded by the timeout", elapsed)
+  }
+  if err := <-runErr; err != nil {
+    t.Errorf("Expected Run to return nil after Shutdown, got: %v", err)
+  }
+
+  waitFor(t, "the forced connection to finish", func() bool { return server.connCount() == 0 })
+}
+
+func TestSetNoDelay(t *testing.T) {
+  listener, err := net.Listen("tcp", "127.0.0.1:0")
+  if err != nil {
+    t.Fatalf("Failed to listen: %v", err)
+  }
+  defer listener.Close()
+
+  client, err := net.Dial("tcp", listener.Addr().String())
+  if err != nil {
+    t.Fatalf("Failed to connect: %v", err)
+  }
+  defer client.Close()
+
+  for _, enabled := range []bool{false, true} {
+    if err := setNoDelay(client, enabled); err != nil {
+      t.Errorf("Expected no error setting TCP_NODELAY=%v, got: %v", enabled, err)
+    }
+  }
+
+  // Connections that are not TCP are skipped without error.
+  pipe, other := net.Pipe()
+  defer pipe.Close()
+  defer other.Close()
+  if err := setNoDelay(pipe, true); err != nil {
+    t.Errorf("Expected non-TCP connections to be ignored, got: %v", err)
+  }
+}
+
+func TestServerExitOnIdle(t *testing.T) {
+  exitOnIdle = 100 * time.Millisecond
+  defer func() { exitOnIdle = 0 }()
+
+  server, addr, runErr := startTestServer(t, 1)
+
+  // A connection before the timeout restarts the idle period.
+  time.Sleep(60 * time.Millisecond)
+  conn, err := net.Dial("tcp", addr)
+  if err != nil {
+    t.Fatalf("Failed to connect: %v", err)
+  }
+  conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+  io.ReadAll(conn)
+  conn.Close()
+  accepted := time.Now()
+
+  select {
+  case err := <-runErr:
+    if err != nil {
+      t.Errorf("Expected Run to return nil after an idle shutdown, got: %v", err)
+    }
+  case <-time.After(2 * time.Second):
+    t.Fatalf("Expected the server to exit after being idle")
+  }
+  if elapsed := time.Since(accepted); elapsed < 50*time.Millisecond {
+    t.Errorf("Expected the idle period to restart on the connection, exited after %v", elapsed)
+  }
+
+  select {
+  case <-server.Done():
+  case <-time.After(time.Second):
+    t.Errorf("Expected Done to be closed after the idle shutdown")
+  }
+}
+
+// deadlineFailConn is a connection whose deadlines cannot be set.
+type deadlineFailConn struct {
+  *mockConn
+  closed atomic.Bool
+}
+
+func (c *deadlineFailConn) SetDeadline(t time.Time) error { return errors.New("deadline not supported") }
+func (c *deadlineFailConn) Close() error                  { c.closed.Store(true); return nil }
+
+// sliceListener hands out the given connections, then blocks until closed.
+type sliceListener struct {
+  conns  chan net.Conn
+  closed chan struct{}
+  once   sync.Once
+}
+
+func newSliceListener(conns ...net.Conn) *sliceListener {
+  l := &sliceListener{conns: make(chan net.Conn, len(conns)), closed: make(chan struct{})}
+  for _, conn := range conns {
+    l.conns <- conn
+  }
+  return l
+}
+
+func (l *sliceListener) Accept() (net.Conn, error) {
+  select {
+  case conn := <-l.conns:
+    return conn, nil
+  case <-l.closed:
+    return nil, net.ErrClosed
+  }
+}
+
+func (l *sliceListener) Close() error   { l.once.Do(func() { close(l.closed) }); return nil }
+func (l *sliceListener) Addr() net.Addr { return &net.TCPAddr{} }
+
+func TestServerClosesConnectionWithoutDeadline(t *testing.T) {
+  conn := &deadlineFailConn{mockConn: newMockConn("GET / HTTP/1.1\r\n\r\n")}
+  server := NewServer(newSliceListener(conn), 1)
+  runErr := make(chan error, 1)
+  go func() { runErr <- server.Run() }()
+
+  waitFor(t, "the connection to be closed", conn.closed.Load)
+  if written := conn.GetWrittenData(); written != "" {
+    t.Errorf("Expected nothing to be served, got: %s", written)
+  }
+  if count := server.connCount(); count != 0 {
+    t.Errorf("Expected no tracked connections, got %d", count)
+  }
+
+  server.Shutdown(time.Second)
+  if err := <-runErr; err != nil {
+    t.Errorf("Expected Run to return nil after Shutdown, got: %v", err)
+  }
+}
+
+func TestBindError(t *testing.T) {
+  inUse := &net.OpError{Op: "listen", Net: "tcp", Err: os.NewSyscallError("bind", syscall.EADDRINUSE)}
+  denied := &net.OpError{Op: "listen", Net: "tcp", Err: os.NewSyscallError("bind", syscall.EACCES)}
+
+  testCases := []struct {
+    name     string
+    port     string
+    flagName string
+    err      error
+    expected string
+  }{
+    {"Address in use", "8080", "p", inUse, "port 8080 is already in use; stop the process using it or pick another port with -p"},
+    {"Privileged port", "80", "p", denied, "port 80 requires root or CAP_NET_BIND_SERVICE; try -p 8080"},
+    {"Privileged TLS port", "443", "tls-port", denied, "port 443 requires root or CAP_NET_BIND_SERVICE; try -tls-port 8080"},
+    {"Denied high port", "8080", "p", denied, "not permitted to listen on port 8080"},
+    {"Other error", "http", "p", errors.New("unknown port"), "starting server on port http: unknown port"},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      if message := bindError(tc.port, tc.flagName, tc.err).Error(); !strings.HasPrefix(message, tc.expected) {
+        t.Errorf("Expected %q, got %q", tc.expected, message)
+      }
+    })
+  }
+
+  // A real conflict is classified too.
+  taken, err := net.Listen("tcp", "127.0.0.1:0")
+  if err != nil {
+    t.Fatalf("Failed to listen: %v", err)
+  }
+  defer taken.Close()
+  _, port, _ := net.SplitHostPort(taken.Addr().String())
+  if _, err := net.Listen("tcp", "127.0.0.1:"+port); err == nil || !strings.Contains(bindError(port, "p", err).Error(), "already in use") {
+    t.Errorf("Expected an in-use error for port %s, got: %v", port, err)
+  }
+}
+
+func TestServerExitAfterConnections(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"a.txt": "content"})
+  useRoots(t, tempDir)
+
+  originalLimit, originalTimeout := exitAfterConnections, shutdownTimeout
+  exitAfterConnections, shutdownTimeout = 3, time.Second
+  defer func() { exitAfterConnections, shutdownTimeout = originalLimit, originalTimeout }()
+
+  server, addr, runErr := startTestServer(t, 2)
+
+  for i := range exitAfterConnections {
+    conn, err := net.Dial("tcp", addr)
+    if err != nil {
+      t.Fatalf("Failed to connect for request %d: %v", i+1, err)
+    }
+    conn.Write([]byte("GET /a.txt HTTP/1.1\r\n\r\n"))
+    response, _ := io.ReadAll(conn)
+    conn.Close()
+    if !strings.HasPrefix(string(response), "HTTP/1.1 200 OK") || !strings.HasSuffix(string(response), "content") {
+      t.Errorf("Expected request %d to be served in full, got: %s", i+1, response)
+    }
+  }
+
+  select {
+  case err := <-runErr:
+    if err != nil {
+      t.Errorf("Expected Run to return nil, got: %v", err)
+    }
+  case <-time.After(2 * time.Second):
+    t.Fatalf("Expected the server to stop after %d connections", exitAfterConnections)
+  }
+  select {
+  case <-server.Done():
+  case <-time.After(time.Second):
+    t.Fatalf("Expected Done to be closed after the shutdown")
+  }
+  if count := server.connCount(); count != 0 {
+    t.Errorf("Expected no connections left open, got %d", count)
+  }
+
+  if _, err := net.Dial("tcp", addr); err == nil {
+    t.Errorf("Expected the listener to be closed")
+  }
+}
+
+func TestServerRunContext(t *testing.T) {
+  listener, err := net.Listen("tcp", "127.0.0.1:0")
+  if err != nil {
+    t.Fatalf("Failed to listen: %v", err)
+  }
+  server := NewServer(listener, 1)
+
+  ctx, cancel := context.WithCancel(context.Background())
+  runErr := make(chan error, 1)
+  go func() { runErr <- server.RunContext(ctx) }()
+  cancel()
+
+  select {
+  case err := <-runErr:
+    if err != nil {
+      t.Errorf("Expected RunContext to return nil after cancellation, got: %v", err)
+    }
+  case <-time.After(2 * time.Second):
+    t.Fatalf("Expected RunContext to return after cancellation")
+  }
+  select {
+  case <-server.Done():
+  case <-time.After(time.Second):
+    t.Errorf("Expected Done to be closed after cancellation")
+  }
+}
+
+func TestServerOverflow(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"a.txt": "content"})
+  useRoots(t, tempDir)
+
+  original := maxQueue
+  maxQueue = 1
+  defer func() { maxQueue = original }()
+
+  server, addr, _ := startTestServer(t, 1)
+  dial := func() net.Conn {
+    t.Helper()
+    conn, err := net.Dial("tcp", addr)
+    if err != nil {
+      t.Fatalf("Failed to connect: %v", err)
+    }
+    return conn
+  }
+
+  // The only worker waits for a request that has not been sent, and a second connection queues.
+  busy := dial()
+  defer busy.Close()
+  waitFor(t, "the worker to take the first connection", func() bool { return activeConnections.Load() == 1 })
+  queued := dial()
+  defer queued.Close()
+  waitFor(t, "the second connection to queue", func() bool { return server.connCount() == 2 })
+
+  before := overflowConnections.Load()
+  overflow := dial()
+  overflow.SetReadDeadline(time.Now().Add(2 * time.Second))
+  response, err := io.ReadAll(overflow)
+  overflow.Close()
+  if err != nil {
+    t.Fatalf("Expected the overflow connection to be answered and closed, got: %v", err)
+  }
+  if !strings.HasPrefix(string(response), "HTTP/1.1 503 Service Unavailable") || !strings.Contains(string(response), "Retry-After: 1\r\n") {
+    t.Errorf("Expected a 503 for the overflow connection, got: %s", response)
+  }
+  if count := overflowConnections.Load() - before; count != 1 {
+    t.Errorf("Expected one overflow connection to be counted, got %d", count)
+  }
+
+  // Once the worker is free, the queued connection is served normally.
+  busy.Write([]byte("GET /a.txt HTTP/1.1\r\n\r\n"))
+  io.ReadAll(busy)
+  queued.Write([]byte("GET /a.txt HTTP/1.1\r\n\r\n"))
+  queued.SetReadDeadline(time.Now().Add(2 * time.Second))
+  if response, _ := io.ReadAll(queued); !strings.HasSuffix(string(response), "content") {
+    t.Errorf("Expected the queued connection to be served, got: %s", response)
+  }
+}
+
+func TestMaxConnsPerIP(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"a.txt": "content"})
+  useRoots(t, tempDir)
+
+  original := maxConnsPerIP
+  maxConnsPerIP = 2
+  defer func() { maxConnsPerIP = original }()
+
+  _, addr, _ := startTestServer(t, 4)
+  dial := func() net.Conn {
+    t.Helper()
+    conn, err := net.Dial("tcp", addr)
+    if err != nil {
+      t.Fatalf("Failed to connect: %v", err)
+    }
+    return conn
+  }
+  localhost := netip.MustParseAddr("127.0.0.1")
+
+  // Two idle connections from 127.0.0.1 use up its allowance, though workers are still free.
+  first := dial()
+  defer first.Close()
+  second := dial()
+  defer second.Close()
+  waitFor(t, "both connections to be counted", func() bool { return connsFrom(localhost) == 2 })
+
+  before := limitedConnections.Load()
+  refused := dial()
+  refused.SetReadDeadline(time.Now().Add(2 * time.Second))
+  response, err := io.ReadAll(refused)
+  refused.Close()
+  if err != nil {
+    t.Fatalf("Expected the third connection to be answered and closed, got: %v", err)
+  }
+  if !strings.HasPrefix(string(response), "HTTP/1.1 429 Too Many Requests") || !strings.Contains(string(response), "Retry-After: 1\r\n") {
+    t.Errorf("Expected a 429 for the third connection, got: %s", response)
+  }
+  if count := limitedConnections.Load() - before; count != 1 {
+    t.Errorf("Expected one limited connection to be counted, got %d", count)
+  }
+
+  // Closing a connection frees its slot for the next one.
+  first.Write([]byte("GET /a.txt HTTP/1.1\r\nConnection: close\r\n\r\n"))
+  io.ReadAll(first)
+  waitFor(t, "the closed connection to be released", func() bool { return connsFrom(localhost) == 1 })
+
+  next := dial()
+  defer next.Close()
+  next.Write([]byte("GET /a.txt HTTP/1.1\r\nConnection: close\r\n\r\n"))
+  next.SetReadDeadline(time.Now().Add(2 * time.Second))
+  if response, _ := io.ReadAll(next); !strings.HasSuffix(string(response), "content") {
+    t.Errorf("Expected a connection within the limit to be served, got: %s", response)
+  }
+
+  second.Close()
+  waitFor(t, "every connection to be released", func() bool { return connsFrom(localhost) == 0 })
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+  "encoding/xml"
+  "errors"
+  "io/fs"
+  "net"
+  "net/url"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+)
+
+// sitemapPath is the URL path answered with a generated sitemap when -sitemap is set
+// and no sitemap.xml file exists in the document roots.
+const sitemapPath = "/sitemap.xml"
+
+var sitemapEnabled bool
+
+// sitemapEntry is one servable file: its URL path relative to the roots and its modification time.
+type sitemapEntry struct {
+  path    string
+  modTime time.Time
+}
+
+// sitemapCache keeps the result of the last walk together with the modification times of every
+// directory and ignore file it saw. The walk is redone once any of them changes, so adding,
+// removing or renaming files, or editing an ignore file, invalidates it.
+type sitemapCache struct {
+  mu      sync.Mutex
+  entries []sitemapEntry
+  stamps  map[string]time.Time
+}
+
+var sitemap sitemapCache
+
+// get returns the cached entries, walking the roots again when they are stale.
+func (c *sitemapCache) get() ([]sitemapEntry, error) {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+
+  if c.stamps != nil && !stampsChanged(c.stamps) {
+    return c.entries, nil
+  }
+
+  entries, stamps, err := walkSitemap()
+  if err != nil {
+    return nil, err
+  }
+  c.entries, c.stamps = entries, stamps
+  return entries, nil
+}
+
+// modTime returns the modification time of name, or the zero time if it does not exist.
+func modTime(name string) time.Time {
+  info, err := os.Stat(name)
+  if err != nil {
+    return time.Time{}
+  }
+  return info.ModTime()
+}
+
+func stampsChanged(stamps map[string]time.Time) bool {
+  for name, stamp := range stamps {
+    if !modTime(name).Equal(stamp) {
+      return true
+    }
+  }
+  return false
+}
+
+// walkSitemap collects the files of all roots, the first root providing a path winning.
+// Dot files, entries hidden by ignore files and directories protected by an auth file are left
+// out.
+func walkSitemap() ([]sitemapEntry, map[string]time.Time, error) {
+  var entries []sitemapEntry
+  stamps := make(map[string]time.Time)
+  seen := make(map[string]bool)
+  ignored := ignoreCache{}
+
+  for _, root := range roots {
+    stamps[root] = modTime(root)
+
+    err := filepath.WalkDir(root, func(fullPath string, d fs.DirEntry, err error) error {
+      if err != nil {
+        if fullPath == root && errors.Is(err, fs.ErrNotExist) {
+          return nil
+        }
+        return err
+      }
+
+      rel, _ := filepath.Rel(root, fullPath)
+      urlPath := urlPathOf(rel)
+
+      if fullPath != root && (strings.HasPrefix(d.Name(), ".") || ignored.pathIgnored(root, urlPath)) {
+        if d.IsDir() {
+          return filepath.SkipDir
+        }
+        return nil
+      }
+
+      if d.IsDir() {
+        stamps[fullPath] = modTime(fullPath)
+        if authFileFor(urlPath) != "" {
+          return filepath.SkipDir
+        }
+        ignoreFile := filepath.Join(fullPath, ignoreFileName)
+        stamps[ignoreFile] = modTime(ignoreFile)
+        return nil
+      }
+
+      if seen[urlPath] {
+        return nil
+      }
+      seen[urlPath] = true
+
+      info, err := d.Info()
+      if err != nil {
+        return nil
+      }
+      entries = append(entries, sitemapEntry{path: urlPath, modTime: info.ModTime()})
+      return nil
+    })
+    if err != nil {
+      return nil, nil, err
+    }
+  }
+
+  return entries, stamps, nil
+}
+
+type sitemapURLSet struct {
+  XMLName xml.Name     `xml:"urlset"`
+  Xmlns   string       `xml:"xmlns,attr"`
+  URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+  Loc     string `xml:"loc"`
+  LastMod string `xml:"lastmod"`
+}
+
+// renderSitemap encodes entries as a sitemap document. Locations are made absolute with baseURL.
+func renderSitemap(baseURL string, entries []sitemapEntry) ([]byte, error) {
+  set := sitemapURLSet{Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+  for _, entry := range entries {
+    loc := baseURL + (&url.URL{Path: entry.path}).EscapedPath()
+    set.URLs = append(set.URLs, sitemapURL{Loc: loc, LastMod: entry.modTime.UTC().Format(time.RFC3339)})
+  }
+
+  body, err := xml.MarshalIndent(set, "", "  ")
+  if err != nil {
+    return nil, err
+  }
+  return append([]byte(xml.Header), body...), nil
+}
+
+// sendSitemap answers req with the generated sitemap of the document roots.
+func sendSitemap(conn net.Conn, req *request) {
+
+  entries, err := sitemap.get()
+  if err != nil {
+    sendFSError(conn, err)
+    return
+  }
+
+  // Locations are built from the Host header; without one they stay relative.
+  baseURL := ""
+  if host := req.header("Host"); host != "" {
+    baseURL = requestScheme(conn, req) + "://" + host
+  }
+
+  body, err := renderSitemap(baseURL+strings.TrimSuffix(req.prefix, "/"), entries)
+  if err != nil {
+    sendError(conn, 500, "Internal Server Error")
+    return
+  }
+
+  header := responseHeader{}
+  header.set("Content-Type", "application/xml")
+  header.set("Content-Length", strconv.Itoa(len(body)))
+  writeResponseHeader(conn, 200, "OK", header)
+  conn.Write(body)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+  "encoding/xml"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+  "time"
+)
+
+// useSitemap enables -sitemap with an empty cache for the duration of the test.
+func useSitemap(t *testing.T) {
+  t.Helper()
+  sitemapEnabled = true
+  sitemap = sitemapCache{}
+  t.Cleanup(func() {
+    sitemapEnabled = false
+    sitemap = sitemapCache{}
+  })
+}
+
+func TestSitemap(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "index.html":         "home",
+    "docs/a b.html":      "doc",
+    "docs/notes.draft":   "draft",
+    "docs/.ghttpdignore": "*.draft\n",
+    ".secret":            "hidden",
+  })
+  useRoots(t, tempDir)
+  useSitemap(t)
+
+  conn := newMockConn("GET /sitemap.xml HTTP/1.1\r\nHost: example.com\r\n\r\n")
+  handleConnection(conn)
+
+  response := conn.GetWrittenData()
+  headers, body, _ := strings.Cut(response, "\r\n\r\n")
+  if !strings.HasPrefix(headers, "HTTP/1.1 200 OK") || !strings.Contains(headers, "Content-Type: application/xml") {
+    t.Fatalf("Expected an XML response, got: %s", headers)
+  }
+
+  var set sitemapURLSet
+  if err := xml.Unmarshal([]byte(body), &set); err != nil {
+    t.Fatalf("Expected well-formed XML, got %v: %s", err, body)
+  }
+
+  var locs []string
+  for _, u := range set.URLs {
+    locs = append(locs, u.Loc)
+    if _, err := time.Parse(time.RFC3339, u.LastMod); err != nil {
+      t.Errorf("Expected an RFC 3339 lastmod for %s, got %q", u.Loc, u.LastMod)
+    }
+  }
+  expected := "http://example.com/docs/a%20b.html,http://example.com/index.html"
+  if got := strings.Join(locs, ","); got != expected {
+    t.Errorf("Expected locations %s, got %s", expected, got)
+  }
+}
+
+func TestSitemapInvalidation(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"a.html": "a"})
+  useRoots(t, tempDir)
+  useSitemap(t)
+
+  if entries, err := sitemap.get(); err != nil || len(entries) != 1 {
+    t.Fatalf("Expected one entry, got %v (%v)", entries, err)
+  }
+
+  if err := os.WriteFile(filepath.Join(tempDir, "b.html"), []byte("b"), 0644); err != nil {
+    t.Fatalf("Failed to write file: %v", err)
+  }
+  // Make sure the directory's modification time moves even on coarse-grained file systems.
+  later := time.Now().Add(time.Minute)
+  os.Chtimes(tempDir, later, later)
+
+  if entries, err := sitemap.get(); err != nil || len(entries) != 2 {
+    t.Errorf("Expected the new file to invalidate the cache, got %v (%v)", entries, err)
+  }
+}
+
+func TestSitemapPrefersFile(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"sitemap.xml": "<custom/>"})
+  useRoots(t, tempDir)
+  useSitemap(t)
+
+  conn := newMockConn("GET /sitemap.xml HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+
+  if response := conn.GetWrittenData(); !strings.HasSuffix(response, "<custom/>") {
+    t.Errorf("Expected the existing sitemap.xml to be served, got: %s", response)
+  }
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+  "io"
+  "math/rand/v2"
+  "net"
+  "strconv"
+)
+
+// speedtestPath streams generated bytes for clients to measure download throughput.
+const speedtestPath = "/__speedtest"
+
+// speedtestMax caps the ?size a /__speedtest request may ask for; 0 disables the endpoint.
+var speedtestMax byteSize
+
+// speedtestDefault is the size sent when a request gives none, bounded by speedtestMax.
+const speedtestDefault = 1 << 20
+
+// zeroReader reads an endless stream of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+  clear(p)
+  return len(p), nil
+}
+
+// sendSpeedtest answers /__speedtest?size=10MB with that many zero bytes, or pseudo-random bytes
+// with ?random, which compressing proxies cannot shrink. Unlike the other internal endpoints it
+// is refused during maintenance, and its bytes count toward -quota.
+func sendSpeedtest(conn net.Conn, req *request) {
+  if inMaintenance() {
+    sendMaintenance(conn)
+    return
+  }
+  if exceeded, retryAfter := quotaExceeded(); exceeded {
+    sendQuotaExceeded(conn, retryAfter)
+    return
+  }
+
+  size := min(int64(speedtestDefault), int64(speedtestMax))
+  if value := req.query.Get("size"); value != "" {
+    requested, err := parseByteSize(value)
+    if err != nil || requested < 0 || requested > int64(speedtestMax) {
+      sendError(conn, 400, "Bad Request")
+      return
+    }
+    size = requested
+  }
+
+  var source io.Reader = zeroReader{}
+  if req.query.Has("random") {
+    source = rand.NewChaCha8([32]byte{})
+  }
+
+  header := responseHeader{}
+  header.set("Content-Type", "application/octet-stream")
+  header.set("Content-Length", strconv.FormatInt(size, 10))
+  header.set("Cache-Control", "no-store")
+  writeResponseHeader(conn, 200, "OK", header)
+  if req.method != "HEAD" {
+    copyN(conn, source, size)
+  }
+}
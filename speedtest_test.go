@@ -0,0 +1,62 @@
+package main
+
+import (
+  "bytes"
+  "strings"
+  "testing"
+)
+
+func TestSpeedtest(t *testing.T) {
+  originalMax := speedtestMax
+  speedtestMax = 64 << 10
+  defer func() { speedtestMax = originalMax }()
+
+  testCases := []struct {
+    name         string
+    request      string
+    expectedCode string
+    expectedSize int
+    random       bool
+  }{
+    {"Requested size", "GET /__speedtest?size=5000 HTTP/1.1\r\n\r\n", "HTTP/1.1 200 OK", 5000, false},
+    {"Size with unit", "GET /__speedtest?size=40KB HTTP/1.1\r\n\r\n", "HTTP/1.1 200 OK", 40 << 10, false},
+    {"Default capped", "GET /__speedtest HTTP/1.1\r\n\r\n", "HTTP/1.1 200 OK", 64 << 10, false},
+    {"Random bytes", "GET /__speedtest?size=4096&random HTTP/1.1\r\n\r\n", "HTTP/1.1 200 OK", 4096, true},
+    {"Over the cap", "GET /__speedtest?size=1MB HTTP/1.1\r\n\r\n", "HTTP/1.1 400 Bad Request", -1, false},
+    {"Invalid size", "GET /__speedtest?size=lots HTTP/1.1\r\n\r\n", "HTTP/1.1 400 Bad Request", -1, false},
+    {"HEAD", "HEAD /__speedtest?size=5000 HTTP/1.1\r\n\r\n", "HTTP/1.1 200 OK", 0, false},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn(tc.request)
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.HasPrefix(response, tc.expectedCode) {
+        t.Fatalf("Expected %s, got: %.200s", tc.expectedCode, response)
+      }
+      if tc.expectedSize < 0 {
+        return
+      }
+      _, body, _ := strings.Cut(response, "\r\n\r\n")
+      if len(body) != tc.expectedSize {
+        t.Errorf("Expected %d bytes, got %d", tc.expectedSize, len(body))
+      }
+      zeros := bytes.Count([]byte(body), []byte{0})
+      if !tc.random && zeros != len(body) {
+        t.Errorf("Expected only zero bytes, got %d of %d", zeros, len(body))
+      }
+      if tc.random && zeros == len(body) {
+        t.Errorf("Expected random bytes, got zeros")
+      }
+    })
+  }
+
+  speedtestMax = 0
+  conn := newMockConn("GET /__speedtest?size=10 HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+  if response := conn.GetWrittenData(); !strings.HasPrefix(response, "HTTP/1.1 404 Not Found") {
+    t.Errorf("Expected 404 when disabled, got: %.200s", response)
+  }
+}
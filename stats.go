@@ -0,0 +1,99 @@
+package main
+
+import (
+  "container/list"
+  "encoding/json"
+  "net"
+  "sort"
+  "strconv"
+  "sync"
+)
+
+// statsPaths is the number of request paths whose hits are counted for /stats; 0 disables it.
+var statsPaths int
+
+// defaultStatsTop is the number of paths /stats reports unless ?top= asks for another number.
+const defaultStatsTop = 10
+
+// pathCount is the hit count of one request path.
+type pathCount struct {
+  Path string `json:"path"`
+  Hits int64  `json:"hits"`
+}
+
+// pathCounter counts hits per path. Memory is bounded: once max paths are tracked, the least
+// recently requested one is dropped to make room for a new path.
+type pathCounter struct {
+  mu      sync.Mutex
+  max     int
+  order   *list.List
+  entries map[string]*list.Element
+}
+
+func newPathCounter(max int) *pathCounter {
+  return &pathCounter{max: max, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// pathHits is set up by main when -stats-paths is given.
+var pathHits *pathCounter
+
+func (c *pathCounter) record(urlPath string) {
+  if c == nil {
+    return
+  }
+  c.mu.Lock()
+  defer c.mu.Unlock()
+
+  if element, ok := c.entries[urlPath]; ok {
+    element.Value.(*pathCount).Hits++
+    c.order.MoveToFront(element)
+    return
+  }
+  c.entries[urlPath] = c.order.PushFront(&pathCount{Path: urlPath, Hits: 1})
+  if c.order.Len() > c.max {
+    oldest := c.order.Back()
+    c.order.Remove(oldest)
+    delete(c.entries, oldest.Value.(*pathCount).Path)
+  }
+}
+
+// top returns the n most requested paths, most hits first and ties in path order.
+func (c *pathCounter) top(n int) []pathCount {
+  c.mu.Lock()
+  counts := make([]pathCount, 0, c.order.Len())
+  for element := c.order.Front(); element != nil; element = element.Next() {
+    counts = append(counts, *element.Value.(*pathCount))
+  }
+  c.mu.Unlock()
+
+  sort.Slice(counts, func(i, j int) bool {
+    if counts[i].Hits != counts[j].Hits {
+      return counts[i].Hits > counts[j].Hits
+    }
+    return counts[i].Path < counts[j].Path
+  })
+  if n < len(counts) {
+    counts = counts[:n]
+  }
+  return counts
+}
+
+// sendStats answers /stats with the most requested paths as JSON.
+func sendStats(conn net.Conn, req *request) {
+  n := defaultStatsTop
+  if value := req.query.Get("top"); value != "" {
+    parsed, err := strconv.Atoi(value)
+    if err != nil || parsed < 1 {
+      sendError(conn, 400, "Bad Request")
+      return
+    }
+    n = parsed
+  }
+
+  body, err := json.Marshal(pathHits.top(n))
+  if err != nil {
+    sendError(conn, 500, "Internal Server Error")
+    return
+  }
+  sendText(conn, 200, "OK", "application/json", string(body))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+  "encoding/json"
+  "reflect"
+  "strings"
+  "testing"
+)
+
+func usePathHits(t *testing.T, max int) {
+  original := pathHits
+  pathHits = newPathCounter(max)
+  t.Cleanup(func() { pathHits = original })
+}
+
+func TestStatsEndpoint(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"a.txt": "a", "b.txt": "b"})
+  useRoots(t, tempDir)
+  usePathHits(t, 100)
+
+  for _, target := range []string{"/a.txt", "/b.txt", "/a.txt", "/missing", "/a.txt", "/b.txt"} {
+    handleConnection(newMockConn("GET " + target + " HTTP/1.1\r\n\r\n"))
+  }
+
+  conn := newMockConn("GET /stats?top=2 HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+  headers, body, _ := strings.Cut(conn.GetWrittenData(), "\r\n\r\n")
+
+  if !strings.HasPrefix(headers, "HTTP/1.1 200 OK") || !strings.Contains(headers, "Content-Type: application/json") {
+    t.Fatalf("Expected a JSON response, got: %s", headers)
+  }
+  var counts []pathCount
+  if err := json.Unmarshal([]byte(body), &counts); err != nil {
+    t.Fatalf("Expected JSON, got %q: %v", body, err)
+  }
+  expected := []pathCount{{Path: "/a.txt", Hits: 3}, {Path: "/b.txt", Hits: 2}}
+  if !reflect.DeepEqual(counts, expected) {
+    t.Errorf("Expected %v, got %v", expected, counts)
+  }
+}
+
+func TestPathCounterEvictsLeastRecent(t *testing.T) {
+  counter := newPathCounter(2)
+  for _, urlPath := range []string{"/a", "/a", "/b", "/a", "/c"} {
+    counter.record(urlPath)
+  }
+
+  expected := []pathCount{{Path: "/a", Hits: 3}, {Path: "/c", Hits: 1}}
+  if counts := counter.top(10); !reflect.DeepEqual(counts, expected) {
+    t.Errorf("Expected %v, got %v", expected, counts)
+  }
+}
+
+func TestStatsDisabled(t *testing.T) {
+  useRoots(t, t.TempDir())
+  original := pathHits
+  pathHits = nil
+  defer func() { pathHits = original }()
+
+  conn := newMockConn("GET /stats HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+  if response := conn.GetWrittenData(); !strings.HasPrefix(response, "HTTP/1.1 404") {
+    t.Errorf("Expected 404 without -stats-paths, got: %s", response)
+  }
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+  "fmt"
+  "os"
+  "strings"
+)
+
+// listingTheme selects built-in CSS for HTML listings: "" leaves them unstyled, "light" and
+// "dark" pick a theme. listingCSSFile adds operator CSS after the theme, so it can override it.
+var (
+  listingTheme   string
+  listingCSSFile string
+  listingCSS     string
+)
+
+// baseTheme lays out the page; the light and dark themes only set colours on top of it.
+const baseTheme = `body{font-family:system-ui,sans-serif;max-width:60em;margin:2em auto;padding:0 1em;line-height:1.5}` +
+  `h1{font-size:1.4em;font-weight:600}nav{margin-bottom:1em}ul{list-style:none;padding:0}` +
+  `li{padding:.25em .5em;border-bottom:1px solid var(--rule)}a{text-decoration:none;color:var(--link)}a:hover{text-decoration:underline}`
+
+var listingThemes = map[string]string{
+  "light": `:root{--rule:#e5e5e5;--link:#0550ae}body{background:#fff;color:#1f2328}` + baseTheme,
+  "dark":  `:root{--rule:#30363d;--link:#58a6ff}body{background:#0d1117;color:#e6edf3}` + baseTheme,
+}
+
+// loadListingStyle validates -listing-theme and combines it with the -listing-css file into the
+// stylesheet embedded in listing pages.
+func loadListingStyle() error {
+  var style strings.Builder
+  if listingTheme != "" {
+    theme, ok := listingThemes[listingTheme]
+    if !ok {
+      return fmt.Errorf("unknown listing theme %q (expected light or dark)", listingTheme)
+    }
+    style.WriteString(theme)
+  }
+  if listingCSSFile != "" {
+    data, err := os.ReadFile(listingCSSFile)
+    if err != nil {
+      return fmt.Errorf("reading listing CSS: %v", err)
+    }
+    style.Write(data)
+  }
+  listingCSS = style.String()
+  return nil
+}
+
+// listingStyle returns the <style> element for listing pages, or "" when they are unstyled.
+// A closing tag inside the CSS would end the element early, so it is escaped.
+func listingStyle() string {
+  if listingCSS == "" {
+    return ""
+  }
+  return "<style>" + strings.ReplaceAll(listingCSS, "</", `<\/`) + "</style>"
+}
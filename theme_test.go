@@ -0,0 +1,63 @@
+package main
+
+import (
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+func TestListingTheme(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"a.txt": "a"})
+  useRoots(t, tempDir)
+
+  cssFile := filepath.Join(t.TempDir(), "site.css")
+  if err := os.WriteFile(cssFile, []byte("h1{color:rebeccapurple}</style><script>"), 0644); err != nil {
+    t.Fatalf("Failed to write CSS: %v", err)
+  }
+
+  originalTheme, originalFile, originalCSS := listingTheme, listingCSSFile, listingCSS
+  defer func() { listingTheme, listingCSSFile, listingCSS = originalTheme, originalFile, originalCSS }()
+
+  testCases := []struct {
+    name       string
+    theme      string
+    cssFile    string
+    expected   []string
+    unexpected []string
+  }{
+    {"Unstyled", "", "", []string{"<head><title>Directory Listing</title></head>"}, []string{"<style>"}},
+    {"Light", "light", "", []string{"<style>:root{--rule:#e5e5e5", "background:#fff"}, []string{"#0d1117"}},
+    {"Dark", "dark", "", []string{"<style>:root{--rule:#30363d", "background:#0d1117"}, []string{"background:#fff"}},
+    {"Theme and custom CSS", "dark", cssFile, []string{"background:#0d1117", `h1{color:rebeccapurple}<\/style><script></style></head>`}, []string{"rebeccapurple}</style><script>"}},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      listingTheme, listingCSSFile = tc.theme, tc.cssFile
+      if err := loadListingStyle(); err != nil {
+        t.Fatalf("Failed to load listing style: %v", err)
+      }
+
+      conn := newMockConn("GET / HTTP/1.1\r\n\r\n")
+      handleConnection(conn)
+      response := conn.GetWrittenData()
+      for _, marker := range tc.expected {
+        if !strings.Contains(response, marker) {
+          t.Errorf("Expected %q in the listing, got: %s", marker, response)
+        }
+      }
+      for _, marker := range tc.unexpected {
+        if strings.Contains(response, marker) {
+          t.Errorf("Expected no %q in the listing, got: %s", marker, response)
+        }
+      }
+    })
+  }
+
+  listingTheme, listingCSSFile = "sepia", ""
+  if err := loadListingStyle(); err == nil {
+    t.Errorf("Expected an error for an unknown theme")
+  }
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+  "crypto/tls"
+  "errors"
+  "fmt"
+  "net"
+  "net/url"
+)
+
+// tlsPort, when set together with a certificate, adds an HTTPS listener on this port while -p
+// keeps serving plaintext. redirectHTTPS then answers every plaintext request with a redirect.
+var (
+  tlsPort       string
+  redirectHTTPS bool
+)
+
+// loadTLSConfig builds the server TLS configuration from a PEM encoded certificate and key pair.
+func loadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+  if certFile == "" || keyFile == "" {
+    return nil, fmt.Errorf("both -tls-cert and -tls-key are required to enable TLS")
+  }
+
+  cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+  if err != nil {
+    return nil, fmt.Errorf("loading TLS key pair: %v", err)
+  }
+
+  return &tls.Config{
+    Certificates: []tls.Certificate{cert},
+    MinVersion:   tls.VersionTLS12,
+  }, nil
+}
+
+// tlsParams returns the negotiated TLS version and cipher suite of conn.
+// ok is false for plaintext connections or when the handshake has not completed yet.
+func tlsParams(conn net.Conn) (version string, cipher string, ok bool) {
+  tlsConn, isTLS := unwrapConn(conn).(*tls.Conn)
+  if !isTLS {
+    return "", "", false
+  }
+
+  state := tlsConn.ConnectionState()
+  if !state.HandshakeComplete {
+    return "", "", false
+  }
+
+  return tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite), true
+}
+
+// httpsLocation returns the https:// URL of req on the -tls-port listener, or "" when the request
+// carries no Host to build it from. Without -tls-port, HTTPS is terminated by a proxy answering
+// on the same host and port.
+func httpsLocation(req *request) string {
+  host := req.header("Host")
+  if host == "" {
+    return ""
+  }
+  if tlsPort != "" {
+    if name, _, err := net.SplitHostPort(host); err == nil {
+      host = name
+    }
+    if tlsPort != "443" {
+      host = net.JoinHostPort(host, tlsPort)
+    }
+  }
+  target := url.URL{Scheme: "https", Host: host, Path: req.prefix + req.path, RawQuery: req.rawQuery}
+  return target.String()
+}
+
+// sendHTTPSRedirect moves a plaintext request to the HTTPS listener.
+func sendHTTPSRedirect(conn net.Conn, req *request) {
+  location := httpsLocation(req)
+  if location == "" {
+    sendError(conn, 400, "Bad Request")
+    return
+  }
+  header := responseHeader{}
+  header.set("Location", location)
+  header.set("Content-Length", "0")
+  writeResponseHeader(conn, 301, "Moved Permanently", header)
+}
+
+// plaintextOnTLS is sent, without encryption, to clients speaking plain HTTP to a TLS listener.
+const plaintextOnTLS = "This is an HTTPS port: use https:// to reach it.\n"
+
+// handshake completes the TLS handshake of a TLS connection before its first request is read and
+// reports whether the connection can be served. A client sending plain HTTP instead gets a
+// readable plaintext 400 rather than a failed handshake.
+func handshake(conn net.Conn) bool {
+  tlsConn, isTLS := conn.(*tls.Conn)
+  if !isTLS {
+    return true
+  }
+
+  err := tlsConn.Handshake()
+  if err == nil {
+    return true
+  }
+
+  var recordErr tls.RecordHeaderError
+  if errors.As(err, &recordErr) && recordErr.Conn != nil && looksLikeHTTP(recordErr.RecordHeader[:]) {
+    debugf("Plain HTTP request from %v on a TLS listener", conn.RemoteAddr())
+    fmt.Fprintf(recordErr.Conn, "HTTP/1.1 400 Bad Request\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s", len(plaintextOnTLS), plaintextOnTLS)
+    return false
+  }
+
+  debugf("TLS handshake with %v failed: %v", conn.RemoteAddr(), err)
+  return false
+}
+
+// looksLikeHTTP reports whether the first bytes received, which a TLS client would start with a
+// handshake record, read like the method and start of an HTTP request line instead.
+func looksLikeHTTP(head []byte) bool {
+  for _, c := range head {
+    if (c < 'A' || c > 'Z') && c != ' ' && c != '/' {
+      return false
+    }
+  }
+  return len(head) > 0 && head[0] != ' '
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+  "crypto/ecdsa"
+  "crypto/elliptic"
+  "crypto/rand"
+  "crypto/tls"
+  "crypto/x509"
+  "crypto/x509/pkix"
+  "io"
+  "math/big"
+  "net"
+  "strings"
+  "testing"
+  "time"
+)
+
+// newTestCertificate generates a self-signed certificate for localhost.
+func newTestCertificate(t *testing.T) tls.Certificate {
+  t.Helper()
+
+  key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+  if err != nil {
+    t.Fatalf("Failed to generate key: %v", err)
+  }
+
+  template := &x509.Certificate{
+    SerialNumber: big.NewInt(1),
+    Subject:      pkix.Name{CommonName: "localhost"},
+    DNSNames:     []string{"localhost"},
+    NotBefore:    time.Now().Add(-time.Hour),
+    NotAfter:     time.Now().Add(time.Hour),
+  }
+
+  der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+  if err != nil {
+    t.Fatalf("Failed to create certificate: %v", err)
+  }
+
+  return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// newTLSPair returns both ends of an in-memory TLS connection after a completed handshake.
+func newTLSPair(t *testing.T) (*tls.Conn, *tls.Conn) {
+  t.Helper()
+
+  serverRaw, clientRaw := net.Pipe()
+  server := tls.Server(serverRaw, &tls.Config{Certificates: []tls.Certificate{newTestCertificate(t)}})
+  client := tls.Client(clientRaw, &tls.Config{InsecureSkipVerify: true})
+
+  errs := make(chan error, 1)
+  go func() { errs <- client.Handshake() }()
+
+  if err := server.Handshake(); err != nil {
+    t.Fatalf("Server handshake failed: %v", err)
+  }
+  if err := <-errs; err != nil {
+    t.Fatalf("Client handshake failed: %v", err)
+  }
+
+  // Closing the raw pipe avoids blocking on close_notify alerts nobody reads.
+  t.Cleanup(func() {
+    serverRaw.Close()
+    clientRaw.Close()
+  })
+  return server, client
+}
+
+func TestTLSParams(t *testing.T) {
+  server, _ := newTLSPair(t)
+
+  version, cipher, ok := tlsParams(server)
+  if !ok {
+    t.Fatalf("Expected TLS parameters for a TLS connection")
+  }
+  if version != "TLS 1.3" {
+    t.Errorf("Expected TLS 1.3, got %s", version)
+  }
+  if cipher == "" {
+    t.Errorf("Expected a cipher suite name")
+  }
+
+  if _, _, ok := tlsParams(newMockConn("")); ok {
+    t.Errorf("Expected no TLS parameters for a plaintext connection")
+  }
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"docs/page.html": "secure page"})
+  useRoots(t, tempDir)
+
+  plain, err := net.Listen("tcp", "127.0.0.1:0")
+  if err != nil {
+    t.Fatalf("Failed to listen: %v", err)
+  }
+  rawTLS, err := net.Listen("tcp", "127.0.0.1:0")
+  if err != nil {
+    t.Fatalf("Failed to listen: %v", err)
+  }
+  _, securePort, _ := net.SplitHostPort(rawTLS.Addr().String())
+
+  originalPort, originalRedirect := tlsPort, redirectHTTPS
+  tlsPort, redirectHTTPS = securePort, true
+  defer func() { tlsPort, redirectHTTPS = originalPort, originalRedirect }()
+
+  server := NewServer(plain, 2)
+  server.AddListener(tls.NewListener(rawTLS, &tls.Config{Certificates: []tls.Certificate{newTestCertificate(t)}}))
+  go server.Run()
+  defer server.Shutdown(time.Second)
+
+  request := "GET /docs/page.html?lang=en&x=%2F HTTP/1.1\r\nHost: localhost:8080\r\n\r\n"
+
+  conn, err := net.Dial("tcp", plain.Addr().String())
+  if err != nil {
+    t.Fatalf("Failed to connect: %v", err)
+  }
+  conn.Write([]byte(request))
+  response, _ := io.ReadAll(conn)
+  conn.Close()
+
+  expectedLocation := "Location: https://localhost:" + securePort + "/docs/page.html?lang=en&x=%2F\r\n"
+  if !strings.HasPrefix(string(response), "HTTP/1.1 301 Moved Permanently") || !strings.Contains(string(response), expectedLocation) {
+    t.Errorf("Expected a redirect with %q, got: %s", expectedLocation, response)
+  }
+
+  secure, err := tls.Dial("tcp", rawTLS.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+  if err != nil {
+    t.Fatalf("Failed to connect over TLS: %v", err)
+  }
+  secure.Write([]byte(request))
+  response, _ = io.ReadAll(secure)
+  secure.Close()
+
+  if !strings.HasPrefix(string(response), "HTTP/1.1 200 OK") || !strings.HasSuffix(string(response), "secure page") {
+    t.Errorf("Expected the page over HTTPS, got: %s", response)
+  }
+}
+
+func TestPlaintextOnTLSListener(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"index.html": "secure page"})
+  useRoots(t, tempDir)
+
+  raw, err := net.Listen("tcp", "127.0.0.1:0")
+  if err != nil {
+    t.Fatalf("Failed to listen: %v", err)
+  }
+  server := NewServer(tls.NewListener(raw, &tls.Config{Certificates: []tls.Certificate{newTestCertificate(t)}}), 2)
+  go server.Run()
+  defer server.Shutdown(time.Second)
+
+  conn, err := net.Dial("tcp", raw.Addr().String())
+  if err != nil {
+    t.Fatalf("Failed to connect: %v", err)
+  }
+  conn.Write([]byte("GET /index.html HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+  response, _ := io.ReadAll(conn)
+  conn.Close()
+
+  if !strings.HasPrefix(string(response), "HTTP/1.1 400 Bad Request\r\n") || !strings.HasSuffix(string(response), "\r\n\r\n"+plaintextOnTLS) {
+    t.Errorf("Expected a plaintext explanation, got: %q", response)
+  }
+
+  // TLS clients are unaffected.
+  secure, err := tls.Dial("tcp", raw.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+  if err != nil {
+    t.Fatalf("Failed to connect over TLS: %v", err)
+  }
+  secure.Write([]byte("GET /index.html HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+  response, _ = io.ReadAll(secure)
+  secure.Close()
+
+  if !strings.HasPrefix(string(response), "HTTP/1.1 200 OK") || !strings.HasSuffix(string(response), "secure page") {
+    t.Errorf("Expected the page over HTTPS, got: %s", response)
+  }
+
+  for _, head := range []string{"GET /", "HEAD ", "PROPF"} {
+    if !looksLikeHTTP([]byte(head)) {
+      t.Errorf("Expected %q to look like HTTP", head)
+    }
+  }
+  if looksLikeHTTP([]byte{0x16, 0x03, 0x01, 0x00, 0xc8}) {
+    t.Errorf("Expected a TLS record header not to look like HTTP")
+  }
+}
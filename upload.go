@@ -0,0 +1,116 @@
+package main
+
+import (
+  "errors"
+  "io"
+  "io/fs"
+  "log"
+  "net"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// uploadsEnabled lets PUT requests store files under the first document root, or the directory of
+// the -mount they fall under unless it is read-only. maxUploadSize bounds the body; larger uploads
+// are refused with 413 before anything is written.
+var (
+  uploadsEnabled bool
+  maxUploadSize  = byteSize(100 << 20)
+)
+
+// deadlineReader renews the connection deadline before every read, so a long upload is bounded by
+// how long the client stays silent rather than by its total duration.
+type deadlineReader struct {
+  conn net.Conn
+  r    io.Reader
+}
+
+func (d *deadlineReader) Read(p []byte) (int, error) {
+  d.conn.SetReadDeadline(time.Now().Add(requestTimeout))
+  return d.r.Read(p)
+}
+
+// handleUpload stores the body of a PUT request at the request path. The body is streamed into a
+// temporary file next to the target, which is renamed over it only once complete, so a failed or
+// truncated upload never leaves a partial file behind.
+func handleUpload(conn net.Conn, req *request) {
+  if activeArchive != nil || strings.HasSuffix(req.path, "/") {
+    sendErrorWithHeader(conn, 405, "Method Not Allowed", responseHeader{{name: "Allow", value: "GET, HEAD"}})
+    return
+  }
+  if req.header("Transfer-Encoding") != "" {
+    sendError(conn, 501, "Not Implemented")
+    return
+  }
+  length, err := strconv.ParseInt(strings.TrimSpace(req.header("Content-Length")), 10, 64)
+  if err != nil || length < 0 {
+    sendError(conn, 411, "Length Required")
+    return
+  }
+  if length > int64(maxUploadSize) {
+    sendError(conn, 413, "Content Too Large")
+    return
+  }
+
+  root, urlPath := roots[0], req.path
+  if m, rest := mounts.match(req.path); m != nil {
+    if m.readOnly {
+      sendError(conn, 403, "Forbidden")
+      return
+    }
+    root, urlPath = m.dir, rest
+  }
+
+  target := resolvePath(root, urlPath)
+  if pathIgnored(root, cleanURLPath(urlPath)) {
+    sendError(conn, 403, "Forbidden")
+    return
+  }
+  info, statErr := os.Stat(target)
+  if statErr == nil && !info.Mode().IsRegular() {
+    sendError(conn, 409, "Conflict")
+    return
+  }
+  created := errors.Is(statErr, fs.ErrNotExist)
+
+  temp, err := os.CreateTemp(filepath.Dir(target), ".ghttpd-upload-*")
+  if errors.Is(err, fs.ErrNotExist) {
+    sendError(conn, 409, "Conflict")
+    return
+  } else if err != nil {
+    sendFSError(conn, err)
+    return
+  }
+  defer os.Remove(temp.Name())
+
+  written, err := io.Copy(temp, io.LimitReader(&deadlineReader{conn: conn, r: req.body}, length))
+  if closeErr := temp.Close(); err == nil {
+    err = closeErr
+  }
+  if err == nil && written < length {
+    err = io.ErrUnexpectedEOF
+  }
+  if err != nil {
+    log.Printf("Error: upload of %s failed after %d of %d bytes: %v", req.path, written, length, err)
+    sendError(conn, 400, "Bad Request")
+    return
+  }
+
+  if err := os.Chmod(temp.Name(), 0644); err != nil {
+    sendFSError(conn, err)
+    return
+  }
+  if err := os.Rename(temp.Name(), target); err != nil {
+    sendFSError(conn, err)
+    return
+  }
+
+  if created {
+    writeResponseHeader(conn, 201, "Created", responseHeader{{name: "Content-Length", value: "0"}})
+    return
+  }
+  writeResponseHeader(conn, 204, "No Content", responseHeader{})
+}
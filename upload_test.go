@@ -0,0 +1,87 @@
+package main
+
+import (
+  "bytes"
+  "fmt"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+func useUploads(t *testing.T, maxSize byteSize) {
+  originalEnabled, originalMax := uploadsEnabled, maxUploadSize
+  uploadsEnabled, maxUploadSize = true, maxSize
+  t.Cleanup(func() { uploadsEnabled, maxUploadSize = originalEnabled, originalMax })
+}
+
+// putRequest builds a PUT request for path declaring length bytes and carrying body.
+func putRequest(path string, length int, body []byte) string {
+  return fmt.Sprintf("PUT %s HTTP/1.1\r\nContent-Length: %d\r\n\r\n%s", path, length, body)
+}
+
+// leftovers returns the temporary upload files left in dir.
+func leftovers(t *testing.T, dir string) []string {
+  matches, err := filepath.Glob(filepath.Join(dir, ".ghttpd-upload-*"))
+  if err != nil {
+    t.Fatalf("Failed to list temporary files: %v", err)
+  }
+  return matches
+}
+
+func TestUpload(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{"docs/existing.txt": "old"})
+  useRoots(t, tempDir)
+  useUploads(t, 8<<20)
+
+  large := bytes.Repeat([]byte("0123456789abcdef"), 4<<16)
+
+  testCases := []struct {
+    name         string
+    request      string
+    expectedCode string
+    file         string
+    expectedFile []byte
+  }{
+    {"Large upload", putRequest("/docs/large.bin", len(large), large), "HTTP/1.1 201 Created", "docs/large.bin", large},
+    {"Replace", putRequest("/docs/existing.txt", 3, []byte("new")), "HTTP/1.1 204 No Content", "docs/existing.txt", []byte("new")},
+    {"Too large", putRequest("/docs/huge.bin", 8<<20+1, []byte("x")), "HTTP/1.1 413 Content Too Large", "docs/huge.bin", nil},
+    {"Truncated body", putRequest("/docs/partial.bin", 100, []byte("short")), "HTTP/1.1 400 Bad Request", "docs/partial.bin", nil},
+    {"Truncated replacement", putRequest("/docs/existing.txt", 100, []byte("short")), "HTTP/1.1 400 Bad Request", "docs/existing.txt", []byte("new")},
+    {"Missing length", "PUT /docs/none.txt HTTP/1.1\r\n\r\nbody", "HTTP/1.1 411 Length Required", "docs/none.txt", nil},
+    {"Missing directory", putRequest("/nowhere/file.txt", 1, []byte("x")), "HTTP/1.1 409 Conflict", "nowhere/file.txt", nil},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      conn := newMockConn(tc.request)
+      handleConnection(conn)
+      if response := conn.GetWrittenData(); !strings.HasPrefix(response, tc.expectedCode) {
+        t.Fatalf("Expected %s, got: %s", tc.expectedCode, response)
+      }
+
+      data, err := os.ReadFile(filepath.Join(tempDir, filepath.FromSlash(tc.file)))
+      if tc.expectedFile == nil {
+        if err == nil {
+          t.Errorf("Expected no file to be written, found %d bytes", len(data))
+        }
+      } else if !bytes.Equal(data, tc.expectedFile) {
+        t.Errorf("Expected %d bytes of uploaded content, got %d bytes (%v)", len(tc.expectedFile), len(data), err)
+      }
+      if files := leftovers(t, filepath.Join(tempDir, "docs")); len(files) > 0 {
+        t.Errorf("Expected temporary files to be removed, found %v", files)
+      }
+    })
+  }
+}
+
+func TestUploadDisabled(t *testing.T) {
+  useRoots(t, t.TempDir())
+
+  conn := newMockConn(putRequest("/file.txt", 1, []byte("x")))
+  handleConnection(conn)
+  if response := conn.GetWrittenData(); !strings.HasPrefix(response, "HTTP/1.1 400") {
+    t.Errorf("Expected PUT to be refused without -upload, got: %s", response)
+  }
+}
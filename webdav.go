@@ -0,0 +1,149 @@
+package main
+
+import (
+  "encoding/xml"
+  "errors"
+  "io/fs"
+  "net"
+  "net/url"
+  "os"
+  "strconv"
+  "strings"
+)
+
+// webdavEnabled answers OPTIONS and PROPFIND, the subset of WebDAV (RFC 4918) clients need to
+// mount the roots as a read-only network drive. Files are still fetched with GET.
+var webdavEnabled bool
+
+// davMultistatus is the body of a 207 Multi-Status response. The DAV: namespace is declared once
+// under the D prefix, which encoding/xml cannot do on its own, so the prefix is part of the names.
+type davMultistatus struct {
+  XMLName   xml.Name      `xml:"D:multistatus"`
+  Namespace string        `xml:"xmlns:D,attr"`
+  Responses []davResponse `xml:"D:response"`
+}
+
+type davResponse struct {
+  Href     string      `xml:"D:href"`
+  Propstat davPropstat `xml:"D:propstat"`
+}
+
+type davPropstat struct {
+  Prop   davProp `xml:"D:prop"`
+  Status string  `xml:"D:status"`
+}
+
+type davProp struct {
+  DisplayName   string          `xml:"D:displayname"`
+  ResourceType  davResourceType `xml:"D:resourcetype"`
+  ContentLength *int64          `xml:"D:getcontentlength,omitempty"`
+  ContentType   string          `xml:"D:getcontenttype,omitempty"`
+  LastModified  string          `xml:"D:getlastmodified"`
+}
+
+type davResourceType struct {
+  Collection *struct{} `xml:"D:collection"`
+}
+
+// sendDAVOptions advertises WebDAV class 1 and the methods accepted.
+func sendDAVOptions(conn net.Conn) {
+  header := responseHeader{}
+  header.set("Allow", allowedMethods())
+  header.set("DAV", "1")
+  header.set("MS-Author-Via", "DAV")
+  header.set("Content-Length", "0")
+  writeResponseHeader(conn, 200, "OK", header)
+}
+
+// handlePropfind answers a PROPFIND with the properties of the resource and, for a directory with
+// Depth: 1, of its entries. Every property is returned whatever the request body asks for, which
+// clients accept. Depth: infinity, also the default, is refused as RFC 4918 allows.
+func handlePropfind(conn net.Conn, req *request) {
+  discardBody(req)
+
+  depth := strings.TrimSpace(req.header("Depth"))
+  if depth != "0" && depth != "1" {
+    sendError(conn, 403, "Forbidden")
+    return
+  }
+  if activeArchive != nil {
+    sendError(conn, 501, "Not Implemented")
+    return
+  }
+
+  file, dirs, err := locateResource(req.path)
+  if err != nil {
+    sendFSError(conn, err)
+    return
+  }
+
+  target := file
+  if file == "" {
+    target = dirs[0]
+  }
+  info, err := os.Stat(target)
+  if err != nil {
+    sendFSError(conn, err)
+    return
+  }
+
+  status := davMultistatus{Namespace: "DAV:"}
+  status.Responses = append(status.Responses, davEntry(req, req.path, info))
+
+  if file == "" && depth == "1" {
+    entries, err := readListing(dirs)
+    if err != nil {
+      sendFSError(conn, err)
+      return
+    }
+    for _, entry := range entries {
+      entryInfo, err := entry.Info()
+      if errors.Is(err, fs.ErrNotExist) {
+        continue
+      } else if err != nil {
+        sendFSError(conn, err)
+        return
+      }
+      status.Responses = append(status.Responses, davEntry(req, joinURLPath(req.path, entry.Name()), entryInfo))
+    }
+  }
+
+  body, err := xml.Marshal(status)
+  if err != nil {
+    sendError(conn, 500, "Internal Server Error")
+    return
+  }
+  body = append([]byte(xml.Header), body...)
+
+  header := responseHeader{}
+  header.set("Content-Type", "application/xml; charset=utf-8")
+  header.set("Content-Length", strconv.Itoa(len(body)))
+  writeResponseHeader(conn, 207, "Multi-Status", header)
+  conn.Write(body)
+}
+
+// davEntry describes the resource at urlPath. Collections get a trailing slash in their href, as
+// clients expect.
+func davEntry(req *request, urlPath string, info fs.FileInfo) davResponse {
+  href := req.prefix + cleanURLPath(urlPath)
+  prop := davProp{
+    DisplayName:  info.Name(),
+    LastModified: info.ModTime().UTC().Format(httpTimeFormat),
+  }
+
+  if info.IsDir() {
+    prop.ResourceType.Collection = &struct{}{}
+    if !strings.HasSuffix(href, "/") {
+      href += "/"
+    }
+  } else {
+    size := info.Size()
+    prop.ContentLength = &size
+    prop.ContentType = contentTypeFor(req, info.Name())
+  }
+
+  return davResponse{
+    Href:     (&url.URL{Path: href}).EscapedPath(),
+    Propstat: davPropstat{Prop: prop, Status: "HTTP/1.1 200 OK"},
+  }
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+  "encoding/xml"
+  "strconv"
+  "strings"
+  "testing"
+)
+
+// propfindResult decodes a multistatus body by namespace, as a WebDAV client would.
+type propfindResult struct {
+  Responses []struct {
+    Href          string    `xml:"DAV: href"`
+    Collection    *struct{} `xml:"DAV: propstat>prop>resourcetype>collection"`
+    ContentLength string    `xml:"DAV: propstat>prop>getcontentlength"`
+    LastModified  string    `xml:"DAV: propstat>prop>getlastmodified"`
+    Status        string    `xml:"DAV: propstat>status"`
+  } `xml:"DAV: response"`
+}
+
+func TestWebDAV(t *testing.T) {
+  tempDir := t.TempDir()
+  writeTestFiles(t, tempDir, map[string]string{
+    "notes.txt":         "hello",
+    "my docs/page.html": "<p>page</p>",
+  })
+  useRoots(t, tempDir)
+
+  original := webdavEnabled
+  webdavEnabled = true
+  defer func() { webdavEnabled = original }()
+
+  conn := newMockConn("OPTIONS / HTTP/1.1\r\n\r\n")
+  handleConnection(conn)
+  response := conn.GetWrittenData()
+  if !strings.HasPrefix(response, "HTTP/1.1 200 OK") || !strings.Contains(response, "DAV: 1\r\n") || !strings.Contains(response, "Allow: GET, HEAD, OPTIONS, PROPFIND\r\n") {
+    t.Errorf("Expected the DAV capabilities, got: %s", response)
+  }
+
+  testCases := []struct {
+    name          string
+    path          string
+    depth         string
+    expectedHrefs []string
+  }{
+    {"Directory depth 1", "/", "1", []string{"/", "/my%20docs/", "/notes.txt"}},
+    {"Directory depth 0", "/", "0", []string{"/"}},
+    {"Subdirectory", "/my%20docs", "1", []string{"/my%20docs/", "/my%20docs/page.html"}},
+    {"File", "/notes.txt", "0", []string{"/notes.txt"}},
+  }
+
+  for _, tc := range testCases {
+    t.Run(tc.name, func(t *testing.T) {
+      body := `<?xml version="1.0"?><propfind xmlns="DAV:"><allprop/></propfind>`
+      conn := newMockConn("PROPFIND " + tc.path + " HTTP/1.1\r\nDepth: " + tc.depth + "\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body)
+      handleConnection(conn)
+
+      response := conn.GetWrittenData()
+      if !strings.HasPrefix(response, "HTTP/1.1 207 Multi-Status") {
+        t.Fatalf("Expected 207 Multi-Status, got: %s", response)
+      }
+      _, xmlBody, _ := strings.Cut(response, "\r\n\r\n")
+
+      var result propfindResult
+      if err := xml.Unmarshal([]byte(xmlBody), &result); err != nil {
+        t.Fatalf("Invalid multistatus XML: %v\n%s", err, xmlBody)
+      }
+      if len(result.Responses) != len(tc.expectedHrefs) {
+        t.Fatalf("Expected %d responses, got: %s", len(tc.expectedHrefs), xmlBody)
+      }
+
+      for i, r := range result.Responses {
+        if r.Href != tc.expectedHrefs[i] {
+          t.Errorf("Expected href %s, got %s", tc.expectedHrefs[i], r.Href)
+        }
+        if isDir := strings.HasSuffix(r.Href, "/"); isDir != (r.Collection != nil) {
+          t.Errorf("Expected collection=%v for %s", isDir, r.Href)
+        }
+        if r.Href == "/notes.txt" && r.ContentLength != "5" {
+          t.Errorf("Expected a content length of 5 for %s, got %q", r.Href, r.ContentLength)
+        }
+        if r.LastModified == "" || r.Status != "HTTP/1.1 200 OK" {
+          t.Errorf("Expected a modification time and 200 status for %s, got %q and %q", r.Href, r.LastModified, r.Status)
+        }
+      }
+    })
+  }
+
+  for _, request := range []string{
+    "PROPFIND / HTTP/1.1\r\nDepth: infinity\r\n\r\n",
+    "PROPFIND / HTTP/1.1\r\n\r\n",
+  } {
+    conn := newMockConn(request)
+    handleConnection(conn)
+    if response := conn.GetWrittenData(); !strings.HasPrefix(response, "HTTP/1.1 403 Forbidden") {
+      t.Errorf("Expected infinite depth to be refused, got: %s", response)
+    }
+  }
+
+  conn = newMockConn("PROPFIND /missing HTTP/1.1\r\nDepth: 0\r\n\r\n")
+  handleConnection(conn)
+  if response := conn.GetWrittenData(); !strings.HasPrefix(response, "HTTP/1.1 404 Not Found") {
+    t.Errorf("Expected 404 for a missing resource, got: %s", response)
+  }
+
+  webdavEnabled = false
+  conn = newMockConn("PROPFIND / HTTP/1.1\r\nDepth: 1\r\n\r\n")
+  handleConnection(conn)
+  if response := conn.GetWrittenData(); strings.HasPrefix(response, "HTTP/1.1 207") {
+    t.Errorf("Expected PROPFIND to be refused without -webdav, got: %s", response)
+  }
+}